@@ -0,0 +1,225 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessKey is the context key of the access of a request.
+const accessKey = "access"
+
+// access is what a request may do: the permissions of the role or token, and
+// for tokens limited to client groups, those groups.
+type access struct {
+	permissions []string
+	groups      []string
+}
+
+func (a *access) can(permission string) bool {
+	return permission == "" || slices.Contains(a.permissions, permission)
+}
+
+// Permissions of the actions, "" for actions every admin may use. Actions
+// not listed need PermSystem.
+var getPermissions = map[string]string{
+	"logout":      "",
+	"tokens":      "",
+	"twoFactor":   "",
+	"load":        service.PermRead,
+	"inbounds":    service.PermRead,
+	"outbounds":   service.PermRead,
+	"endpoints":   service.PermRead,
+	"services":    service.PermRead,
+	"tls":         service.PermRead,
+	"clients":     service.PermRead,
+	"config":      service.PermRead,
+	"users":       service.PermRead,
+	"stats":       service.PermRead,
+	"subAccess":   service.PermRead,
+	"clientUsage": service.PermRead,
+	"status":      service.PermRead,
+	"onlines":     service.PermRead,
+	"logs":        service.PermRead,
+	"changes":     service.PermRead,
+	"change":      service.PermRead,
+	"tgBindings":  service.PermRead,
+	"mtpros":      service.PermRead,
+	"gres":        service.PermRead,
+	"taps":        service.PermRead,
+	"vxlans":      service.PermRead,
+	"routing":     service.PermRead,
+	"udptunnels":  service.PermRead,
+	"keypairs":    service.PermConfig,
+}
+
+var postPermissions = map[string]string{
+	"changePass":            "",
+	"addToken":              "",
+	"deleteToken":           "",
+	"totpSetup":             "",
+	"totpEnable":            "",
+	"totpDisable":           "",
+	"webauthnRegisterBegin": "",
+	"webauthnRegister":      "",
+	"webauthnDelete":        "",
+	"revert":                "", // Checked against the changed object by the handler
+	"linkConvert":           service.PermRead,
+	"rotateSubToken":        service.PermClients,
+	"tgBindCode":            service.PermClients,
+	"tgUnbind":              service.PermClients,
+	"restartSb":             service.PermConfig,
+}
+
+// Tunnel actions are named by prefix, like gre_save
+var tunnelActionPrefixes = []string{"gost_", "mtproto_", "gre_", "tap_", "vxlan_", "route_", "rule_", "udp_tunnel_"}
+
+// Permissions of the objects of the save action
+var savePermissions = map[string]string{
+	"clients":   service.PermClients,
+	"inbounds":  service.PermConfig,
+	"outbounds": service.PermConfig,
+	"endpoints": service.PermConfig,
+	"services":  service.PermConfig,
+	"tls":       service.PermConfig,
+	"config":    service.PermConfig,
+	"chisel":    service.PermTunnels,
+}
+
+// changePermission returns the permission needed to revert a change of the change log.
+func changePermission(key string) string {
+	if permission, ok := savePermissions[key]; ok {
+		return permission
+	}
+	switch key {
+	case service.ChangeGost, service.ChangeMTProto, service.ChangeGre, service.ChangeTap, service.ChangeVxlan,
+		service.ChangeRoute, service.ChangeRule, service.ChangeRouteTable, service.ChangeUdpTunnel:
+		return service.PermTunnels
+	case service.ChangeSubTemplate:
+		return service.PermConfig
+	}
+	return service.PermSystem
+}
+
+// Keys of the change log whose snapshots hold secrets, like the Telegram bot
+// token in the settings, with the permission needed to read them. Other
+// changes need PermRead.
+var secretChangePermissions = map[string]string{
+	"settings": service.PermSystem,
+}
+
+// hiddenChangeKeys returns the keys of the change log the access may not read.
+func hiddenChangeKeys(acc *access) []string {
+	var keys []string
+	if acc == nil {
+		return keys
+	}
+	for key, permission := range secretChangePermissions {
+		if !acc.can(permission) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Permissions of the REST groups of /apiv2 which change something, reading
+// needs PermRead.
+var restPermissions = map[string]string{
+	"chisel":       service.PermTunnels,
+	"gre":          service.PermTunnels,
+	"tap":          service.PermTunnels,
+	"mtproto":      service.PermTunnels,
+	"vxlan":        service.PermTunnels,
+	"routing":      service.PermTunnels,
+	"netns":        service.PermTunnels,
+	"subtemplates": service.PermConfig,
+}
+
+// Requests which tokens limited to client groups may send
+var groupGetActions = []string{"clients", "inbounds", "subAccess", "clientUsage", "changes", "change"}
+var groupPostActions = []string{"save", "rotateSubToken", "revert"}
+
+// requiredPermission returns the permission a request needs, route is the
+// path of the route relative to the API group.
+func requiredPermission(c *gin.Context, route string) string {
+	switch route {
+	case "/:getAction":
+		if permission, ok := getPermissions[c.Param("getAction")]; ok {
+			return permission
+		}
+		return service.PermSystem
+	case "/:postAction":
+		action := c.Param("postAction")
+		if action == "save" {
+			if permission, ok := savePermissions[c.Request.FormValue("object")]; ok {
+				return permission
+			}
+			return service.PermSystem
+		}
+		if permission, ok := postPermissions[action]; ok {
+			return permission
+		}
+		for _, prefix := range tunnelActionPrefixes {
+			if strings.HasPrefix(action, prefix) {
+				return service.PermTunnels
+			}
+		}
+		return service.PermSystem
+	}
+	group := strings.Split(strings.TrimPrefix(route, "/"), "/")[0]
+	permission, ok := restPermissions[group]
+	if !ok {
+		return service.PermSystem
+	}
+	if c.Request.Method == http.MethodGet {
+		return service.PermRead
+	}
+	return permission
+}
+
+// checkAccess rejects requests outside the access stored in the context.
+func checkAccess(c *gin.Context, basePath string) {
+	value, ok := c.Get(accessKey)
+	if !ok {
+		// Public actions
+		c.Next()
+		return
+	}
+	acc := value.(*access)
+	route := strings.TrimPrefix(c.FullPath(), basePath)
+	permission := requiredPermission(c, route)
+	if !acc.can(permission) {
+		jsonMsg(c, "", common.NewErrorf("permission denied, %s is required", permission))
+		c.Abort()
+		return
+	}
+	if acc.groups != nil {
+		allowed := false
+		switch route {
+		case "/:getAction":
+			allowed = slices.Contains(groupGetActions, c.Param("getAction"))
+		case "/:postAction":
+			allowed = slices.Contains(groupPostActions, c.Param("postAction"))
+		}
+		if !allowed {
+			jsonMsg(c, "", common.NewError("permission denied, the token is limited to client groups"))
+			c.Abort()
+			return
+		}
+	}
+	c.Next()
+}
+
+// getAccess returns the access of a request, nil for public actions.
+func getAccess(c *gin.Context) *access {
+	value, ok := c.Get(accessKey)
+	if !ok {
+		return nil
+	}
+	return value.(*access)
+}
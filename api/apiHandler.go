@@ -1,8 +1,8 @@
 package api
 
 import (
+	"path"
 	"strconv"
-	"strings"
 
 	"github.com/igor04091968/sing-chisel-tel/database/model"
 	"github.com/igor04091968/sing-chisel-tel/service"
@@ -47,22 +47,68 @@ func NewAPIHandler(g *gin.RouterGroup, a2 *APIv2Handler, bundle *service.Service
 		if bundle.UdpTunnelService != nil {
 			a.ApiService.UdpTunnelService = *bundle.UdpTunnelService
 		}
+		if bundle.GreService != nil {
+			a.ApiService.GreService = *bundle.GreService
+		}
+		if bundle.TapService != nil {
+			a.ApiService.TapService = *bundle.TapService
+		}
+		if bundle.VxlanService != nil {
+			a.ApiService.VxlanService = *bundle.VxlanService
+		}
+		if bundle.RoutingService != nil {
+			a.ApiService.RoutingService = *bundle.RoutingService
+		}
 	}
 
 	a.initRouter(g)
 }
 
+// publicActions are reachable without a session, the second login factor included.
+var publicActions = map[string]bool{
+	"login":              true,
+	"logout":             true,
+	"loginTotp":          true,
+	"loginWebauthnBegin": true,
+	"loginWebauthn":      true,
+	"loginTelegram":      true,
+}
+
 func (a *APIHandler) initRouter(g *gin.RouterGroup) {
 	g.Use(func(c *gin.Context) {
-		path := c.Request.URL.Path
-		if !strings.HasSuffix(path, "login") && !strings.HasSuffix(path, "logout") {
+		if !publicActions[path.Base(c.Request.URL.Path)] {
 			checkLogin(c)
 		}
 	})
+	g.Use(func(c *gin.Context) {
+		if !publicActions[path.Base(c.Request.URL.Path)] {
+			a.loadRole(c)
+			if c.IsAborted() {
+				return
+			}
+		}
+		checkAccess(c, g.BasePath())
+	})
 	g.POST("/:postAction", a.postHandler)
 	g.GET("/:getAction", a.getHandler)
 }
 
+// loadRole stores the permissions of the role of the logged in admin, the
+// role is read on every request so changes apply at once.
+func (a *APIHandler) loadRole(c *gin.Context) {
+	role, err := a.ApiService.UserService.GetRole(GetLoginUser(c))
+	if err == nil {
+		var permissions []string
+		permissions, err = service.RolePermissions(role)
+		if err == nil {
+			c.Set(accessKey, &access{permissions: permissions})
+			return
+		}
+	}
+	jsonMsg(c, "", err)
+	c.Abort()
+}
+
 func (a *APIHandler) postHandler(c *gin.Context) {
 	loginUser := GetLoginUser(c)
 	action := c.Param("postAction")
@@ -70,10 +116,36 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 	switch action {
 	case "login":
 		a.ApiService.Login(c)
+	case "loginTotp":
+		a.ApiService.LoginTotp(c)
+	case "loginWebauthnBegin":
+		a.ApiService.LoginWebAuthnBegin(c)
+	case "loginWebauthn":
+		a.ApiService.LoginWebAuthn(c)
+	case "loginTelegram":
+		a.ApiService.LoginTelegram(c)
+	case "totpSetup":
+		a.ApiService.TotpSetup(c)
+	case "totpEnable":
+		a.ApiService.TotpEnable(c)
+	case "totpDisable":
+		a.ApiService.TotpDisable(c)
+	case "webauthnRegisterBegin":
+		a.ApiService.WebAuthnRegisterBegin(c)
+	case "webauthnRegister":
+		a.ApiService.WebAuthnRegister(c)
+	case "webauthnDelete":
+		a.ApiService.WebAuthnDelete(c)
 	case "changePass":
 		a.ApiService.ChangePass(c)
 	case "save":
 		a.ApiService.Save(c, loginUser)
+	case "rotateSubToken":
+		a.ApiService.RotateSubToken(c)
+	case "revert":
+		a.ApiService.Revert(c)
+	case "unban":
+		a.ApiService.Unban(c)
 	case "restartApp":
 		a.ApiService.RestartApp(c)
 	case "restartSb":
@@ -98,6 +170,18 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 	case "deleteToken":
 		a.ApiService.DeleteToken(c)
 		a.apiv2.ReloadTokens()
+	case "addAdmin":
+		a.ApiService.AddAdmin(c)
+	case "setRole":
+		a.ApiService.SetRole(c)
+		a.apiv2.ReloadTokens()
+	case "delAdmin":
+		a.ApiService.DelAdmin(c)
+		a.apiv2.ReloadTokens()
+	case "tgBindCode":
+		a.ApiService.NewTgBindCode(c)
+	case "tgUnbind":
+		a.ApiService.DeleteTgBinding(c)
 	case "mtproto_save":
 		var config model.MTProtoProxyConfig
 		if err := c.ShouldBindJSON(&config); err != nil {
@@ -105,6 +189,9 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			return
 		}
 		err := a.ApiService.CreateMTProtoProxy(&config)
+		if err == nil {
+			recordChange(c, service.ChangeMTProto, "new", config.ID, nil)
+		}
 		jsonMsg(c, "mtproto_save", err)
 	case "mtproto_start":
 		var config model.MTProtoProxyConfig
@@ -128,7 +215,11 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			jsonMsg(c, "mtproto_delete", err)
 			return
 		}
+		before := changeSnapshot(service.ChangeMTProto, uint(id))
 		err = a.ApiService.DeleteMTProtoProxy(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeMTProto, "del", uint(id), before)
+		}
 		jsonMsg(c, "mtproto_delete", err)
 	case "mtproto_update":
 		var config model.MTProtoProxyConfig
@@ -136,7 +227,11 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			jsonMsg(c, "mtproto_update", err)
 			return
 		}
+		before := changeSnapshot(service.ChangeMTProto, config.ID)
 		err := a.ApiService.UpdateMTProtoProxy(&config)
+		if err == nil {
+			recordChange(c, service.ChangeMTProto, "edit", config.ID, before)
+		}
 		jsonMsg(c, "mtproto_update", err)
 	case "gre_save":
 		var config model.GreTunnel
@@ -145,6 +240,9 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			return
 		}
 		err := a.ApiService.CreateGreTunnel(&config)
+		if err == nil {
+			recordChange(c, service.ChangeGre, "new", config.ID, nil)
+		}
 		jsonMsg(c, "gre_save", err)
 	// case "gre_start":
 	// 	a.ApiService.StartGre(c)
@@ -156,7 +254,11 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			jsonMsg(c, "gre_delete", err)
 			return
 		}
+		before := changeSnapshot(service.ChangeGre, uint(id))
 		err = a.ApiService.DeleteGreTunnel(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeGre, "del", uint(id), before)
+		}
 		jsonMsg(c, "gre_delete", err)
 	// case "gre_update":
 	// 	a.ApiService.UpdateGre(c)
@@ -167,6 +269,9 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			return
 		}
 		err := a.ApiService.CreateTapTunnel(&config)
+		if err == nil {
+			recordChange(c, service.ChangeTap, "new", config.ID, nil)
+		}
 		jsonMsg(c, "tap_save", err)
 	// case "tap_start":
 	// 	a.ApiService.StartTap(c)
@@ -178,10 +283,106 @@ func (a *APIHandler) postHandler(c *gin.Context) {
 			jsonMsg(c, "tap_delete", err)
 			return
 		}
+		before := changeSnapshot(service.ChangeTap, uint(id))
 		err = a.ApiService.DeleteTapTunnel(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeTap, "del", uint(id), before)
+		}
 		jsonMsg(c, "tap_delete", err)
 	// case "tap_update":
 	// 	a.ApiService.UpdateTap(c)
+	case "vxlan_save":
+		var config model.VxlanTunnel
+		if err := c.ShouldBindJSON(&config); err != nil {
+			jsonMsg(c, "vxlan_save", err)
+			return
+		}
+		err := a.ApiService.CreateVxlanTunnel(&config)
+		if err == nil {
+			recordChange(c, service.ChangeVxlan, "new", config.ID, nil)
+		}
+		jsonMsg(c, "vxlan_save", err)
+	case "vxlan_delete":
+		id, err := strconv.ParseUint(c.PostForm("id"), 10, 32)
+		if err != nil {
+			jsonMsg(c, "vxlan_delete", err)
+			return
+		}
+		before := changeSnapshot(service.ChangeVxlan, uint(id))
+		err = a.ApiService.DeleteVxlanTunnel(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeVxlan, "del", uint(id), before)
+		}
+		jsonMsg(c, "vxlan_delete", err)
+	case "route_save":
+		var route model.Route
+		if err := c.ShouldBindJSON(&route); err != nil {
+			jsonMsg(c, "route_save", err)
+			return
+		}
+		err := a.ApiService.CreateRoute(&route)
+		if err == nil {
+			recordChange(c, service.ChangeRoute, "new", route.ID, nil)
+		}
+		jsonMsg(c, "route_save", err)
+	case "route_delete":
+		id, err := strconv.ParseUint(c.PostForm("id"), 10, 32)
+		if err != nil {
+			jsonMsg(c, "route_delete", err)
+			return
+		}
+		before := changeSnapshot(service.ChangeRoute, uint(id))
+		err = a.ApiService.DeleteRoute(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeRoute, "del", uint(id), before)
+		}
+		jsonMsg(c, "route_delete", err)
+	case "rule_save":
+		var rule model.RouteRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			jsonMsg(c, "rule_save", err)
+			return
+		}
+		err := a.ApiService.CreateRouteRule(&rule)
+		if err == nil {
+			recordChange(c, service.ChangeRule, "new", rule.ID, nil)
+		}
+		jsonMsg(c, "rule_save", err)
+	case "rule_delete":
+		id, err := strconv.ParseUint(c.PostForm("id"), 10, 32)
+		if err != nil {
+			jsonMsg(c, "rule_delete", err)
+			return
+		}
+		before := changeSnapshot(service.ChangeRule, uint(id))
+		err = a.ApiService.DeleteRouteRule(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeRule, "del", uint(id), before)
+		}
+		jsonMsg(c, "rule_delete", err)
+	case "route_table_save":
+		var table model.RouteTable
+		if err := c.ShouldBindJSON(&table); err != nil {
+			jsonMsg(c, "route_table_save", err)
+			return
+		}
+		err := a.ApiService.CreateRouteTable(&table)
+		if err == nil {
+			recordChange(c, service.ChangeRouteTable, "new", table.ID, nil)
+		}
+		jsonMsg(c, "route_table_save", err)
+	case "route_table_delete":
+		id, err := strconv.ParseUint(c.PostForm("id"), 10, 32)
+		if err != nil {
+			jsonMsg(c, "route_table_delete", err)
+			return
+		}
+		before := changeSnapshot(service.ChangeRouteTable, uint(id))
+		err = a.ApiService.DeleteRouteTable(uint(id))
+		if err == nil {
+			recordChange(c, service.ChangeRouteTable, "del", uint(id), before)
+		}
+		jsonMsg(c, "route_table_delete", err)
     case "udp_tunnel_save":
         var config model.UdpTunnelConfig
         if err := c.ShouldBindJSON(&config); err != nil {
@@ -189,6 +390,9 @@ func (a *APIHandler) postHandler(c *gin.Context) {
             return
         }
         err := a.ApiService.CreateUdpTunnel(&config)
+        if err == nil {
+            recordChange(c, service.ChangeUdpTunnel, "new", config.ID, nil)
+        }
         jsonMsg(c, "udp_tunnel_save", err)
     case "udp_tunnel_start":
         id, err := strconv.ParseUint(c.PostForm("id"), 10, 32)
@@ -217,7 +421,11 @@ func (a *APIHandler) postHandler(c *gin.Context) {
             jsonMsg(c, "udp_tunnel_delete", err)
             return
         }
+        before := changeSnapshot(service.ChangeUdpTunnel, uint(id))
         err = a.ApiService.DeleteUdpTunnel(uint(id))
+        if err == nil {
+            recordChange(c, service.ChangeUdpTunnel, "del", uint(id), before)
+        }
         jsonMsg(c, "udp_tunnel_delete", err)
     case "udp_tunnel_update":
         var config model.UdpTunnelConfig
@@ -225,7 +433,11 @@ func (a *APIHandler) postHandler(c *gin.Context) {
             jsonMsg(c, "udp_tunnel_update", err)
             return
         }
+        before := changeSnapshot(service.ChangeUdpTunnel, config.ID)
         err := a.ApiService.UpdateUdpTunnel(&config)
+        if err == nil {
+            recordChange(c, service.ChangeUdpTunnel, "edit", config.ID, before)
+        }
         jsonMsg(c, "udp_tunnel_update", err)
 	default:
 		jsonMsg(c, "failed", common.NewError("unknown action: ", action))
@@ -252,6 +464,10 @@ func (a *APIHandler) getHandler(c *gin.Context) {
 		a.ApiService.GetSettings(c)
 	case "stats":
 		a.ApiService.GetStats(c)
+	case "subAccess":
+		a.ApiService.GetSubAccess(c)
+	case "clientUsage":
+		a.ApiService.GetClientUsage(c)
 	case "status":
 		a.ApiService.GetStatus(c)
 	case "onlines":
@@ -260,12 +476,22 @@ func (a *APIHandler) getHandler(c *gin.Context) {
 		a.ApiService.GetLogs(c)
 	case "changes":
 		a.ApiService.CheckChanges(c)
+	case "change":
+		a.ApiService.GetChange(c)
 	case "keypairs":
 		a.ApiService.GetKeypairs(c)
 	case "getdb":
 		a.ApiService.GetDb(c)
 	case "tokens":
 		a.ApiService.GetTokens(c)
+	case "bannedIps":
+		a.ApiService.GetBannedIps(c)
+	case "admins":
+		a.ApiService.GetAdmins(c)
+	case "twoFactor":
+		a.ApiService.GetTwoFactor(c)
+	case "tgBindings":
+		a.ApiService.GetTgBindings(c)
 	case "mtpros":
 		proxies, err := a.ApiService.GetAllMTProtoProxies()
 		if err != nil {
@@ -287,6 +513,18 @@ func (a *APIHandler) getHandler(c *gin.Context) {
 			return
 		}
 		jsonObj(c, tunnels, nil)
+	case "routing":
+		err := a.ApiService.LoadPartialData(c, []string{action})
+		if err != nil {
+			jsonMsg(c, action, err)
+		}
+	case "vxlans":
+		tunnels, err := a.ApiService.GetAllVxlanTunnels()
+		if err != nil {
+			jsonMsg(c, "vxlans", err)
+			return
+		}
+		jsonObj(c, tunnels, nil)
 	case "udptunnels":
 		tunnels, err := a.ApiService.GetAllUdpTunnels()
 		if err != nil {
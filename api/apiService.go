@@ -11,6 +11,7 @@ import (
 	"github.com/igor04091968/sing-chisel-tel/logger"
 	"github.com/igor04091968/sing-chisel-tel/service"
 	"github.com/igor04091968/sing-chisel-tel/util"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
 
 	"github.com/gin-gonic/gin"
 )
@@ -34,6 +35,12 @@ type ApiService struct {
 	service.GreService
 	service.TapService
 	service.UdpTunnelService
+	service.VxlanService
+	service.RoutingService
+	service.TgBindingService
+	service.SubAccessService
+	service.TwoFactorService
+	service.LoginGuardService
 }
 
 func (a *ApiService) LoadData(c *gin.Context) {
@@ -131,7 +138,13 @@ func (a *ApiService) LoadPartialData(c *gin.Context, objs []string) error {
 	for _, obj := range objs {
 		switch obj {
 		case "inbounds":
-			inbounds, err := a.InboundService.Get(id)
+			var inbounds *[]map[string]interface{}
+			var err error
+			if acc := getAccess(c); acc != nil && acc.groups != nil {
+				inbounds, err = a.InboundService.GetInGroups(id, acc.groups)
+			} else {
+				inbounds, err = a.InboundService.Get(id)
+			}
 			if err != nil {
 				return err
 			}
@@ -178,6 +191,30 @@ func (a *ApiService) LoadPartialData(c *gin.Context, objs []string) error {
 				return err
 			}
 			data[obj] = tapConfigs
+		case "vxlans":
+			vxlanConfigs, err := a.VxlanService.GetAllVxlanTunnels()
+			if err != nil {
+				return err
+			}
+			data[obj] = vxlanConfigs
+		case "routing":
+			routes, err := a.RoutingService.GetAllRoutes()
+			if err != nil {
+				return err
+			}
+			rules, err := a.RoutingService.GetAllRouteRules()
+			if err != nil {
+				return err
+			}
+			tables, err := a.RoutingService.GetAllRouteTables()
+			if err != nil {
+				return err
+			}
+			data[obj] = map[string]interface{}{
+				"routes": routes,
+				"rules":  rules,
+				"tables": tables,
+			}
 		case "udptunnels":
 			udpTunnelConfigs, err := a.UdpTunnelService.GetAllUdpTunnels()
 			if err != nil {
@@ -191,7 +228,13 @@ func (a *ApiService) LoadPartialData(c *gin.Context, objs []string) error {
 			}
 			data[obj] = tlsConfigs
 		case "clients":
-			clients, err := a.ClientService.Get(id)
+			var clients *[]model.Client
+			var err error
+			if acc := getAccess(c); acc != nil && acc.groups != nil {
+				clients, err = a.ClientService.GetInGroups(id, acc.groups)
+			} else {
+				clients, err = a.ClientService.Get(id)
+			}
 			if err != nil {
 				return err
 			}
@@ -248,6 +291,43 @@ func (a *ApiService) GetStats(c *gin.Context) {
 	jsonObj(c, data, err)
 }
 
+// GetSubAccess retrieves the latest subscription fetches of a client.
+func (a *ApiService) GetSubAccess(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil {
+		limit = 100
+	}
+	if acc := getAccess(c); acc != nil && acc.groups != nil {
+		if err = a.ClientService.CheckClientGroups(uint(id), acc.groups); err != nil {
+			jsonMsg(c, "", err)
+			return
+		}
+	}
+	data, err := a.SubAccessService.GetByClient(uint(id), limit)
+	jsonObj(c, data, err)
+}
+
+func (a *ApiService) GetClientUsage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	if acc := getAccess(c); acc != nil && acc.groups != nil {
+		if err = a.ClientService.CheckClientGroups(uint(id), acc.groups); err != nil {
+			jsonMsg(c, "", err)
+			return
+		}
+	}
+	data, err := a.ClientService.GetUsage(uint(id))
+	jsonObj(c, data, err)
+}
+
 func (a *ApiService) GetStatus(c *gin.Context) {
 	request := c.Query("r")
 	result := a.ServerService.GetStatus(request)
@@ -270,7 +350,11 @@ func (a *ApiService) CheckChanges(c *gin.Context) {
 	actor := c.Query("a")
 	chngKey := c.Query("k")
 	count := c.Query("c")
-	changes := a.ConfigService.GetChanges(actor, chngKey, count)
+	if acc := getAccess(c); acc != nil && acc.groups != nil {
+		jsonObj(c, a.ConfigService.GetChangesInGroups(actor, count, acc.groups), nil)
+		return
+	}
+	changes := a.ConfigService.GetChanges(actor, chngKey, count, hiddenChangeKeys(getAccess(c)))
 	jsonObj(c, changes, nil)
 }
 
@@ -317,6 +401,22 @@ func (a *ApiService) Login(c *gin.Context) {
 		return
 	}
 
+	methods, err := a.TwoFactorService.Methods(loginUser)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	if len(methods) > 0 {
+		// The password is right, the session is only created after the second factor
+		err = SetPendingLogin(c, a.TwoFactorService.StartLogin(loginUser, remoteIP))
+		jsonObj(c, map[string]interface{}{"twoFactor": methods}, err)
+		return
+	}
+	a.completeLogin(c, loginUser)
+}
+
+// completeLogin creates the session of a user who passed all login factors.
+func (a *ApiService) completeLogin(c *gin.Context, loginUser string) {
 	sessionMaxAge, err := a.SettingService.GetSessionMaxAge()
 	if err != nil {
 		logger.Infof("Unable to get sessions max age from DB")
@@ -324,6 +424,7 @@ func (a *ApiService) Login(c *gin.Context) {
 
 	err = SetLoginUser(c, loginUser, sessionMaxAge)
 	if err == nil {
+		a.LoginGuardService.Succeeded(getRemoteIp(c), loginUser)
 		logger.Info("user ", loginUser, " login success")
 	} else {
 		logger.Warning("login failed: ", err)
@@ -354,6 +455,16 @@ func (a *ApiService) Save(c *gin.Context, loginUser string) {
 	act := c.Request.FormValue("action")
 	data := c.Request.FormValue("data")
 	initUsers := c.Request.FormValue("initUsers")
+	if acc := getAccess(c); acc != nil && acc.groups != nil {
+		if obj != "clients" {
+			jsonMsg(c, "save", common.NewError("permission denied, the token is limited to client groups"))
+			return
+		}
+		if err := a.ClientService.CheckSaveGroups(act, json.RawMessage(data), acc.groups); err != nil {
+			jsonMsg(c, "save", err)
+			return
+		}
+	}
 	objs, err := a.ConfigService.Save(obj, act, json.RawMessage(data), initUsers, loginUser, hostname)
 	if err != nil {
 		jsonMsg(c, "save", err)
@@ -406,11 +517,6 @@ func (a *ApiService) Logout(c *gin.Context) {
 	jsonMsg(c, "", nil)
 }
 
-// LoadTokens loads user tokens.
-func (a *ApiService) LoadTokens() ([]byte, error) {
-	return a.UserService.LoadTokens()
-}
-
 // GetTokens retrieves user tokens.
 func (a *ApiService) GetTokens(c *gin.Context) {
 	loginUser := GetLoginUser(c)
@@ -428,17 +534,112 @@ func (a *ApiService) AddToken(c *gin.Context) {
 		return
 	}
 	desc := c.Request.FormValue("desc")
-	token, err := a.UserService.AddToken(loginUser, expiryInt, desc)
+	scopes := c.Request.FormValue("scopes")
+	groups := c.Request.FormValue("groups")
+	rateLimit := 0
+	if limit := c.Request.FormValue("rateLimit"); limit != "" {
+		rateLimit, err = strconv.Atoi(limit)
+		if err != nil {
+			jsonMsg(c, "", err)
+			return
+		}
+	}
+	token, err := a.UserService.AddToken(loginUser, expiryInt, desc, scopes, groups, rateLimit)
 	jsonObj(c, token, err)
 }
 
 // DeleteToken deletes a user token.
 func (a *ApiService) DeleteToken(c *gin.Context) {
+	loginUser := GetLoginUser(c)
 	tokenId := c.Request.FormValue("id")
-	err := a.UserService.DeleteToken(tokenId)
+	err := a.UserService.DeleteToken(loginUser, tokenId)
+	jsonMsg(c, "", err)
+}
+
+// NewTgBindCode generates a one-time code which binds a Telegram account to a client.
+func (a *ApiService) NewTgBindCode(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Request.FormValue("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	code, err := a.TgBindingService.NewBindCode(uint(id))
+	jsonObj(c, code, err)
+}
+
+// DeleteTgBinding removes the link between a Telegram account and a client.
+func (a *ApiService) DeleteTgBinding(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Request.FormValue("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	err = a.TgBindingService.DeleteBinding(uint(id))
 	jsonMsg(c, "", err)
 }
 
+// RotateSubToken replaces the subscription token of a client.
+func (a *ApiService) RotateSubToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Request.FormValue("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	if acc := getAccess(c); acc != nil && acc.groups != nil {
+		if err = a.ClientService.CheckClientGroups(uint(id), acc.groups); err != nil {
+			jsonMsg(c, "", err)
+			return
+		}
+	}
+	token, err := a.ClientService.RotateSubToken(uint(id))
+	jsonObj(c, token, err)
+}
+
+// GetAdmins retrieves the admins of the panel with their roles.
+func (a *ApiService) GetAdmins(c *gin.Context) {
+	users, err := a.UserService.GetUsers()
+	jsonObj(c, users, err)
+}
+
+// AddAdmin creates an admin with a role.
+func (a *ApiService) AddAdmin(c *gin.Context) {
+	username := c.Request.FormValue("username")
+	password := c.Request.FormValue("password")
+	role := c.Request.FormValue("role")
+	err := a.UserService.AddUser(username, password, role)
+	jsonMsg(c, "", err)
+}
+
+// SetRole changes the role of an admin.
+func (a *ApiService) SetRole(c *gin.Context) {
+	err := a.UserService.SetRole(c.Request.FormValue("id"), c.Request.FormValue("role"))
+	jsonMsg(c, "", err)
+}
+
+// DelAdmin removes an admin.
+func (a *ApiService) DelAdmin(c *gin.Context) {
+	loginUser := GetLoginUser(c)
+	err := a.UserService.DeleteUser(c.Request.FormValue("id"), loginUser)
+	jsonMsg(c, "", err)
+}
+
+// GetBannedIps retrieves the IPs and usernames locked out after failed logins.
+func (a *ApiService) GetBannedIps(c *gin.Context) {
+	jsonObj(c, a.LoginGuardService.GetBans(), nil)
+}
+
+// Unban lifts the lockout of an IP or username.
+func (a *ApiService) Unban(c *gin.Context) {
+	err := a.LoginGuardService.Unban(c.Request.FormValue("key"))
+	jsonMsg(c, "", err)
+}
+
+// GetTgBindings retrieves the links between Telegram accounts and clients.
+func (a *ApiService) GetTgBindings(c *gin.Context) {
+	bindings, err := a.TgBindingService.GetBindings()
+	jsonObj(c, bindings, err)
+}
+
 // GOST API methods
 func (a *ApiService) GetGosts(c *gin.Context) {
 	configs, err := a.GostService.GetAllGostConfigs()
@@ -462,6 +663,7 @@ func (a *ApiService) SaveGost(c *gin.Context) {
 			jsonMsg(c, "gost_save", err)
 			return
 		}
+		recordChange(c, service.ChangeGost, "new", cfg.ID, nil)
 		jsonMsg(c, "gost_save", nil)
 	}
 }
@@ -478,10 +680,12 @@ func (a *ApiService) UpdateGost(c *gin.Context) {
 		jsonMsg(c, "gost_update", err)
 		return
 	}
+	before := changeSnapshot(service.ChangeGost, orig.ID)
 	if err := database.GetDB().Model(&orig).Updates(&cfg).Error; err != nil {
 		jsonMsg(c, "gost_update", err)
 		return
 	}
+	recordChange(c, service.ChangeGost, "edit", orig.ID, before)
 	jsonMsg(c, "gost_update", nil)
 }
 
@@ -525,10 +729,12 @@ func (a *ApiService) DeleteGost(c *gin.Context) {
 		jsonMsg(c, "gost_delete", err)
 		return
 	}
+	before := changeSnapshot(service.ChangeGost, uint(idI))
 	if err := a.GostService.DeleteGostConfig(uint(idI)); err != nil {
 		jsonMsg(c, "gost_delete", err)
 		return
 	}
+	recordChange(c, service.ChangeGost, "del", uint(idI), before)
 	jsonMsg(c, "gost_delete", nil)
 }
 
@@ -1,34 +1,35 @@
 package api
 
 import (
-	"encoding/json"
-	"time"
+	"net/http"
 
 	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/service"
 	"github.com/igor04091968/sing-chisel-tel/util/common"
 
 	"github.com/gin-gonic/gin"
 )
 
-type TokenInMemory struct {
-	Token    string
-	Expiry   int64
-	Username string
-}
-
 type APIv2Handler struct {
 	ApiService
-	tokens *[]TokenInMemory
-	greAPI *GreAPI
-	tapAPI *TapAPI
-	mtprotoAPI *MTProtoAPI // Add this line
+	greAPI         *GreAPI
+	tapAPI         *TapAPI
+	mtprotoAPI     *MTProtoAPI // Add this line
+	vxlanAPI       *VxlanAPI
+	routingAPI     *RoutingAPI
+	netnsAPI       *NetnsAPI
+	subTemplateAPI *SubTemplateAPI
 }
 
 func NewAPIv2Handler(g *gin.RouterGroup) *APIv2Handler {
 	a := &APIv2Handler{
-		greAPI: NewGreAPI(),
-		tapAPI: NewTapAPI(),
-		mtprotoAPI: NewMTProtoAPI(), // Add this line
+		greAPI:         NewGreAPI(),
+		tapAPI:         NewTapAPI(),
+		mtprotoAPI:     NewMTProtoAPI(), // Add this line
+		vxlanAPI:       NewVxlanAPI(),
+		routingAPI:     NewRoutingAPI(),
+		netnsAPI:       NewNetnsAPI(),
+		subTemplateAPI: NewSubTemplateAPI(),
 	}
 	a.ReloadTokens()
 	a.initRouter(g)
@@ -39,6 +40,9 @@ func (a *APIv2Handler) initRouter(g *gin.RouterGroup) {
 	g.Use(func(c *gin.Context) {
 		a.checkToken(c)
 	})
+	g.Use(func(c *gin.Context) {
+		checkAccess(c, g.BasePath())
+	})
 	g.POST("/:postAction", a.postHandler)
 	g.GET("/:getAction", a.getHandler)
 
@@ -56,6 +60,10 @@ func (a *APIv2Handler) initRouter(g *gin.RouterGroup) {
 	a.greAPI.RegisterRoutes(g)
 	a.tapAPI.RegisterRoutes(g)
 	a.mtprotoAPI.RegisterRoutes(g) // Add this line
+	a.vxlanAPI.RegisterRoutes(g)
+	a.routingAPI.RegisterRoutes(g)
+	a.netnsAPI.RegisterRoutes(g)
+	a.subTemplateAPI.RegisterRoutes(g)
 }
 
 func (a *APIv2Handler) postHandler(c *gin.Context) {
@@ -65,6 +73,10 @@ func (a *APIv2Handler) postHandler(c *gin.Context) {
 	switch action {
 	case "save":
 		a.ApiService.Save(c, username)
+	case "rotateSubToken":
+		a.ApiService.RotateSubToken(c)
+	case "revert":
+		a.ApiService.Revert(c)
 	case "restartApp":
 		a.ApiService.RestartApp(c)
 	case "restartSb":
@@ -73,6 +85,8 @@ func (a *APIv2Handler) postHandler(c *gin.Context) {
 		a.ApiService.LinkConvert(c)
 	case "importdb":
 		a.ApiService.ImportDb(c)
+	case "unban":
+		a.ApiService.Unban(c)
 	default:
 		jsonMsg(c, "failed", common.NewError("unknown action: ", action))
 	}
@@ -96,6 +110,10 @@ func (a *APIv2Handler) getHandler(c *gin.Context) {
 		a.ApiService.GetSettings(c)
 	case "stats":
 		a.ApiService.GetStats(c)
+	case "subAccess":
+		a.ApiService.GetSubAccess(c)
+	case "clientUsage":
+		a.ApiService.GetClientUsage(c)
 	case "status":
 		a.ApiService.GetStatus(c)
 	case "onlines":
@@ -104,49 +122,59 @@ func (a *APIv2Handler) getHandler(c *gin.Context) {
 		a.ApiService.GetLogs(c)
 	case "changes":
 		a.ApiService.CheckChanges(c)
+	case "change":
+		a.ApiService.GetChange(c)
 	case "keypairs":
 		a.ApiService.GetKeypairs(c)
 	case "getdb":
 		a.ApiService.GetDb(c)
+	case "bannedIps":
+		a.ApiService.GetBannedIps(c)
 	default:
 		jsonMsg(c, "failed", common.NewError("unknown action: ", action))
 	}
 }
 
+// tokenKey is the context key of the API token of a request.
+const tokenKey = "apiToken"
+
 func (a *APIv2Handler) findUsername(c *gin.Context) string {
-	token := c.Request.Header.Get("Token")
-	for index, t := range *a.tokens {
-		if t.Expiry > 0 && t.Expiry < time.Now().Unix() {
-			(*a.tokens) = append((*a.tokens)[:index], (*a.tokens)[index+1:]...)
-			continue
-		}
-		if t.Token == token {
-			return t.Username
-		}
+	if t, ok := c.Get(tokenKey); ok {
+		return t.(*service.ApiToken).Username
 	}
 	return ""
 }
 
 func (a *APIv2Handler) checkToken(c *gin.Context) {
-	username := a.findUsername(c)
-	if username != "" {
-		c.Next()
+	ip := getRemoteIp(c)
+	t := a.ApiService.UserService.FindToken(c.Request.Header.Get("Token"))
+	if t == nil {
+		a.LoginGuardService.Failed(ip, "")
+		jsonMsg(c, "", common.NewError("invalid token"))
+		c.Abort()
+		return
+	}
+	if !t.Allow() {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"msg":     "rate limit of the token exceeded, try again later",
+			"obj":     nil,
+		})
 		return
 	}
-	jsonMsg(c, "", common.NewError("invalid token"))
-	c.Abort()
+	t.Touch(ip)
+	acc := &access{permissions: t.Permissions}
+	if len(t.Groups) > 0 {
+		acc.groups = t.Groups
+	}
+	c.Set(tokenKey, t)
+	c.Set(accessKey, acc)
+	c.Next()
 }
 
 func (a *APIv2Handler) ReloadTokens() {
-	tokens, err := a.ApiService.LoadTokens()
-	if err == nil {
-		var newTokens []TokenInMemory
-		err = json.Unmarshal(tokens, &newTokens)
-		if err != nil {
-			logger.Error("unable to load tokens: ", err)
-		}
-		a.tokens = &newTokens
-	} else {
+	err := a.ApiService.UserService.LoadTokens()
+	if err != nil {
 		logger.Error("unable to load tokens: ", err)
 	}
 }
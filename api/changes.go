@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+
+	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actorOf returns the admin of a request, the owner of the token for /apiv2.
+func actorOf(c *gin.Context) string {
+	if t, ok := c.Get(tokenKey); ok {
+		return t.(*service.ApiToken).Username
+	}
+	return GetLoginUser(c)
+}
+
+// changeSnapshot returns the state of an object for the change log, taken
+// before it is changed.
+func changeSnapshot(key string, id uint) json.RawMessage {
+	var configService service.ConfigService
+	return configService.Snapshot(key, id)
+}
+
+// recordChange writes a change of an object saved outside ConfigService.Save
+// to the change log.
+func recordChange(c *gin.Context, key string, act string, id uint, before json.RawMessage) {
+	var configService service.ConfigService
+	configService.RecordChange(key, act, actorOf(c), id, before)
+}
+
+// GetChange retrieves a change with its snapshots and their differences.
+func (a *ApiService) GetChange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	change, diff, err := a.ConfigService.GetChange(id)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	acc := getAccess(c)
+	if slices.Contains(hiddenChangeKeys(acc), change.Key) {
+		jsonMsg(c, "", common.NewErrorf("permission denied, %s is required", secretChangePermissions[change.Key]))
+		return
+	}
+	if acc != nil && acc.groups != nil {
+		if err := a.ClientService.CheckChangeGroups(change, acc.groups); err != nil {
+			jsonMsg(c, "", err)
+			return
+		}
+	}
+	jsonObj(c, map[string]interface{}{"change": change, "diff": diff}, nil)
+}
+
+// Revert restores the state from before a change, it needs the permission of
+// the changed object. Tokens limited to client groups may only revert changes
+// of their clients.
+func (a *ApiService) Revert(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Request.FormValue("id"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "revert", err)
+		return
+	}
+	if acc := getAccess(c); acc != nil {
+		change, _, err := a.ConfigService.GetChange(id)
+		if err != nil {
+			jsonMsg(c, "revert", err)
+			return
+		}
+		if permission := changePermission(change.Key); !acc.can(permission) {
+			jsonMsg(c, "revert", common.NewErrorf("permission denied, %s is required", permission))
+			return
+		}
+		if acc.groups != nil {
+			if err := a.ClientService.CheckChangeGroups(change, acc.groups); err != nil {
+				jsonMsg(c, "revert", err)
+				return
+			}
+		}
+	}
+	objs, err := a.ConfigService.Revert(id, actorOf(c), getHostname(c))
+	if err != nil {
+		jsonMsg(c, "revert", err)
+		return
+	}
+	err = a.LoadPartialData(c, objs)
+	if err != nil {
+		jsonMsg(c, "revert", err)
+	}
+}
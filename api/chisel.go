@@ -26,6 +26,7 @@ func (a *APIv2Handler) createChiselConfig(c *gin.Context) {
 		jsonMsg(c, "Failed to create chisel config", err)
 		return
 	}
+	recordChange(c, "chisel", "new", config.ID, nil)
 	jsonMsg(c, "Chisel config created successfully", nil)
 }
 
@@ -55,10 +56,12 @@ func (a *APIv2Handler) updateChiselConfig(c *gin.Context) {
 		return
 	}
 	config.ID = uint(id)
+	before := changeSnapshot("chisel", config.ID)
 	if err := a.ChiselService.UpdateChiselConfig(&config); err != nil {
 		jsonMsg(c, "Failed to update chisel config", err)
 		return
 	}
+	recordChange(c, "chisel", "update", config.ID, before)
 	jsonMsg(c, "Chisel config updated successfully", nil)
 }
 
@@ -68,10 +71,12 @@ func (a *APIv2Handler) deleteChiselConfig(c *gin.Context) {
 		jsonMsg(c, "Invalid chisel config ID", err)
 		return
 	}
+	before := changeSnapshot("chisel", uint(id))
 	if err := a.ChiselService.DeleteChiselConfig(uint(id)); err != nil {
 		jsonMsg(c, "Failed to delete chisel config", err)
 		return
 	}
+	recordChange(c, "chisel", "del", uint(id), before)
 	jsonMsg(c, "Chisel config deleted successfully", nil)
 }
 
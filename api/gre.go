@@ -69,6 +69,7 @@ func (a *GreAPI) createGreTunnel(c *gin.Context) {
 		jsonMsg(c, "Failed to create GRE tunnel", err)
 		return
 	}
+	recordChange(c, service.ChangeGre, "new", config.ID, nil)
 
 	jsonMsg(c, "GRE tunnel created successfully", nil)
 }
@@ -92,10 +93,12 @@ func (a *GreAPI) deleteGreTunnel(c *gin.Context) {
 
 	// NOTE: This operation requires root privileges.
 	// The application must be run as root for this to succeed.
+	before := changeSnapshot(service.ChangeGre, uint(id))
 	if err := a.greService.DeleteGreTunnel(uint(id)); err != nil {
 		jsonMsg(c, "Failed to delete GRE tunnel", err)
 		return
 	}
+	recordChange(c, service.ChangeGre, "del", uint(id), before)
 
 	jsonMsg(c, "GRE tunnel deleted successfully", nil)
 }
@@ -71,6 +71,7 @@ func (a *MTProtoAPI) createMTProtoProxy(c *gin.Context) {
 		jsonMsg(c, "Failed to create MTProto Proxy", err)
 		return
 	}
+	recordChange(c, service.ChangeMTProto, "new", config.ID, nil)
 	jsonMsg(c, "MTProto Proxy created successfully", nil)
 }
 
@@ -122,10 +123,12 @@ func (a *MTProtoAPI) updateMTProtoProxy(c *gin.Context) {
 		return
 	}
 	config.ID = uint(id)
+	before := changeSnapshot(service.ChangeMTProto, config.ID)
 	if err := a.mtprotoService.UpdateMTProtoProxy(&config); err != nil {
 		jsonMsg(c, "Failed to update MTProto Proxy", err)
 		return
 	}
+	recordChange(c, service.ChangeMTProto, "edit", config.ID, before)
 	jsonMsg(c, "MTProto Proxy updated successfully", nil)
 }
 
@@ -145,10 +148,12 @@ func (a *MTProtoAPI) deleteMTProtoProxy(c *gin.Context) {
 		jsonMsg(c, "Invalid MTProto Proxy ID", err)
 		return
 	}
+	before := changeSnapshot(service.ChangeMTProto, uint(id))
 	if err := a.mtprotoService.DeleteMTProtoProxy(uint(id)); err != nil {
 		jsonMsg(c, "Failed to delete MTProto Proxy", err)
 		return
 	}
+	recordChange(c, service.ChangeMTProto, "del", uint(id), before)
 	jsonMsg(c, "MTProto Proxy deleted successfully", nil)
 }
 
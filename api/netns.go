@@ -0,0 +1,125 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+// NetnsAPI handles API requests for network namespaces. Namespaces and veth
+// pairs exist only in the kernel, so they are not in the change log.
+type NetnsAPI struct {
+	netnsService *service.NetnsService
+}
+
+// NewNetnsAPI creates a new instance of NetnsAPI.
+func NewNetnsAPI() *NetnsAPI {
+	return &NetnsAPI{
+		netnsService: service.NewNetnsService(),
+	}
+}
+
+// RegisterRoutes registers the API routes for network namespaces.
+func (a *NetnsAPI) RegisterRoutes(router *gin.RouterGroup) {
+	netnsGroup := router.Group("/netns")
+	netnsGroup.GET("", a.getNamespaces)
+	netnsGroup.POST("", a.createNamespace)
+	netnsGroup.DELETE("/:name", a.deleteNamespace)
+	netnsGroup.POST("/veth", a.createVethPair)
+}
+
+// getNamespaces godoc
+// @Summary Get all network namespaces
+// @Description Retrieves the names of all named network namespaces.
+// @Tags Netns
+// @Produce json
+// @Success 200 {array} string
+// @Failure 500 {object} object{message=string}
+// @Router /netns [get]
+func (a *NetnsAPI) getNamespaces(c *gin.Context) {
+	names, err := a.netnsService.ListNamespaces()
+	if err != nil {
+		jsonMsg(c, "Failed to get network namespaces", err)
+		return
+	}
+	jsonObj(c, names, nil)
+}
+
+// createNamespace godoc
+// @Summary Create a network namespace
+// @Description Creates a named network namespace unless it already exists. Requires root privileges.
+// @Tags Netns
+// @Accept json
+// @Produce json
+// @Param namespace body object{name=string} true "Namespace"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /netns [post]
+func (a *NetnsAPI) createNamespace(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonMsg(c, "Invalid network namespace", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.netnsService.EnsureNamespace(req.Name); err != nil {
+		jsonMsg(c, "Failed to create network namespace", err)
+		return
+	}
+	jsonMsg(c, "Network namespace created successfully", nil)
+}
+
+// deleteNamespace godoc
+// @Summary Delete a network namespace
+// @Description Deletes a named network namespace together with the links inside it. Requires root privileges.
+// @Tags Netns
+// @Produce json
+// @Param name path string true "Namespace Name"
+// @Success 200 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /netns/{name} [delete]
+func (a *NetnsAPI) deleteNamespace(c *gin.Context) {
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.netnsService.DeleteNamespace(c.Param("name")); err != nil {
+		jsonMsg(c, "Failed to delete network namespace", err)
+		return
+	}
+	jsonMsg(c, "Network namespace deleted successfully", nil)
+}
+
+// createVethPair godoc
+// @Summary Create a veth pair
+// @Description Connects two network namespaces with a veth pair. An empty namespace refers to the host. Requires root privileges.
+// @Tags Netns
+// @Accept json
+// @Produce json
+// @Param veth body object{name=string,namespace=string,peer_name=string,peer_namespace=string} true "Veth Pair"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /netns/veth [post]
+func (a *NetnsAPI) createVethPair(c *gin.Context) {
+	var req struct {
+		Name          string `json:"name" binding:"required"`
+		Namespace     string `json:"namespace"`
+		PeerName      string `json:"peer_name" binding:"required"`
+		PeerNamespace string `json:"peer_namespace"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		jsonMsg(c, "Invalid veth pair", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.netnsService.CreateVethPair(req.Name, req.Namespace, req.PeerName, req.PeerNamespace); err != nil {
+		jsonMsg(c, "Failed to create veth pair", err)
+		return
+	}
+	jsonMsg(c, "Veth pair created successfully", nil)
+}
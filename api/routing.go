@@ -0,0 +1,240 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+// RoutingAPI handles API requests for static routes, route tables and policy rules.
+type RoutingAPI struct {
+	routingService *service.RoutingService
+}
+
+// NewRoutingAPI creates a new instance of RoutingAPI.
+func NewRoutingAPI() *RoutingAPI {
+	return &RoutingAPI{
+		routingService: service.NewRoutingService(),
+	}
+}
+
+// RegisterRoutes registers the API routes for the routing subsystem.
+func (a *RoutingAPI) RegisterRoutes(router *gin.RouterGroup) {
+	routingGroup := router.Group("/routing")
+	routingGroup.GET("/tables", a.getRouteTables)
+	routingGroup.POST("/tables", a.createRouteTable)
+	routingGroup.DELETE("/tables/:id", a.deleteRouteTable)
+	routingGroup.GET("/routes", a.getRoutes)
+	routingGroup.POST("/routes", a.createRoute)
+	routingGroup.DELETE("/routes/:id", a.deleteRoute)
+	routingGroup.GET("/rules", a.getRouteRules)
+	routingGroup.POST("/rules", a.createRouteRule)
+	routingGroup.DELETE("/rules/:id", a.deleteRouteRule)
+}
+
+// getRouteTables godoc
+// @Summary Get all route tables
+// @Description Retrieves a list of all custom route tables.
+// @Tags Routing
+// @Produce json
+// @Success 200 {array} model.RouteTable
+// @Failure 500 {object} object{message=string}
+// @Router /routing/tables [get]
+func (a *RoutingAPI) getRouteTables(c *gin.Context) {
+	tables, err := a.routingService.GetAllRouteTables()
+	if err != nil {
+		jsonMsg(c, "Failed to get route tables", err)
+		return
+	}
+	jsonObj(c, tables, nil)
+}
+
+// createRouteTable godoc
+// @Summary Create a route table
+// @Description Registers a custom route table which routes and rules can refer to.
+// @Tags Routing
+// @Accept json
+// @Produce json
+// @Param table body model.RouteTable true "Route Table"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Router /routing/tables [post]
+func (a *RoutingAPI) createRouteTable(c *gin.Context) {
+	var table model.RouteTable
+	if err := c.ShouldBindJSON(&table); err != nil {
+		jsonMsg(c, "Invalid route table", err)
+		return
+	}
+	if err := a.routingService.CreateRouteTable(&table); err != nil {
+		jsonMsg(c, "Failed to create route table", err)
+		return
+	}
+	recordChange(c, service.ChangeRouteTable, "new", table.ID, nil)
+	jsonMsg(c, "Route table created successfully", nil)
+}
+
+// deleteRouteTable godoc
+// @Summary Delete a route table
+// @Description Deletes a custom route table which is no longer used by any route or rule.
+// @Tags Routing
+// @Produce json
+// @Param id path int true "Table ID"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Router /routing/tables/{id} [delete]
+func (a *RoutingAPI) deleteRouteTable(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid route table ID", err)
+		return
+	}
+	before := changeSnapshot(service.ChangeRouteTable, uint(id))
+	if err := a.routingService.DeleteRouteTable(uint(id)); err != nil {
+		jsonMsg(c, "Failed to delete route table", err)
+		return
+	}
+	recordChange(c, service.ChangeRouteTable, "del", uint(id), before)
+	jsonMsg(c, "Route table deleted successfully", nil)
+}
+
+// getRoutes godoc
+// @Summary Get all static routes
+// @Description Retrieves a list of all managed static routes.
+// @Tags Routing
+// @Produce json
+// @Success 200 {array} model.Route
+// @Failure 500 {object} object{message=string}
+// @Router /routing/routes [get]
+func (a *RoutingAPI) getRoutes(c *gin.Context) {
+	routes, err := a.routingService.GetAllRoutes()
+	if err != nil {
+		jsonMsg(c, "Failed to get routes", err)
+		return
+	}
+	jsonObj(c, routes, nil)
+}
+
+// createRoute godoc
+// @Summary Create a static route
+// @Description Creates a static route, optionally tied to a tunnel interface. Requires root privileges.
+// @Tags Routing
+// @Accept json
+// @Produce json
+// @Param route body model.Route true "Route"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /routing/routes [post]
+func (a *RoutingAPI) createRoute(c *gin.Context) {
+	var route model.Route
+	if err := c.ShouldBindJSON(&route); err != nil {
+		jsonMsg(c, "Invalid route", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.routingService.CreateRoute(&route); err != nil {
+		jsonMsg(c, "Failed to create route", err)
+		return
+	}
+	recordChange(c, service.ChangeRoute, "new", route.ID, nil)
+	jsonMsg(c, "Route created successfully", nil)
+}
+
+// deleteRoute godoc
+// @Summary Delete a static route
+// @Description Removes a static route from the kernel and the database. Requires root privileges.
+// @Tags Routing
+// @Produce json
+// @Param id path int true "Route ID"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /routing/routes/{id} [delete]
+func (a *RoutingAPI) deleteRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid route ID", err)
+		return
+	}
+	before := changeSnapshot(service.ChangeRoute, uint(id))
+	if err := a.routingService.DeleteRoute(uint(id)); err != nil {
+		jsonMsg(c, "Failed to delete route", err)
+		return
+	}
+	recordChange(c, service.ChangeRoute, "del", uint(id), before)
+	jsonMsg(c, "Route deleted successfully", nil)
+}
+
+// getRouteRules godoc
+// @Summary Get all policy rules
+// @Description Retrieves a list of all managed policy routing rules.
+// @Tags Routing
+// @Produce json
+// @Success 200 {array} model.RouteRule
+// @Failure 500 {object} object{message=string}
+// @Router /routing/rules [get]
+func (a *RoutingAPI) getRouteRules(c *gin.Context) {
+	rules, err := a.routingService.GetAllRouteRules()
+	if err != nil {
+		jsonMsg(c, "Failed to get rules", err)
+		return
+	}
+	jsonObj(c, rules, nil)
+}
+
+// createRouteRule godoc
+// @Summary Create a policy rule
+// @Description Creates a policy routing rule matching by source, destination, fwmark or incoming interface. Requires root privileges.
+// @Tags Routing
+// @Accept json
+// @Produce json
+// @Param rule body model.RouteRule true "Policy Rule"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /routing/rules [post]
+func (a *RoutingAPI) createRouteRule(c *gin.Context) {
+	var rule model.RouteRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		jsonMsg(c, "Invalid rule", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.routingService.CreateRouteRule(&rule); err != nil {
+		jsonMsg(c, "Failed to create rule", err)
+		return
+	}
+	recordChange(c, service.ChangeRule, "new", rule.ID, nil)
+	jsonMsg(c, "Rule created successfully", nil)
+}
+
+// deleteRouteRule godoc
+// @Summary Delete a policy rule
+// @Description Removes a policy routing rule from the kernel and the database. Requires root privileges.
+// @Tags Routing
+// @Produce json
+// @Param id path int true "Rule ID"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /routing/rules/{id} [delete]
+func (a *RoutingAPI) deleteRouteRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid rule ID", err)
+		return
+	}
+	before := changeSnapshot(service.ChangeRule, uint(id))
+	if err := a.routingService.DeleteRouteRule(uint(id)); err != nil {
+		jsonMsg(c, "Failed to delete rule", err)
+		return
+	}
+	recordChange(c, service.ChangeRule, "del", uint(id), before)
+	jsonMsg(c, "Rule deleted successfully", nil)
+}
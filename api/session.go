@@ -10,7 +10,8 @@ import (
 )
 
 const (
-	loginUser = "LOGIN_USER"
+	loginUser    = "LOGIN_USER"
+	pendingLogin = "PENDING_LOGIN"
 )
 
 func init() {
@@ -28,11 +29,29 @@ func SetLoginUser(c *gin.Context, userName string, maxAge int) error {
 
 	s := sessions.Default(c)
 	s.Set(loginUser, userName)
+	s.Delete(pendingLogin)
 	s.Options(options)
 
 	return s.Save()
 }
 
+// SetPendingLogin keeps the ID of a login waiting for its second factor.
+func SetPendingLogin(c *gin.Context, id string) error {
+	s := sessions.Default(c)
+	s.Delete(loginUser)
+	s.Set(pendingLogin, id)
+	s.Options(sessions.Options{
+		Path: "/",
+	})
+	return s.Save()
+}
+
+func GetPendingLogin(c *gin.Context) string {
+	s := sessions.Default(c)
+	id, _ := s.Get(pendingLogin).(string)
+	return id
+}
+
 func SetMaxAge(c *gin.Context) error {
 	s := sessions.Default(c)
 	s.Options(sessions.Options{
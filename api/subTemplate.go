@@ -0,0 +1,134 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+// SubTemplateAPI handles API requests for subscription templates.
+type SubTemplateAPI struct {
+	subTemplateService *service.SubTemplateService
+}
+
+// NewSubTemplateAPI creates a new instance of SubTemplateAPI.
+func NewSubTemplateAPI() *SubTemplateAPI {
+	return &SubTemplateAPI{
+		subTemplateService: &service.SubTemplateService{},
+	}
+}
+
+// RegisterRoutes registers the API routes for subscription templates.
+func (a *SubTemplateAPI) RegisterRoutes(router *gin.RouterGroup) {
+	templateGroup := router.Group("/subtemplates")
+	templateGroup.GET("", a.getTemplates)
+	templateGroup.POST("", a.createTemplate)
+	templateGroup.PUT("/:id", a.updateTemplate)
+	templateGroup.DELETE("/:id", a.deleteTemplate)
+}
+
+// getTemplates godoc
+// @Summary Get all subscription templates
+// @Description Retrieves all subscription templates.
+// @Tags SubTemplates
+// @Produce json
+// @Success 200 {array} model.SubTemplate
+// @Failure 500 {object} object{message=string}
+// @Router /subtemplates [get]
+func (a *SubTemplateAPI) getTemplates(c *gin.Context) {
+	templates, err := a.subTemplateService.GetAll()
+	if err != nil {
+		jsonMsg(c, "Failed to get subscription templates", err)
+		return
+	}
+	jsonObj(c, templates, nil)
+}
+
+// createTemplate godoc
+// @Summary Create a subscription template
+// @Description Creates a subscription template for all clients or for the given client names or groups.
+// @Tags SubTemplates
+// @Accept json
+// @Produce json
+// @Param template body model.SubTemplate true "Subscription Template"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /subtemplates [post]
+func (a *SubTemplateAPI) createTemplate(c *gin.Context) {
+	var template model.SubTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		jsonMsg(c, "Invalid subscription template", err)
+		return
+	}
+	template.Id = 0
+	if err := a.subTemplateService.Save(&template); err != nil {
+		jsonMsg(c, "Failed to create subscription template", err)
+		return
+	}
+	recordChange(c, service.ChangeSubTemplate, "new", template.Id, nil)
+	jsonObj(c, template, nil)
+}
+
+// updateTemplate godoc
+// @Summary Update a subscription template
+// @Description Replaces a subscription template.
+// @Tags SubTemplates
+// @Accept json
+// @Produce json
+// @Param id path int true "Template ID"
+// @Param template body model.SubTemplate true "Subscription Template"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /subtemplates/{id} [put]
+func (a *SubTemplateAPI) updateTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid subscription template ID", err)
+		return
+	}
+	if _, err := a.subTemplateService.Get(uint(id)); err != nil {
+		jsonMsg(c, "Subscription template not found", err)
+		return
+	}
+	var template model.SubTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		jsonMsg(c, "Invalid subscription template", err)
+		return
+	}
+	template.Id = uint(id)
+	before := changeSnapshot(service.ChangeSubTemplate, template.Id)
+	if err := a.subTemplateService.Save(&template); err != nil {
+		jsonMsg(c, "Failed to update subscription template", err)
+		return
+	}
+	recordChange(c, service.ChangeSubTemplate, "edit", template.Id, before)
+	jsonObj(c, template, nil)
+}
+
+// deleteTemplate godoc
+// @Summary Delete a subscription template
+// @Description Deletes a subscription template by its ID.
+// @Tags SubTemplates
+// @Produce json
+// @Param id path int true "Template ID"
+// @Success 200 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /subtemplates/{id} [delete]
+func (a *SubTemplateAPI) deleteTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid subscription template ID", err)
+		return
+	}
+	before := changeSnapshot(service.ChangeSubTemplate, uint(id))
+	if err := a.subTemplateService.Delete(uint(id)); err != nil {
+		jsonMsg(c, "Failed to delete subscription template", err)
+		return
+	}
+	recordChange(c, service.ChangeSubTemplate, "del", uint(id), before)
+	jsonMsg(c, "Subscription template deleted successfully", nil)
+}
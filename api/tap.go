@@ -69,6 +69,7 @@ func (a *TapAPI) createTapTunnel(c *gin.Context) {
 		jsonMsg(c, "Failed to create TAP tunnel", err)
 		return
 	}
+	recordChange(c, service.ChangeTap, "new", config.ID, nil)
 
 	jsonMsg(c, "TAP tunnel created successfully", nil)
 }
@@ -92,10 +93,12 @@ func (a *TapAPI) deleteTapTunnel(c *gin.Context) {
 
 	// NOTE: This operation requires root privileges.
 	// The application must be run as root for this to succeed.
+	before := changeSnapshot(service.ChangeTap, uint(id))
 	if err := a.tapService.DeleteTapTunnel(uint(id)); err != nil {
 		jsonMsg(c, "Failed to delete TAP tunnel", err)
 		return
 	}
+	recordChange(c, service.ChangeTap, "del", uint(id), before)
 
 	jsonMsg(c, "TAP tunnel deleted successfully", nil)
 }
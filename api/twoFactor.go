@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/middleware"
+	"github.com/igor04091968/sing-chisel-tel/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relyingParty returns the WebAuthn relying party of the panel. It comes from
+// the webURI or webDomain settings, only without both from the host the panel
+// is opened on.
+func relyingParty(c *gin.Context) service.RelyingParty {
+	var settingService service.SettingService
+	if origin, err := settingService.GetWebOrigin(); err != nil {
+		logger.Warning("WebAuthn: ", err)
+	} else if origin != "" {
+		u, _ := url.Parse(origin)
+		return service.RelyingParty{Id: u.Hostname(), Origin: origin}
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || middleware.ProxyHeader(c, "X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return service.RelyingParty{
+		Id:     strings.Trim(getHostname(c), "[]"),
+		Origin: scheme + "://" + c.Request.Host,
+	}
+}
+
+// LoginTotp completes a login with a TOTP or recovery code.
+func (a *ApiService) LoginTotp(c *gin.Context) {
+	username, err := a.TwoFactorService.LoginCode(GetPendingLogin(c), c.Request.FormValue("code"))
+	if err != nil {
+		logger.Warning("2FA login failed: ", err, " IP: ", getRemoteIp(c))
+		jsonMsg(c, "", err)
+		return
+	}
+	a.completeLogin(c, username)
+}
+
+// LoginWebAuthnBegin returns the WebAuthn challenge of a pending login.
+func (a *ApiService) LoginWebAuthnBegin(c *gin.Context) {
+	assertion, err := a.TwoFactorService.LoginWebAuthnBegin(GetPendingLogin(c), relyingParty(c))
+	jsonObj(c, assertion, err)
+}
+
+// LoginWebAuthn completes a login with the WebAuthn assertion in the body.
+func (a *ApiService) LoginWebAuthn(c *gin.Context) {
+	username, err := a.TwoFactorService.LoginWebAuthn(GetPendingLogin(c), relyingParty(c), c.Request)
+	if err != nil {
+		logger.Warning("WebAuthn login failed: ", err, " IP: ", getRemoteIp(c))
+		jsonMsg(c, "", err)
+		return
+	}
+	a.completeLogin(c, username)
+}
+
+// LoginTelegram asks the Telegram admins to approve a login, the browser
+// calls it again until they answered.
+func (a *ApiService) LoginTelegram(c *gin.Context) {
+	username, done, err := a.TwoFactorService.LoginTelegram(GetPendingLogin(c))
+	if err != nil || !done {
+		jsonObj(c, map[string]interface{}{"pending": !done}, err)
+		return
+	}
+	a.completeLogin(c, username)
+}
+
+// GetTwoFactor returns the second factors of the logged in user.
+func (a *ApiService) GetTwoFactor(c *gin.Context) {
+	status, err := a.TwoFactorService.GetStatus(GetLoginUser(c))
+	jsonObj(c, status, err)
+}
+
+// TotpSetup starts the TOTP enrollment and returns the otpauth:// URL.
+func (a *ApiService) TotpSetup(c *gin.Context) {
+	url, err := a.TwoFactorService.TotpSetup(GetLoginUser(c))
+	jsonObj(c, url, err)
+}
+
+// TotpEnable confirms the TOTP enrollment and returns the recovery codes.
+func (a *ApiService) TotpEnable(c *gin.Context) {
+	codes, err := a.TwoFactorService.TotpEnable(GetLoginUser(c), c.Request.FormValue("code"))
+	jsonObj(c, codes, err)
+}
+
+// TotpDisable turns TOTP off.
+func (a *ApiService) TotpDisable(c *gin.Context) {
+	err := a.TwoFactorService.TotpDisable(GetLoginUser(c), c.Request.FormValue("code"))
+	jsonMsg(c, "", err)
+}
+
+// WebAuthnRegisterBegin returns the options to create a WebAuthn credential.
+func (a *ApiService) WebAuthnRegisterBegin(c *gin.Context) {
+	creation, err := a.TwoFactorService.WebAuthnBeginRegistration(GetLoginUser(c), relyingParty(c))
+	jsonObj(c, creation, err)
+}
+
+// WebAuthnRegister stores the credential in the body, named by the name query.
+func (a *ApiService) WebAuthnRegister(c *gin.Context) {
+	err := a.TwoFactorService.WebAuthnFinishRegistration(GetLoginUser(c), c.Query("name"), relyingParty(c), c.Request)
+	jsonMsg(c, "", err)
+}
+
+// WebAuthnDelete removes a WebAuthn credential of the logged in user.
+func (a *ApiService) WebAuthnDelete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Request.FormValue("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	err = a.TwoFactorService.WebAuthnDelete(GetLoginUser(c), uint(id))
+	jsonMsg(c, "", err)
+}
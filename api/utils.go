@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,15 +18,7 @@ type Msg struct {
 }
 
 func getRemoteIp(c *gin.Context) string {
-	value := c.GetHeader("X-Forwarded-For")
-	if value != "" {
-		ips := strings.Split(value, ",")
-		return ips[0]
-	} else {
-		addr := c.Request.RemoteAddr
-		ip, _, _ := net.SplitHostPort(addr)
-		return ip
-	}
+	return middleware.ClientIP(c)
 }
 
 func getHostname(c *gin.Context) string {
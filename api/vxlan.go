@@ -0,0 +1,174 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+// VxlanAPI handles API requests for VXLAN and GENEVE overlay tunnels.
+type VxlanAPI struct {
+	vxlanService *service.VxlanService
+}
+
+// NewVxlanAPI creates a new instance of VxlanAPI.
+func NewVxlanAPI() *VxlanAPI {
+	return &VxlanAPI{
+		vxlanService: service.NewVxlanService(),
+	}
+}
+
+// RegisterRoutes registers the API routes for overlay tunnels.
+func (a *VxlanAPI) RegisterRoutes(router *gin.RouterGroup) {
+	vxlanGroup := router.Group("/vxlan")
+	vxlanGroup.GET("", a.getVxlanTunnels)
+	vxlanGroup.POST("", a.createVxlanTunnel)
+	vxlanGroup.DELETE("/:id", a.deleteVxlanTunnel)
+	vxlanGroup.POST("/:id/fdb", a.addFdbEntry)
+	vxlanGroup.DELETE("/:id/fdb", a.deleteFdbEntry)
+}
+
+// getVxlanTunnels godoc
+// @Summary Get all overlay tunnels
+// @Description Retrieves a list of all configured VXLAN and GENEVE tunnels.
+// @Tags VXLAN
+// @Produce json
+// @Success 200 {array} model.VxlanTunnel
+// @Failure 500 {object} object{message=string}
+// @Router /vxlan [get]
+func (a *VxlanAPI) getVxlanTunnels(c *gin.Context) {
+	configs, err := a.vxlanService.GetAllVxlanTunnels()
+	if err != nil {
+		jsonMsg(c, "Failed to get overlay tunnels", err)
+		return
+	}
+	jsonObj(c, configs, nil)
+}
+
+// createVxlanTunnel godoc
+// @Summary Create an overlay tunnel
+// @Description Creates a new VXLAN or GENEVE interface based on the provided configuration. Requires root privileges.
+// @Tags VXLAN
+// @Accept json
+// @Produce json
+// @Param config body model.VxlanTunnel true "Overlay Tunnel Configuration"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /vxlan [post]
+func (a *VxlanAPI) createVxlanTunnel(c *gin.Context) {
+	var config model.VxlanTunnel
+	if err := c.ShouldBindJSON(&config); err != nil {
+		jsonMsg(c, "Invalid overlay tunnel config", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	if err := a.vxlanService.CreateVxlanTunnel(&config); err != nil {
+		jsonMsg(c, "Failed to create overlay tunnel", err)
+		return
+	}
+	recordChange(c, service.ChangeVxlan, "new", config.ID, nil)
+
+	jsonMsg(c, "Overlay tunnel created successfully", nil)
+}
+
+// deleteVxlanTunnel godoc
+// @Summary Delete an overlay tunnel
+// @Description Deletes a VXLAN or GENEVE interface and its configuration. Requires root privileges.
+// @Tags VXLAN
+// @Produce json
+// @Param id path int true "Tunnel ID"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /vxlan/{id} [delete]
+func (a *VxlanAPI) deleteVxlanTunnel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid overlay tunnel ID", err)
+		return
+	}
+
+	// NOTE: This operation requires root privileges.
+	// The application must be run as root for this to succeed.
+	before := changeSnapshot(service.ChangeVxlan, uint(id))
+	if err := a.vxlanService.DeleteVxlanTunnel(uint(id)); err != nil {
+		jsonMsg(c, "Failed to delete overlay tunnel", err)
+		return
+	}
+	recordChange(c, service.ChangeVxlan, "del", uint(id), before)
+
+	jsonMsg(c, "Overlay tunnel deleted successfully", nil)
+}
+
+// addFdbEntry godoc
+// @Summary Add a static FDB entry
+// @Description Adds a static FDB entry for a unicast peer to a VXLAN tunnel. Requires root privileges.
+// @Tags VXLAN
+// @Accept json
+// @Produce json
+// @Param id path int true "Tunnel ID"
+// @Param entry body model.VxlanFdbEntry true "FDB Entry"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /vxlan/{id}/fdb [post]
+func (a *VxlanAPI) addFdbEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid overlay tunnel ID", err)
+		return
+	}
+	var entry model.VxlanFdbEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		jsonMsg(c, "Invalid FDB entry", err)
+		return
+	}
+
+	before := changeSnapshot(service.ChangeVxlan, uint(id))
+	if err := a.vxlanService.AddVxlanFdbEntry(uint(id), entry); err != nil {
+		jsonMsg(c, "Failed to add FDB entry", err)
+		return
+	}
+	recordChange(c, service.ChangeVxlan, "edit", uint(id), before)
+
+	jsonMsg(c, "FDB entry added successfully", nil)
+}
+
+// deleteFdbEntry godoc
+// @Summary Delete a static FDB entry
+// @Description Removes a static FDB entry from a VXLAN tunnel. Requires root privileges.
+// @Tags VXLAN
+// @Accept json
+// @Produce json
+// @Param id path int true "Tunnel ID"
+// @Param entry body model.VxlanFdbEntry true "FDB Entry"
+// @Success 200 {object} object{message=string}
+// @Failure 400 {object} object{message=string}
+// @Failure 500 {object} object{message=string}
+// @Router /vxlan/{id}/fdb [delete]
+func (a *VxlanAPI) deleteFdbEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		jsonMsg(c, "Invalid overlay tunnel ID", err)
+		return
+	}
+	var entry model.VxlanFdbEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		jsonMsg(c, "Invalid FDB entry", err)
+		return
+	}
+
+	before := changeSnapshot(service.ChangeVxlan, uint(id))
+	if err := a.vxlanService.DeleteVxlanFdbEntry(uint(id), entry); err != nil {
+		jsonMsg(c, "Failed to delete FDB entry", err)
+		return
+	}
+	recordChange(c, service.ChangeVxlan, "edit", uint(id), before)
+
+	jsonMsg(c, "FDB entry deleted successfully", nil)
+}
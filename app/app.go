@@ -1,10 +1,12 @@
 package app
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/igor04091968/sing-chisel-tel/config"
 	"github.com/igor04091968/sing-chisel-tel/core"
@@ -30,18 +32,26 @@ type APP struct {
 	mtprotoService   *service.MTProtoEmbeddedService
 	greService       *service.GreService
 	tapService       *service.TapService
+	vxlanService     *service.VxlanService
+	routingService   *service.RoutingService
 	udpTunnelService *service.UdpTunnelService
 	webServer        *web.Server
 	subServer        *sub.Server
 	cronJob          *cronjob.CronJob
 	logger           *logging.Logger
 	core             *core.Core
-	telegramConfig   *telegram.Config
-	isBotStarted     bool
+	// telegramMu serializes reloads of the bot, so the settings of an older
+	// save can't be applied after those of a newer one
+	telegramMu sync.Mutex
 }
 
 func NewApp() *APP {
-	return &APP{}
+	a := &APP{}
+	// The bot follows its settings without a restart
+	service.OnSettingsChanged(func() {
+		go a.reloadTelegram()
+	})
+	return a
 }
 
 func (a *APP) Init() error {
@@ -54,10 +64,14 @@ func (a *APP) Init() error {
 		return err
 	}
 
-	a.initTelegramConfig()
-
 	// Init Setting
 	a.SettingService.GetAllSetting()
+	a.SettingService.LoadAlertSinks()
+	var clientService service.ClientService
+	if err := clientService.InitSubTokens(); err != nil {
+		logger.Warning("unable to generate subscription tokens: ", err)
+	}
+	a.migrateTelegramConfig()
 
 	a.core = core.NewCore()
 
@@ -70,8 +84,16 @@ func (a *APP) Init() error {
 	a.mtprotoService = service.NewMTProtoEmbeddedService()
 	a.greService = service.NewGreService()
 	a.tapService = service.NewTapService()
+	a.vxlanService = service.NewVxlanService()
+	a.routingService = service.NewRoutingService()
 	a.udpTunnelService = service.NewUdpTunnelService(database.GetDB())
 	a.configService = service.NewConfigService(a.core, a.chiselService)
+	a.configService.Gost = a.gostService
+	a.configService.Gre = a.greService
+	a.configService.Tap = a.tapService
+	a.configService.Vxlan = a.vxlanService
+	a.configService.Routing = a.routingService
+	a.configService.UdpTunnel = a.udpTunnelService
 
 	// Initialize lightweight services that don't have complex constructors
 	a.statsService = &service.StatsService{}
@@ -93,8 +115,11 @@ func (a *APP) Init() error {
 			ServerService:    *a.serverService,
 			ChiselService:    a.chiselService,
 			GostService:      a.gostService,
+			GreService:       a.greService,
 			TapService:       a.tapService,
 			UdpTunnelService: a.udpTunnelService,
+			VxlanService:     a.vxlanService,
+			RoutingService:   a.routingService,
 		}
 		a.webServer.SetServicesBundle(bundle)
 	}
@@ -164,10 +189,7 @@ func (a *APP) Start() error {
 		logger.Error(err)
 	}
 
-	if a.telegramConfig != nil && a.telegramConfig.Enabled && !a.isBotStarted {
-		go telegram.Start(context.Background(), a.telegramConfig, a)
-		a.isBotStarted = true
-	}
+	go a.reloadTelegram()
 
 	// --- Auto-start all Chisel clients ---
 	allChiselConfigs, err := a.chiselService.GetAllChiselConfigs()
@@ -201,6 +223,9 @@ func (a *APP) Start() error {
 			}
 		}
 	}
+	// --- Install static routes and policy rules ---
+	a.routingService.ApplyStaticRoutes()
+
 	// --- Auto-start UDP Tunnels ---
 	a.udpTunnelService.AutoStartUdpTunnels()
 	// --- End auto-start UDP Tunnels ---
@@ -224,6 +249,7 @@ func (a *APP) Stop() {
 	}
 
 	a.chiselService.StopAllActiveChiselServices()
+	telegram.Stop()
 }
 
 func (a *APP) initLog() {
@@ -241,23 +267,75 @@ func (a *APP) initLog() {
 	}
 }
 
-func (a *APP) initTelegramConfig() {
-	file, err := os.ReadFile("telegram_config.json")
+// migrateTelegramConfig moves a legacy telegram_config.json into the settings.
+func (a *APP) migrateTelegramConfig() {
+	const configFile = "telegram_config.json"
+	file, err := os.ReadFile(configFile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			logger.Info("telegram_config.json not found, Telegram bot is disabled.")
-			return
+		if !os.IsNotExist(err) {
+			logger.Warning("Error reading ", configFile, ": ", err)
 		}
-		logger.Warning("Error reading telegram_config.json:", err)
+		return
+	}
+
+	token, err := a.SettingService.GetTgBotToken()
+	if err != nil || token != "" {
+		logger.Info(configFile, " is ignored, the Telegram bot is configured in the settings.")
 		return
 	}
 
 	var cfg telegram.Config
 	if err := json.Unmarshal(file, &cfg); err != nil {
-		logger.Warning("Error unmarshalling telegram_config.json:", err)
+		logger.Warning("Error unmarshalling ", configFile, ": ", err)
 		return
 	}
-	a.telegramConfig = &cfg
+	adminIds := make([]string, len(cfg.AdminUserIDs))
+	for i, id := range cfg.AdminUserIDs {
+		adminIds[i] = strconv.FormatInt(id, 10)
+	}
+	settings := map[string]string{
+		"tgEnable":     strconv.FormatBool(cfg.Enabled),
+		"tgBotToken":   cfg.BotToken,
+		"tgAdminIds":   strings.Join(adminIds, ","),
+		"tgClientMode": strconv.FormatBool(cfg.ClientMode),
+		"tgProxy":      cfg.Proxy,
+	}
+	if len(cfg.WarnVolumePercent) > 0 {
+		settings["tgWarnVolume"] = joinInts(cfg.WarnVolumePercent)
+	}
+	if len(cfg.WarnDays) > 0 {
+		settings["tgWarnDays"] = joinInts(cfg.WarnDays)
+	}
+	data, _ := json.Marshal(settings)
+	if err := a.SettingService.Save(database.GetDB(), data); err != nil {
+		logger.Warning("Error migrating ", configFile, ": ", err)
+		return
+	}
+	if err := os.Rename(configFile, configFile+".migrated"); err != nil {
+		logger.Warning("Error renaming ", configFile, ": ", err)
+	}
+	logger.Info(configFile, " has been migrated to the settings.")
+}
+
+func (a *APP) reloadTelegram() {
+	a.telegramMu.Lock()
+	defer a.telegramMu.Unlock()
+
+	cfg, err := telegram.LoadConfig(&a.SettingService)
+	if err == nil {
+		err = telegram.Apply(cfg, a)
+	}
+	if err != nil {
+		logger.Warning("Telegram bot: ", err)
+	}
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
 }
 
 func (a *APP) RestartApp() {
@@ -338,6 +416,18 @@ func (a *APP) GetTapService() *service.TapService {
 	return a.tapService
 }
 
+func (a *APP) GetTgBindingService() *service.TgBindingService {
+	return &service.TgBindingService{}
+}
+
+func (a *APP) GetVxlanService() *service.VxlanService {
+	return a.vxlanService
+}
+
+func (a *APP) GetRoutingService() *service.RoutingService {
+	return a.routingService
+}
+
 func (a *APP) GetGostService() *service.GostService {
 	return a.gostService
 }
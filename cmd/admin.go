@@ -6,6 +6,7 @@ import (
 	"github.com/igor04091968/sing-chisel-tel/config"
 	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/util"
 )
 
 func resetAdmin() {
@@ -53,12 +54,84 @@ func showAdmin() {
 	if err != nil {
 		fmt.Println("get current user info failed,error info:", err)
 	}
-	username := userModel.Username
-	userpasswd := userModel.Password
-	if (username == "") || (userpasswd == "") {
-		fmt.Println("current username or password is empty")
+	if userModel == nil {
+		return
 	}
 	fmt.Println("First admin credentials:")
-	fmt.Println("\tUsername:\t", username)
-	fmt.Println("\tPassword:\t", userpasswd)
+	fmt.Println("\tUsername:\t", userModel.Username)
+	if util.IsPasswordHash(userModel.Password) {
+		fmt.Println("\tPassword:\t stored as hash, use -reset or -password to set a new one")
+	} else {
+		fmt.Println("\tPassword:\t stored in plaintext, it is hashed on the next login or by `migrate`")
+	}
+	if userModel.TotpEnabled {
+		fmt.Println("\t2FA:\t\t TOTP enabled, use -reset2fa to remove all second factors")
+	}
+}
+
+// adminName returns the admin selected by -username, the first admin if it is empty.
+func adminName(username string) (string, error) {
+	if username != "" {
+		return username, nil
+	}
+	userService := service.UserService{}
+	userModel, err := userService.GetFirstUser()
+	if err != nil {
+		return "", err
+	}
+	return userModel.Username, nil
+}
+
+func enrollTotp(username string) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	username, err = adminName(username)
+	if err != nil {
+		fmt.Println("get current user info failed,error info:", err)
+		return
+	}
+
+	twoFactorService := service.TwoFactorService{}
+	url, err := twoFactorService.TotpSetup(username)
+	if err != nil {
+		fmt.Println("TOTP setup failed:", err)
+		return
+	}
+	fmt.Println("Add this URL to your authenticator app:")
+	fmt.Println("\t", url)
+	fmt.Print("Enter the code shown by the app: ")
+	var code string
+	fmt.Scanln(&code)
+	codes, err := twoFactorService.TotpEnable(username, code)
+	if err != nil {
+		fmt.Println("TOTP setup failed:", err)
+		return
+	}
+	fmt.Println("TOTP enabled, keep these recovery codes in a safe place:")
+	for _, c := range codes {
+		fmt.Println("\t", c)
+	}
+}
+
+func resetAdmin2fa(username string) {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	username, err = adminName(username)
+	if err != nil {
+		fmt.Println("get current user info failed,error info:", err)
+		return
+	}
+	twoFactorService := service.TwoFactorService{}
+	err = twoFactorService.Reset(username)
+	if err != nil {
+		fmt.Println("reset 2FA of", username, "failed:", err)
+	} else {
+		fmt.Println("reset 2FA of", username, "success")
+	}
 }
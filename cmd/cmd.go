@@ -25,6 +25,8 @@ func ParseCmd() {
 	var subPath string
 	var reset bool
 	var show bool
+	var totp bool
+	var reset2fa bool
 	settingCmd.BoolVar(&reset, "reset", false, "reset all settings")
 	settingCmd.BoolVar(&show, "show", false, "show current settings")
 	settingCmd.IntVar(&port, "port", 0, "set panel port")
@@ -34,8 +36,10 @@ func ParseCmd() {
 
 	adminCmd.BoolVar(&show, "show", false, "show first admin credentials")
 	adminCmd.BoolVar(&reset, "reset", false, "reset first admin credentials")
-	adminCmd.StringVar(&username, "username", "", "set login username")
+	adminCmd.StringVar(&username, "username", "", "set login username, or select the admin of -totp and -reset2fa")
 	adminCmd.StringVar(&password, "password", "", "set login password")
+	adminCmd.BoolVar(&totp, "totp", false, "enable TOTP for an admin, the first one without -username")
+	adminCmd.BoolVar(&reset2fa, "reset2fa", false, "remove TOTP and WebAuthn of an admin, the first one without -username")
 
 	oldUsage := flag.Usage
 	flag.Usage = func() {
@@ -79,6 +83,10 @@ func ParseCmd() {
 			showAdmin()
 		case reset:
 			resetAdmin()
+		case totp:
+			enrollTotp(username)
+		case reset2fa:
+			resetAdmin2fa(username)
 		default:
 			updateAdmin(username, password)
 			showAdmin()
@@ -38,6 +38,18 @@ func MigrateDb() {
 	tx.Raw("SELECT value FROM settings WHERE key = ?", "version").Find(&dbVersion)
 	fmt.Println("Current version:", currentVersion, "\nDatabase version:", dbVersion)
 
+	err = hashPasswords(tx)
+	if err != nil {
+		log.Fatal("Hashing passwords failed: ", err)
+		return
+	}
+
+	err = hashTokens(tx)
+	if err != nil {
+		log.Fatal("Hashing API tokens failed: ", err)
+		return
+	}
+
 	if currentVersion == dbVersion {
 		fmt.Println("Database is up to date, no need to migrate")
 		return
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/util"
+
+	"gorm.io/gorm"
+)
+
+// hashPasswords replaces the plaintext admin passwords of older versions with
+// argon2id hashes. It does not depend on the version and is safe to rerun.
+func hashPasswords(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&model.User{}) {
+		return nil
+	}
+	var users []model.User
+	err := db.Model(model.User{}).Select("id", "username", "password").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if util.IsPasswordHash(user.Password) {
+			continue
+		}
+		hash, err := util.HashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		err = db.Model(model.User{}).Where("id = ?", user.Id).Update("password", hash).Error
+		if err != nil {
+			return err
+		}
+		fmt.Println("Hashed the password of", user.Username)
+	}
+	return nil
+}
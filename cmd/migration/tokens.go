@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/util"
+
+	"gorm.io/gorm"
+)
+
+// hashTokens replaces the plaintext API tokens of older versions with their
+// hashes. It does not depend on the version and is safe to rerun.
+func hashTokens(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&model.Tokens{}) {
+		return nil
+	}
+	var tokens []model.Tokens
+	err := db.Model(model.Tokens{}).Select("id", "token").Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	hashed := 0
+	for _, token := range tokens {
+		if util.IsTokenHash(token.Token) {
+			continue
+		}
+		err = db.Model(model.Tokens{}).Where("id = ?", token.Id).Update("token", util.HashToken(token.Token)).Error
+		if err != nil {
+			return err
+		}
+		hashed++
+	}
+	if hashed > 0 {
+		fmt.Println("Hashed", hashed, "API tokens")
+	}
+	return nil
+}
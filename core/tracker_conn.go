@@ -3,7 +3,9 @@ package core
 import (
 	"context"
 	"net"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/sagernet/sing-box/adapter"
@@ -16,17 +18,56 @@ type ConnectionInfo struct {
 	PacketConn network.PacketConn
 	Inbound    string
 	Type       string // "tcp" or "udp"
+	User       string
+	Ip         string
+}
+
+// userIp is a source IP of a user with its connections.
+type userIp struct {
+	conns int
+	since time.Time
 }
 
 type ConnTracker struct {
 	access      sync.Mutex
 	connections map[string]*ConnectionInfo
+	userIps     map[string]map[string]*userIp
+
+	// Limits of concurrent source IPs by user. Connections from further IPs
+	// are rejected, or with dropOldest the connections of the oldest IP are
+	// closed instead.
+	ipLimits   map[string]int
+	dropOldest bool
 }
 
 func NewConnTracker() *ConnTracker {
 	return &ConnTracker{
 		connections: make(map[string]*ConnectionInfo),
+		userIps:     make(map[string]map[string]*userIp),
+	}
+}
+
+// SetIpLimits replaces the limits of concurrent source IPs by user. The
+// connections over the new limits are kept until they close.
+func (c *ConnTracker) SetIpLimits(limits map[string]int, dropOldest bool) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	c.ipLimits = limits
+	c.dropOldest = dropOldest
+}
+
+// UserIps returns the source IPs of the connections of each user.
+func (c *ConnTracker) UserIps() map[string][]string {
+	c.access.Lock()
+	defer c.access.Unlock()
+	result := make(map[string][]string, len(c.userIps))
+	for user, ips := range c.userIps {
+		for ip := range ips {
+			result[user] = append(result[user], ip)
+		}
+		slices.Sort(result[user])
 	}
+	return result
 }
 
 func (c *ConnTracker) generateConnectionID() string {
@@ -40,9 +81,13 @@ func (c *ConnTracker) RoutedConnection(ctx context.Context, conn net.Conn, metad
 		Conn:    conn,
 		Inbound: metadata.Inbound,
 		Type:    "tcp",
+		User:    metadata.User,
+		Ip:      metadata.Source.Addr.Unmap().String(),
 	}
 
-	c.trackConnection(connID, connInfo)
+	if !c.trackConnection(connID, connInfo) {
+		conn.Close()
+	}
 
 	return c.createWrappedConn(conn, connID)
 }
@@ -54,9 +99,13 @@ func (c *ConnTracker) RoutedPacketConnection(ctx context.Context, conn network.P
 		PacketConn: conn,
 		Inbound:    metadata.Inbound,
 		Type:       "udp",
+		User:       metadata.User,
+		Ip:         metadata.Source.Addr.Unmap().String(),
 	}
 
-	c.trackConnection(connID, connInfo)
+	if !c.trackConnection(connID, connInfo) {
+		conn.Close()
+	}
 
 	return c.createWrappedPacketConn(conn, connID)
 }
@@ -68,29 +117,92 @@ func (c *ConnTracker) CloseConnByInbound(inbound string) int {
 	closedCount := 0
 	for connID, connInfo := range c.connections {
 		if connInfo.Inbound == inbound {
-			if connInfo.Conn != nil {
-				connInfo.Conn.Close()
-			}
-			if connInfo.PacketConn != nil {
-				connInfo.PacketConn.Close()
-			}
-			delete(c.connections, connID)
+			c.closeConnection(connID, connInfo)
 			closedCount++
 		}
 	}
 	return closedCount
 }
 
-func (c *ConnTracker) trackConnection(connID string, connInfo *ConnectionInfo) {
+// trackConnection tracks a connection, it returns false if the connection
+// exceeds the IP limit of its user and has to be rejected.
+func (c *ConnTracker) trackConnection(connID string, connInfo *ConnectionInfo) bool {
 	c.access.Lock()
 	defer c.access.Unlock()
+	if connInfo.User != "" {
+		ips := c.userIps[connInfo.User]
+		ip, ok := ips[connInfo.Ip]
+		if !ok {
+			if limit := c.ipLimits[connInfo.User]; limit > 0 && len(ips) >= limit {
+				if !c.dropOldest {
+					return false
+				}
+				c.dropOldestIp(connInfo.User, ips)
+			}
+			// Dropping the last IP removes the map of the user
+			ips = c.userIps[connInfo.User]
+			if ips == nil {
+				ips = make(map[string]*userIp)
+				c.userIps[connInfo.User] = ips
+			}
+			ip = &userIp{since: time.Now()}
+			ips[connInfo.Ip] = ip
+		}
+		ip.conns++
+	}
 	c.connections[connID] = connInfo
+	return true
+}
+
+// dropOldestIp closes the connections of the IP of a user which connected first.
+func (c *ConnTracker) dropOldestIp(user string, ips map[string]*userIp) {
+	var oldest string
+	for addr, ip := range ips {
+		if oldest == "" || ip.since.Before(ips[oldest].since) {
+			oldest = addr
+		}
+	}
+	for connID, connInfo := range c.connections {
+		if connInfo.User == user && connInfo.Ip == oldest {
+			c.closeConnection(connID, connInfo)
+		}
+	}
+}
+
+// closeConnection closes and untracks a connection, the lock must be held.
+func (c *ConnTracker) closeConnection(connID string, connInfo *ConnectionInfo) {
+	if connInfo.Conn != nil {
+		connInfo.Conn.Close()
+	}
+	if connInfo.PacketConn != nil {
+		connInfo.PacketConn.Close()
+	}
+	c.removeConnection(connID, connInfo)
 }
 
 func (c *ConnTracker) untrackConnection(connID string) {
 	c.access.Lock()
 	defer c.access.Unlock()
+	if connInfo, ok := c.connections[connID]; ok {
+		c.removeConnection(connID, connInfo)
+	}
+}
+
+func (c *ConnTracker) removeConnection(connID string, connInfo *ConnectionInfo) {
 	delete(c.connections, connID)
+	if connInfo.User == "" {
+		return
+	}
+	ips := c.userIps[connInfo.User]
+	if ip, ok := ips[connInfo.Ip]; ok {
+		ip.conns--
+		if ip.conns <= 0 {
+			delete(ips, connInfo.Ip)
+		}
+	}
+	if len(ips) == 0 {
+		delete(c.userIps, connInfo.User)
+	}
 }
 
 func (c *ConnTracker) createWrappedConn(conn net.Conn, connID string) *wrappedConn {
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	M "github.com/sagernet/sing/common/metadata"
+)
+
+func connectFrom(c *ConnTracker, user string, ip string) net.Conn {
+	conn, peer := net.Pipe()
+	go io.Copy(io.Discard, peer)
+	metadata := adapter.InboundContext{User: user, Source: M.SocksaddrFrom(netip.MustParseAddr(ip), 1000)}
+	return c.RoutedConnection(nil, conn, metadata, nil, nil)
+}
+
+func isClosed(conn net.Conn) bool {
+	_, err := conn.Write([]byte{0})
+	return err != nil
+}
+
+func TestIpLimitReject(t *testing.T) {
+	c := NewConnTracker()
+	connTracker = c
+	c.SetIpLimits(map[string]int{"u": 1}, false)
+
+	first := connectFrom(c, "u", "10.0.0.1")
+	same := connectFrom(c, "u", "10.0.0.1")
+	other := connectFrom(c, "u", "10.0.0.2")
+	if !isClosed(other) {
+		t.Error("connection from a second IP was accepted")
+	}
+	first.Close()
+	same.Close()
+	if ips := c.UserIps(); len(ips) != 0 {
+		t.Errorf("IPs left after closing: %v", ips)
+	}
+}
+
+func TestIpLimitDropOldestSingleIp(t *testing.T) {
+	c := NewConnTracker()
+	connTracker = c
+	c.SetIpLimits(map[string]int{"u": 1}, true)
+
+	addrs := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	var conns []net.Conn
+	for i, addr := range addrs {
+		conns = append(conns, connectFrom(c, "u", addr))
+		if ips := c.UserIps()["u"]; !slices.Equal(ips, []string{addr}) {
+			t.Fatalf("after connecting from %s the IPs are %v", addr, ips)
+		}
+		for _, old := range conns[:i] {
+			if !isClosed(old) {
+				t.Errorf("connection before %s was not dropped", addr)
+			}
+		}
+	}
+	if isClosed(conns[len(conns)-1]) {
+		t.Error("latest connection was dropped")
+	}
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/network"
+)
+
+// RateLimit is a bandwidth limit in bytes per second, 0 is unlimited.
+type RateLimit struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// RateLimits are the bandwidth limits of users, of groups of users sharing
+// one limit, and of inbounds.
+type RateLimits struct {
+	Users      map[string]RateLimit
+	Groups     map[string]RateLimit
+	UserGroups map[string]string // Group of each user
+	Inbounds   map[string]RateLimit
+}
+
+// rateLimiter is a token bucket holding one second of traffic. Waiters
+// reserve their bytes in advance, so the tokens may go negative and
+// concurrent connections share the rate.
+type rateLimiter struct {
+	access sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setRate(rate int64) {
+	l.access.Lock()
+	defer l.access.Unlock()
+	l.rate = float64(rate)
+	l.tokens = min(l.tokens, l.rate)
+}
+
+func (l *rateLimiter) wait(n int) {
+	l.access.Lock()
+	if l.rate <= 0 {
+		l.access.Unlock()
+		return
+	}
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens / l.rate
+	l.access.Unlock()
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit * float64(time.Second)))
+	}
+}
+
+type bandwidth struct {
+	up   *rateLimiter
+	down *rateLimiter
+}
+
+// updateBandwidths applies limits to the limiters of a kind. Connections keep
+// their limiters, so removed limits are set to unlimited rather than dropped.
+func updateBandwidths(bandwidths map[string]*bandwidth, limits map[string]RateLimit) {
+	for name, b := range bandwidths {
+		if _, ok := limits[name]; !ok {
+			b.up.setRate(0)
+			b.down.setRate(0)
+			delete(bandwidths, name)
+		}
+	}
+	for name, limit := range limits {
+		b, ok := bandwidths[name]
+		if !ok {
+			b = &bandwidth{up: &rateLimiter{}, down: &rateLimiter{}}
+			bandwidths[name] = b
+		}
+		b.up.setRate(limit.Up)
+		b.down.setRate(limit.Down)
+	}
+}
+
+// SetRateLimits replaces the bandwidth limits, they apply to open connections too.
+func (c *StatsTracker) SetRateLimits(limits RateLimits) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	updateBandwidths(c.userLimits, limits.Users)
+	updateBandwidths(c.groupLimits, limits.Groups)
+	updateBandwidths(c.inboundLimits, limits.Inbounds)
+	c.userGroups = limits.UserGroups
+}
+
+// getLimiters returns the limiters a connection of user to inbound passes.
+func (c *StatsTracker) getLimiters(inbound string, user string) (up []*rateLimiter, down []*rateLimiter) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	add := func(b *bandwidth) {
+		if b != nil {
+			up = append(up, b.up)
+			down = append(down, b.down)
+		}
+	}
+	if user != "" {
+		add(c.userLimits[user])
+		if group, ok := c.userGroups[user]; ok {
+			add(c.groupLimits[group])
+		}
+	}
+	if inbound != "" {
+		add(c.inboundLimits[inbound])
+	}
+	return
+}
+
+func waitAll(limiters []*rateLimiter, n int) {
+	for _, l := range limiters {
+		l.wait(n)
+	}
+}
+
+// limitedConn limits reading, the upload of the user, and writing, the download.
+type limitedConn struct {
+	net.Conn
+	up   []*rateLimiter
+	down []*rateLimiter
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	waitAll(c.up, n)
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	waitAll(c.down, len(p))
+	return c.Conn.Write(p)
+}
+
+func (c *limitedConn) Upstream() any {
+	return c.Conn
+}
+
+type limitedPacketConn struct {
+	network.PacketConn
+	up   []*rateLimiter
+	down []*rateLimiter
+}
+
+func (c *limitedPacketConn) ReadPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	destination, err := c.PacketConn.ReadPacket(buffer)
+	waitAll(c.up, buffer.Len())
+	return destination, err
+}
+
+func (c *limitedPacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	waitAll(c.down, buffer.Len())
+	return c.PacketConn.WritePacket(buffer, destination)
+}
+
+func (c *limitedPacketConn) Upstream() any {
+	return c.PacketConn
+}
@@ -24,13 +24,21 @@ type StatsTracker struct {
 	inbounds  map[string]Counter
 	outbounds map[string]Counter
 	users     map[string]Counter
+
+	userLimits    map[string]*bandwidth
+	groupLimits   map[string]*bandwidth
+	inboundLimits map[string]*bandwidth
+	userGroups    map[string]string
 }
 
 func NewStatsTracker() *StatsTracker {
 	return &StatsTracker{
-		inbounds:  make(map[string]Counter),
-		outbounds: make(map[string]Counter),
-		users:     make(map[string]Counter),
+		inbounds:      make(map[string]Counter),
+		outbounds:     make(map[string]Counter),
+		users:         make(map[string]Counter),
+		userLimits:    make(map[string]*bandwidth),
+		groupLimits:   make(map[string]*bandwidth),
+		inboundLimits: make(map[string]*bandwidth),
 	}
 }
 
@@ -67,12 +75,20 @@ func (c *StatsTracker) loadOrCreateCounter(obj *map[string]Counter, name string)
 
 func (c *StatsTracker) RoutedConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, matchedRule adapter.Rule, matchOutbound adapter.Outbound) net.Conn {
 	readCounter, writeCounter := c.getReadCounters(metadata.Inbound, matchOutbound.Tag(), metadata.User)
-	return bufio.NewInt64CounterConn(conn, readCounter, writeCounter)
+	conn = bufio.NewInt64CounterConn(conn, readCounter, writeCounter)
+	if up, down := c.getLimiters(metadata.Inbound, metadata.User); len(up) > 0 {
+		return &limitedConn{Conn: conn, up: up, down: down}
+	}
+	return conn
 }
 
 func (c *StatsTracker) RoutedPacketConnection(ctx context.Context, conn network.PacketConn, metadata adapter.InboundContext, matchedRule adapter.Rule, matchOutbound adapter.Outbound) network.PacketConn {
 	readCounter, writeCounter := c.getReadCounters(metadata.Inbound, matchOutbound.Tag(), metadata.User)
-	return bufio.NewInt64CounterPacketConn(conn, readCounter, nil, writeCounter, nil)
+	conn = bufio.NewInt64CounterPacketConn(conn, readCounter, nil, writeCounter, nil)
+	if up, down := c.getLimiters(metadata.Inbound, metadata.User); len(up) > 0 {
+		return &limitedPacketConn{PacketConn: conn, up: up, down: down}
+	}
+	return conn
 }
 
 func (c *StatsTracker) GetStats() *[]model.Stats {
@@ -1,11 +1,17 @@
 package cronjob
 
 import (
+	"sync/atomic"
+
+	"github.com/igor04091968/sing-chisel-tel/events"
 	"github.com/igor04091968/sing-chisel-tel/service"
 )
 
 type CheckCoreJob struct {
 	service.ConfigService
+	// failing is set while sing-box can't be restarted, so the failure is
+	// alerted once instead of on every run
+	failing atomic.Bool
 }
 
 func NewCheckCoreJob() *CheckCoreJob {
@@ -13,5 +19,17 @@ func NewCheckCoreJob() *CheckCoreJob {
 }
 
 func (s *CheckCoreJob) Run() {
-	s.ConfigService.StartCore("")
+	if s.ConfigService.IsCoreRunning() {
+		s.failing.Store(false)
+		return
+	}
+	err := s.ConfigService.StartCore("")
+	if err != nil {
+		if !s.failing.Swap(true) {
+			events.Publish(events.CoreStartFailed, "sing-box is down and could not be restarted: "+err.Error(), nil)
+		}
+		return
+	}
+	s.failing.Store(false)
+	events.Publish(events.CoreRestarted, "sing-box was down and has been restarted", nil)
 }
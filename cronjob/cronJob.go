@@ -23,10 +23,14 @@ func (c *CronJob) Start(loc *time.Location, trafficAge int) error {
 		c.cron.AddJob("@every 10s", NewStatsJob(trafficAge > 0))
 		// Start expiry job
 		c.cron.AddJob("@every 1m", NewDepleteJob())
+		// Start resetting the usage of clients with a reset policy
+		c.cron.AddJob("@every 1m", NewResetJob(loc))
 		// Start deleting old stats
 		if trafficAge > 0 {
 			c.cron.AddJob("@daily", NewDelStatsJob(trafficAge))
 		}
+		// Start deleting old subscription accesses
+		c.cron.AddJob("@daily", NewDelSubAccessJob())
 		// Start core if it is not running
 		c.cron.AddJob("@every 5s", NewCheckCoreJob())
 	}()
@@ -0,0 +1,27 @@
+package cronjob
+
+import (
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+type DelSubAccessJob struct {
+	service.SubAccessService
+}
+
+func NewDelSubAccessJob() *DelSubAccessJob {
+	return &DelSubAccessJob{}
+}
+
+func (s *DelSubAccessJob) Run() {
+	logAge, err := s.SettingService.GetSubLogAge()
+	if err != nil || logAge == 0 {
+		return
+	}
+	err = s.SubAccessService.DelOldAccesses(logAge)
+	if err != nil {
+		logger.Warning("Deleting old subscription accesses failed: ", err)
+		return
+	}
+	logger.Debug("Subscription accesses older than ", logAge, " days were deleted")
+}
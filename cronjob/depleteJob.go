@@ -16,6 +16,10 @@ func NewDepleteJob() *DepleteJob {
 }
 
 func (s *DepleteJob) Run() {
+	err := s.ClientService.ActivateHeldClients()
+	if err != nil {
+		logger.Warning("Activate on hold clients failed: ", err)
+	}
 	inboundIds, err := s.ClientService.DepleteClients()
 	if err != nil {
 		logger.Warning("Disable depleted users failed: ", err)
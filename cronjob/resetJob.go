@@ -0,0 +1,33 @@
+package cronjob
+
+import (
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/service"
+)
+
+type ResetJob struct {
+	service.ClientService
+	service.InboundService
+	loc *time.Location
+}
+
+func NewResetJob(loc *time.Location) *ResetJob {
+	return &ResetJob{loc: loc}
+}
+
+func (s *ResetJob) Run() {
+	inboundIds, err := s.ClientService.ResetClients(s.loc)
+	if err != nil {
+		logger.Warning("Reset usage of clients failed: ", err)
+		return
+	}
+	if len(inboundIds) > 0 {
+		err := s.InboundService.RestartInbounds(database.GetDB(), inboundIds)
+		if err != nil {
+			logger.Error("unable to restart inbounds: ", err)
+		}
+	}
+}
@@ -54,6 +54,8 @@ func GetDb(exclude string) ([]byte, error) {
 		&model.Stats{},
 		&model.Client{},
 		&model.Changes{},
+		&model.SubTemplate{},
+		&model.WebAuthnCredential{},
 	)
 	if err != nil {
 		return nil, err
@@ -68,6 +70,8 @@ func GetDb(exclude string) ([]byte, error) {
 	var clients []model.Client
 	var stats []model.Stats
 	var changes []model.Changes
+	var subTemplates []model.SubTemplate
+	var webAuthnCredentials []model.WebAuthnCredential
 
 	// Perform scans and handle errors
 	if err := db.Model(&model.Setting{}).Scan(&settings).Error; err != nil {
@@ -119,6 +123,20 @@ func GetDb(exclude string) ([]byte, error) {
 			return nil, err
 		}
 	}
+	if err := db.Model(&model.SubTemplate{}).Scan(&subTemplates).Error; err != nil {
+		return nil, err
+	} else if len(subTemplates) > 0 {
+		if err := backupDb.Save(subTemplates).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := db.Model(&model.WebAuthnCredential{}).Scan(&webAuthnCredentials).Error; err != nil {
+		return nil, err
+	} else if len(webAuthnCredentials) > 0 {
+		if err := backupDb.Save(webAuthnCredentials).Error; err != nil {
+			return nil, err
+		}
+	}
 
 	if !exclude_stats {
 		if err := db.Model(&model.Stats{}).Scan(&stats).Error; err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/igor04091968/sing-chisel-tel/config"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/util"
 
 	sqlitegorm "github.com/glebarez/sqlite"
 	"gorm.io/gorm"
@@ -22,9 +23,13 @@ func initUser() error {
 		return err
 	}
 	if count == 0 {
+		hash, err := util.HashPassword("admin")
+		if err != nil {
+			return err
+		}
 		user := &model.User{
 			Username: "admin",
-			Password: "admin",
+			Password: hash,
 		}
 		return db.Create(user).Error
 	}
@@ -84,6 +89,7 @@ func InitDB(dbPath string) error {
 		&model.User{},
 		&model.Stats{},
 		&model.Client{},
+		&model.ClientUsage{},
 		&model.Changes{},
 		&model.ChiselConfig{},
 		&model.GostConfig{},
@@ -91,8 +97,17 @@ func InitDB(dbPath string) error {
 		&model.Tokens{},
 		&model.GreTunnel{},
 		&model.TapTunnel{},
+		&model.VxlanTunnel{},
+		&model.RouteTable{},
+		&model.Route{},
+		&model.RouteRule{},
 		&model.MTProtoProxyConfig{},
 		&model.UdpTunnelConfig{},
+		&model.TgBindCode{},
+		&model.TgBinding{},
+		&model.SubTemplate{},
+		&model.SubAccess{},
+		&model.WebAuthnCredential{},
 	)
 	if err != nil {
 		return err
@@ -20,6 +20,13 @@ type User struct {
 	Username   string `json:"username" form:"username"`
 	Password   string `json:"password" form:"password"`
 	LastLogins string `json:"lastLogin"`
+	Role       string `json:"role" form:"role" gorm:"default:admin"`
+
+	// Second factor, the secret stays pending until TotpEnabled is set
+	TotpSecret    string `json:"-"`
+	TotpEnabled   bool   `json:"totpEnabled"`
+	TotpLastStep  int64  `json:"-"` // Time step of the last accepted TOTP code, older and equal ones are rejected
+	RecoveryCodes string `json:"-"` // JSON list of SHA-256 hashes of the unused recovery codes
 }
 
 type Client struct {
@@ -35,6 +42,33 @@ type Client struct {
 	Up       int64           `json:"up" form:"up"`
 	Desc     string          `json:"desc" form:"desc"`
 	Group    string          `json:"group" form:"group"`
+
+	// Subscription access, independent of the name
+	SubToken      string `json:"subToken" form:"subToken" gorm:"index"`
+	SubPrevToken  string `json:"-" gorm:"index"`
+	SubPrevExpiry int64  `json:"-"`
+	SubAllowIps   string `json:"subAllowIps" form:"subAllowIps"`
+	SubAllowUAs   string `json:"subAllowUAs" form:"subAllowUAs"`
+
+	// Periodic reset of the usage: "", "daily", "weekly", "monthly" or "days".
+	// ResetDay is the weekday (0 is Sunday), the day of the month, or the
+	// length of the period in days.
+	ResetMode string `json:"resetMode" form:"resetMode"`
+	ResetDay  int    `json:"resetDay" form:"resetDay"`
+	LastReset int64  `json:"lastReset" form:"lastReset"` // Start of the current period, 0 until the first run of the reset job
+
+	// On hold clients get their expiry on their first traffic, Duration days
+	// later. After HoldMax days on hold (0 is unlimited) their clock starts anyway.
+	OnHold    bool  `json:"onHold" form:"onHold"`
+	Duration  int   `json:"duration" form:"duration"`
+	HoldMax   int   `json:"holdMax" form:"holdMax"`
+	HoldSince int64 `json:"holdSince" form:"holdSince"`
+
+	MaxIps int `json:"maxIps" form:"maxIps"` // Concurrent source IPs, 0 is unlimited
+
+	// Bandwidth limits in bytes per second, 0 is unlimited
+	UpLimit   int64 `json:"upLimit" form:"upLimit"`
+	DownLimit int64 `json:"downLimit" form:"downLimit"`
 }
 
 type Stats struct {
@@ -46,6 +80,16 @@ type Stats struct {
 	Traffic   int64  `json:"traffic"`
 }
 
+// ClientUsage is the usage of a client in a past reset period.
+type ClientUsage struct {
+	Id       uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	ClientId uint   `json:"clientId" gorm:"index"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Up       int64  `json:"up"`
+	Down     int64  `json:"down"`
+}
+
 type Changes struct {
 	Id       uint64          `json:"id" gorm:"primaryKey;autoIncrement"`
 	DateTime int64           `json:"dateTime"`
@@ -53,13 +97,27 @@ type Changes struct {
 	Key      string          `json:"key"`
 	Action   string          `json:"action"`
 	Obj      json.RawMessage `json:"obj"`
+
+	// Snapshots of the changed object, in the form its Save function accepts
+	Ref      uint            `json:"ref"`      // Id of the object, 0 if unknown
+	Before   json.RawMessage `json:"before"`   // null if it was created
+	After    json.RawMessage `json:"after"`    // null if it was deleted
+	RevertOf uint64          `json:"revertOf"` // Id of the change this one reverts
 }
 
 type Tokens struct {
 	Id     uint   `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	Desc   string `json:"desc" form:"desc"`
-	Token  string `json:"token" form:"token"`
+	Token  string `json:"token" form:"token"` // SHA-256 hash, the token itself is shown once
 	Expiry int64  `json:"expiry" form:"expiry"`
 	UserId uint   `json:"userId" form:"userId"`
 	User   *User  `json:"user" gorm:"foreignKey:UserId;references:Id"`
+
+	RateLimit int    `json:"rateLimit" form:"rateLimit"` // Requests per minute, 0 is unlimited
+	LastUsed  int64  `json:"lastUsed"`
+	LastIp    string `json:"lastIp"`
+
+	// Limits on top of the role of the user, empty for none
+	Scopes string `json:"scopes" form:"scopes"` // Comma separated permissions
+	Groups string `json:"groups" form:"groups"` // Comma separated client groups
 }
@@ -0,0 +1,39 @@
+package model
+
+import "gorm.io/gorm"
+
+// RouteTable represents a custom routing table used by policy rules.
+type RouteTable struct {
+	gorm.Model
+	Name    string `gorm:"unique" json:"name"`     // Human readable name, e.g., "via_gre1"
+	TableId int    `gorm:"unique" json:"table_id"` // Kernel table number, 1-252
+	Desc    string `json:"desc"`                   // Optional description
+}
+
+// Route represents a static route managed through netlink.
+type Route struct {
+	gorm.Model
+	Destination string `json:"destination"`                  // Destination prefix, e.g., "10.20.0.0/16" or "default"
+	Gateway     string `json:"gateway"`                      // Optional next hop IP address
+	Device      string `json:"device"`                       // Output interface, defaults to Tunnel when empty
+	Table       int    `json:"table"`                        // Routing table number, 0 means the main table
+	Metric      int    `json:"metric"`                       // Route priority
+	Tunnel      string `json:"tunnel"`                       // Tunnel interface the route is tied to, empty for always-on routes
+	Namespace   string `json:"namespace"`                    // Network namespace the route is installed in, empty for the host namespace
+	Status      string `json:"status" gorm:"default:'down'"` // Status of the route, e.g., "up" or "down"
+}
+
+// RouteRule represents a policy routing rule, the equivalent of `ip rule`.
+type RouteRule struct {
+	gorm.Model
+	Priority  int    `json:"priority"`                     // Rule priority, 0 lets the kernel choose
+	Src       string `json:"src"`                          // Match by source prefix, e.g., "192.168.10.0/24"
+	Dst       string `json:"dst"`                          // Match by destination prefix
+	Fwmark    uint32 `json:"fwmark"`                       // Match by firewall mark, 0 disables the match
+	Mask      uint32 `json:"mask"`                         // Optional mask for Fwmark
+	IifName   string `json:"iif"`                          // Match by incoming interface
+	Table     int    `json:"table"`                        // Routing table to look up on match
+	Tunnel    string `json:"tunnel"`                       // Tunnel interface the rule is tied to, empty for always-on rules
+	Namespace string `json:"namespace"`                    // Network namespace the rule is installed in, empty for the host namespace
+	Status    string `json:"status" gorm:"default:'down'"` // Status of the rule, e.g., "up" or "down"
+}
@@ -0,0 +1,12 @@
+package model
+
+// SubAccess records a fetch of a client's subscription.
+type SubAccess struct {
+	Id        uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	DateTime  int64  `json:"dateTime" gorm:"index"`
+	ClientId  uint   `json:"clientId" gorm:"index"`
+	Ip        string `json:"ip"`
+	Country   string `json:"country"` // From CF-IPCountry, empty without Cloudflare behind a trusted proxy
+	UserAgent string `json:"userAgent"`
+	Format    string `json:"format"` // links for the plain subscription
+}
@@ -0,0 +1,17 @@
+package model
+
+import "encoding/json"
+
+// SubTemplate is a client configuration template used by the subscription
+// server. The most specific template wins: matching client names before
+// matching groups before default templates, and a matching platform before
+// templates for all platforms.
+type SubTemplate struct {
+	Id       uint            `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name     string          `json:"name" form:"name" gorm:"uniqueIndex"`
+	Format   string          `json:"format" form:"format"`     // singbox or clash
+	Platform string          `json:"platform" form:"platform"` // android, ios or desktop, empty for all
+	Clients  json.RawMessage `json:"clients" form:"clients"`   // Client names, empty for all
+	Groups   json.RawMessage `json:"groups" form:"groups"`     // Client groups, empty for all
+	Content  string          `json:"content" form:"content"`
+}
@@ -0,0 +1,21 @@
+package model
+
+// TgBindCode is a one-time code generated in the panel, which a client sends
+// to the bot to bind their Telegram account.
+type TgBindCode struct {
+	Id       uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	ClientId uint   `json:"clientId" gorm:"index"`
+	Code     string `json:"code" gorm:"uniqueIndex"`
+	Expiry   int64  `json:"expiry"`
+}
+
+// TgBinding links a Telegram chat to a client of the self-service bot.
+type TgBinding struct {
+	Id           uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	ClientId     uint   `json:"clientId" gorm:"index"`
+	ChatId       int64  `json:"chatId" gorm:"uniqueIndex"`
+	Username     string `json:"username"`
+	DateTime     int64  `json:"dateTime"`
+	WarnedVolume int    `json:"warnedVolume"` // Highest used-volume percentage already warned about
+	WarnedDays   int    `json:"warnedDays"`   // Lowest days-left threshold already warned about, 0 for none
+}
@@ -16,6 +16,7 @@ type UdpTunnelConfig struct {
 	VLANPriority        uint8  `json:"vlan_priority,omitempty"` // 802.1p Priority Code Point (0-7)
 	DSCP                uint8  `json:"dscp,omitempty"`          // DiffServ Code Point (0-63)
 	InterfaceName       string `json:"interface_name,omitempty"` // e.g., "eth0" for --lower-level
+	Namespace           string `json:"namespace,omitempty"`      // Network namespace the tunnel sockets are opened in
 	DestMAC             string `json:"dest_mac,omitempty"`       // Destination MAC address for --lower-level
 	FakeTCPFlags        string `json:"fake_tcp_flags,omitempty"` // e.g., "SYN", "SYNACK"
 	Status              string `json:"status"`                   // "running", "stopped"
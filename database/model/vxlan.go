@@ -0,0 +1,34 @@
+package model
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// VxlanTunnel represents the configuration for a VXLAN or GENEVE overlay tunnel.
+type VxlanTunnel struct {
+	gorm.Model
+	Name          string          `gorm:"unique" json:"name"`           // Name of the overlay interface, e.g., "vxlan100"
+	Type          string          `json:"type" gorm:"default:'vxlan'"`  // Overlay type, "vxlan" or "geneve"
+	VNI           int             `json:"vni"`                          // VXLAN Network Identifier (GENEVE VNI), 0-16777215
+	LocalAddress  string          `json:"local_address"`                // Local VTEP IP address (VXLAN only)
+	RemoteAddress string          `json:"remote_address"`               // Remote VTEP IP address or multicast group
+	Device        string          `json:"device"`                       // Underlay interface, required for multicast groups
+	Port          int             `json:"port"`                         // Destination UDP port, 4789 for VXLAN and 6081 for GENEVE by default
+	Learning      bool            `json:"learning"`                     // Enable source MAC learning (VXLAN only)
+	TunnelAddress string          `json:"tunnel_address"`               // IP address and mask for the overlay interface, e.g., "10.10.0.1/24"
+	MTU           int             `json:"mtu"`                          // MTU for the overlay interface, 0 keeps the kernel default
+	Namespace     string          `json:"namespace"`                    // Network namespace the interface lives in, the underlay stays in the host namespace
+	FdbEntries    json.RawMessage `json:"fdb_entries"`                  // Static FDB entries for unicast peers, see VxlanFdbEntry
+	InterfaceName string          `json:"interface_name"`               // User-defined name for the interface
+	Status        string          `json:"status" gorm:"default:'down'"` // Status of the tunnel, e.g., "up" or "down"
+}
+
+// VxlanFdbEntry is a static forwarding database entry of a VXLAN tunnel.
+// An empty MAC adds an all-zeros entry, so broadcast and unknown unicast
+// traffic is replicated to the peer.
+type VxlanFdbEntry struct {
+	MAC string `json:"mac,omitempty"` // Remote MAC address, e.g., "52:54:00:12:34:56"
+	Dst string `json:"dst"`           // Remote VTEP IP address
+}
@@ -0,0 +1,15 @@
+package model
+
+import "encoding/json"
+
+// WebAuthnCredential is a passkey or security key registered by an admin as
+// second login factor.
+type WebAuthnCredential struct {
+	Id           uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId       uint            `json:"userId" gorm:"index"`
+	Name         string          `json:"name"`
+	CredentialId string          `json:"-" gorm:"uniqueIndex"` // Base64url of the credential ID
+	Credential   json.RawMessage `json:"-"`                    // webauthn.Credential, with the public key and sign count
+	CreatedAt    int64           `json:"createdAt"`
+	LastUsed     int64           `json:"lastUsed"`
+}
@@ -0,0 +1,131 @@
+// Package events is an in-process bus for operational events. Code paths
+// publish without waiting, the configured sinks deliver in the background.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/logger"
+)
+
+// Event types published by the panel
+const (
+	CoreRestarted      = "core.restarted"
+	CoreStartFailed    = "core.start_failed"
+	ChiselDisconnected = "chisel.disconnected"
+	ClientsDepleted    = "clients.depleted"
+	LoginFailed        = "login.failed"
+	LoginBanned        = "login.banned"
+	SubAbuse           = "sub.abuse"
+)
+
+// Types lists all event types, used to validate sink filters.
+var Types = []string{
+	CoreRestarted,
+	CoreStartFailed,
+	ChiselDisconnected,
+	ClientsDepleted,
+	LoginFailed,
+	LoginBanned,
+	SubAbuse,
+}
+
+type Event struct {
+	Type    string                 `json:"type"`
+	Time    int64                  `json:"time"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// Sender delivers events to a transport which is owned by another package,
+// like the Telegram bot.
+type Sender func(e *Event) error
+
+const queueSize = 256
+
+var (
+	mu        sync.RWMutex
+	sinks     []*sink
+	senders   = make(map[string]Sender)
+	queue     = make(chan *Event, queueSize)
+	startOnce sync.Once
+)
+
+// Publish queues an event for all sinks. It never blocks, events are dropped
+// when the queue is full.
+func Publish(eventType string, message string, data map[string]interface{}) {
+	startOnce.Do(func() {
+		go dispatch()
+	})
+	e := &Event{
+		Type:    eventType,
+		Time:    time.Now().Unix(),
+		Message: message,
+		Data:    data,
+	}
+	select {
+	case queue <- e:
+	default:
+		logger.Warning("events: queue is full, dropping ", eventType)
+	}
+}
+
+// Configure replaces the active sinks. The old sinks stay active if a config is invalid.
+func Configure(configs []SinkConfig) error {
+	newSinks := make([]*sink, 0, len(configs))
+	for i := range configs {
+		s, err := newSink(&configs[i])
+		if err != nil {
+			for _, created := range newSinks {
+				created.close()
+			}
+			return err
+		}
+		newSinks = append(newSinks, s)
+	}
+
+	mu.Lock()
+	oldSinks := sinks
+	sinks = newSinks
+	mu.Unlock()
+
+	for _, s := range oldSinks {
+		s.close()
+	}
+	return nil
+}
+
+// RegisterSender makes a transport available to the sinks of the same type.
+// A nil sender removes it again.
+func RegisterSender(name string, sender Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+	if sender == nil {
+		delete(senders, name)
+		return
+	}
+	senders[name] = sender
+}
+
+func getSender(name string) Sender {
+	mu.RLock()
+	defer mu.RUnlock()
+	return senders[name]
+}
+
+func dispatch() {
+	for e := range queue {
+		mu.RLock()
+		current := sinks
+		mu.RUnlock()
+		for _, s := range current {
+			if !s.accepts(e) {
+				continue
+			}
+			if err := s.Send(e); err != nil {
+				logger.Warning("events: ", s.config.Type, " sink failed to send ", e.Type, ": ", err)
+			}
+		}
+	}
+}
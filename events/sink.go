@@ -0,0 +1,194 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SinkConfig is one entry of the alertSinks setting.
+type SinkConfig struct {
+	// Type is telegram, webhook or syslog
+	Type string `json:"type"`
+	// Events filters by event type, "core.*" matches a whole group.
+	// An empty list accepts all events.
+	Events []string `json:"events,omitempty"`
+	// RateLimit is the maximum number of events per minute, 0 is unlimited
+	RateLimit int `json:"rate_limit,omitempty"`
+
+	// Webhook options, the body is signed with HMAC-SHA256 if Secret is set
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"`
+
+	// Syslog options, an empty Network logs to the local syslog daemon
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+type transport interface {
+	Send(e *Event) error
+	Close() error
+}
+
+type sink struct {
+	transport
+	config  SinkConfig
+	limiter *limiter
+}
+
+// ParseSinks parses and validates the alertSinks setting.
+func ParseSinks(data string) ([]SinkConfig, error) {
+	var configs []SinkConfig
+	if strings.TrimSpace(data) == "" {
+		return configs, nil
+	}
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("invalid alert sinks: %v", err)
+	}
+	for i := range configs {
+		if err := configs[i].validate(); err != nil {
+			return nil, fmt.Errorf("alert sink %d: %v", i+1, err)
+		}
+	}
+	return configs, nil
+}
+
+func (c *SinkConfig) validate() error {
+	switch c.Type {
+	case "telegram":
+	case "webhook":
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url %q", c.URL)
+		}
+	case "syslog":
+		switch c.Network {
+		case "":
+		case "udp", "tcp", "unix", "unixgram":
+			if c.Address == "" {
+				return fmt.Errorf("syslog address is required for network %s", c.Network)
+			}
+		default:
+			return fmt.Errorf("invalid syslog network %q", c.Network)
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", c.Type)
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate limit can not be negative")
+	}
+	for _, filter := range c.Events {
+		if !validFilter(filter) {
+			return fmt.Errorf("unknown event type %q", filter)
+		}
+	}
+	return nil
+}
+
+func newSink(c *SinkConfig) (*sink, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	var t transport
+	var err error
+	switch c.Type {
+	case "telegram":
+		t = &senderTransport{name: "telegram"}
+	case "webhook":
+		t = newWebhook(c.URL, c.Secret)
+	case "syslog":
+		t, err = newSyslog(c.Network, c.Address, c.Tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &sink{transport: t, config: *c}
+	if c.RateLimit > 0 {
+		s.limiter = &limiter{max: c.RateLimit}
+	}
+	return s, nil
+}
+
+func (s *sink) accepts(e *Event) bool {
+	if len(s.config.Events) > 0 {
+		matched := false
+		for _, filter := range s.config.Events {
+			if matchFilter(filter, e.Type) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return s.limiter == nil || s.limiter.allow()
+}
+
+func (s *sink) close() {
+	s.Close()
+}
+
+func matchFilter(filter string, eventType string) bool {
+	if filter == "*" || filter == eventType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(filter, "*"); ok {
+		return strings.HasPrefix(eventType, prefix)
+	}
+	return false
+}
+
+func validFilter(filter string) bool {
+	for _, t := range Types {
+		if matchFilter(filter, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter allows max events per minute in fixed windows.
+type limiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Time
+	count  int
+}
+
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Minute {
+		l.window = now
+		l.count = 0
+	}
+	if l.count >= l.max {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// senderTransport forwards to a registered Sender. Events are skipped
+// silently while nothing is registered, e.g. when the bot is disabled.
+type senderTransport struct {
+	name string
+}
+
+func (t *senderTransport) Send(e *Event) error {
+	sender := getSender(t.name)
+	if sender == nil {
+		return nil
+	}
+	return sender(e)
+}
+
+func (t *senderTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package events
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+type syslogWriter struct {
+	writer *syslog.Writer
+}
+
+func newSyslog(network string, address string, tag string) (*syslogWriter, error) {
+	if tag == "" {
+		tag = "s-ui"
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_WARNING|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to syslog: %v", err)
+	}
+	return &syslogWriter{writer: w}, nil
+}
+
+func (s *syslogWriter) Send(e *Event) error {
+	msg := fmt.Sprintf("[%s] %s", e.Type, e.Message)
+	if e.Type == LoginFailed || e.Type == CoreStartFailed {
+		return s.writer.Err(msg)
+	}
+	return s.writer.Warning(msg)
+}
+
+func (s *syslogWriter) Close() error {
+	return s.writer.Close()
+}
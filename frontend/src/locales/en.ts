@@ -123,9 +123,11 @@ export default {
     clone: "Clone",
     save: "Save",
     update: "Update",
+    revert: "Revert",
     submit: "Submit",
     set: "Set",
     generate: "Generate",
+    enable: "Enable",
     disable: "Disable",
     close: "Close",
     restartApp: "Restart App",
@@ -137,6 +139,10 @@ export default {
     unRules: "Username can not be empty",
     password: "Password",
     pwRules: "Password can not be empty",
+    code: "Authentication code",
+    codeHint: "From your authenticator app, or a recovery code",
+    passkey: "Use passkey",
+    telegram: "Approve in Telegram",
   },
   menu: {
     logout: "Logout",
@@ -153,10 +159,35 @@ export default {
     actor: "Actor",
     key: "Key",
     action: "Action",
+    add: "Add admin",
+    role: "Role",
+    path: "Path",
+    before: "Before",
+    after: "After",
+    revert: "Revert",
     api: {
       title: "API Tokens",
       msg: "Please copy the token below and store it somewhere safe. It will not be shown again.",
       token: "Token",
+      scopes: "Scopes",
+      allScopes: "All of the role",
+      scopesHint: "Empty for all permissions of your role",
+      groupsHint: "Comma separated client groups, empty for all clients",
+      rateLimit: "Rate limit",
+      rateLimitHint: "Requests per minute, 0 is unlimited",
+    },
+    twoFactor: {
+      title: "Two-factor authentication",
+      totp: "Authenticator app",
+      totpSetup: "Scan the QR code with your authenticator app and enter the code it shows.",
+      recoveryCodes: "Recovery codes",
+      recoveryMsg: "Each code logs in once without the app. Store them somewhere safe, they will not be shown again.",
+      recoveryLeft: "Recovery codes left",
+      enable: "Enable",
+      disable: "Disable",
+      passkeys: "Passkeys and security keys",
+      addPasskey: "Add passkey",
+      lastUsed: "Last used",
     },
   },
   setting: {
@@ -200,6 +231,23 @@ export default {
     links: "Links",
     external: "External Link",
     sub: "External Subscription",
+    reset: "Usage reset",
+    resetDay: "Reset day",
+    resetDays: "Period in days",
+    onHold: "On hold",
+    duration: "Duration",
+    holdMax: "Maximum on hold",
+    holdMaxHint: "Starts the clock anyway after these days, 0 waits for the first use",
+    maxIps: "IP limit",
+    maxIpsHint: "Concurrent source IPs, 0 is unlimited",
+    upLimit: "Upload limit",
+    downLimit: "Download limit",
+    resetModes: {
+      daily: "Daily",
+      weekly: "Weekly",
+      monthly: "Monthly",
+      days: "Days after activation",
+    },
   },
   bulk: {
     order: "Order",
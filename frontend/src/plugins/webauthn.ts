@@ -0,0 +1,53 @@
+// The server sends and expects binary WebAuthn fields as base64url strings,
+// the browser API works with ArrayBuffers.
+
+const toBuffer = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+  const padded = base64 + '='.repeat((4 - base64.length % 4) % 4)
+  return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer
+}
+
+const toBase64url = (buffer: ArrayBuffer | null): string | null => {
+  if (buffer == null) return null
+  let binary = ''
+  new Uint8Array(buffer).forEach(b => binary += String.fromCharCode(b))
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+export const createCredential = async (options: any): Promise<string> => {
+  const publicKey = options.publicKey
+  publicKey.challenge = toBuffer(publicKey.challenge)
+  publicKey.user.id = toBuffer(publicKey.user.id)
+  publicKey.excludeCredentials = (publicKey.excludeCredentials ?? []).map((c: any) => ({ ...c, id: toBuffer(c.id) }))
+  const credential = <PublicKeyCredential>await navigator.credentials.create({ publicKey })
+  const response = <AuthenticatorAttestationResponse>credential.response
+  return JSON.stringify({
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      attestationObject: toBase64url(response.attestationObject),
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      transports: response.getTransports?.() ?? [],
+    },
+  })
+}
+
+export const getAssertion = async (options: any): Promise<string> => {
+  const publicKey = options.publicKey
+  publicKey.challenge = toBuffer(publicKey.challenge)
+  publicKey.allowCredentials = (publicKey.allowCredentials ?? []).map((c: any) => ({ ...c, id: toBuffer(c.id) }))
+  const credential = <PublicKeyCredential>await navigator.credentials.get({ publicKey })
+  const response = <AuthenticatorAssertionResponse>credential.response
+  return JSON.stringify({
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      authenticatorData: toBase64url(response.authenticatorData),
+      clientDataJSON: toBase64url(response.clientDataJSON),
+      signature: toBase64url(response.signature),
+      userHandle: toBase64url(response.userHandle),
+    },
+  })
+}
@@ -11,7 +11,7 @@ const Data = defineStore('Data', {
     reloadItems: localStorage.getItem("reloadItems")?.split(',')?? <string[]>[],
     subURI: "",
     enableTraffic: false,
-    onlines: {inbound: <string[]>[], outbound: <string[]>[], user: <string[]>[]},
+    onlines: {inbound: <string[]>[], outbound: <string[]>[], user: <string[]>[], userIps: <{[user: string]: string[]}>{}},
     config: <any>{},
     inbounds: <any[]>[],
     outbounds: <any[]>[],
@@ -19,6 +19,19 @@ export interface Client {
   down: number
   desc: string
   group: string
+  subToken?: string
+  subAllowIps?: string
+  subAllowUAs?: string
+  resetMode?: string
+  resetDay?: number
+  lastReset?: number
+  onHold?: boolean
+  duration?: number
+  holdMax?: number
+  holdSince?: number
+  maxIps?: number
+  upLimit?: number
+  downLimit?: number
 }
 
 const defaultClient: Client = {
@@ -33,6 +46,14 @@ const defaultClient: Client = {
   down: 0,
   desc: "",
   group: "",
+  resetMode: "",
+  resetDay: 0,
+  onHold: false,
+  duration: 30,
+  holdMax: 0,
+  maxIps: 0,
+  upLimit: 0,
+  downLimit: 0,
 }
 
 type Config = {
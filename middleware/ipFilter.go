@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/igor04091968/sing-chisel-tel/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+var trustedProxies atomic.Pointer[[]*net.IPNet]
+
+// SetTrustedProxies sets the reverse proxies whose forwarded headers are
+// trusted, see the trustedProxies setting.
+func SetTrustedProxies(proxies []*net.IPNet) {
+	trustedProxies.Store(&proxies)
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	proxies := trustedProxies.Load()
+	if proxies == nil {
+		return ip.IsLoopback()
+	}
+	return util.ContainsIP(*proxies, ip)
+}
+
+// remoteAddr returns the IP of the peer and whether it is a trusted proxy.
+func remoteAddr(c *gin.Context) (string, bool) {
+	remote, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		remote = c.Request.RemoteAddr
+	}
+	return remote, isTrustedProxy(net.ParseIP(remote))
+}
+
+// ClientIP returns the IP of the client. Forwarded headers are only trusted
+// from a trusted proxy, anybody else could set them to dodge the filters.
+// Proxies append the address they saw to X-Forwarded-For, so it is walked
+// from the right up to the first address which is not a trusted proxy, the
+// entries left of it were sent by the client.
+func ClientIP(c *gin.Context) string {
+	remote, trusted := remoteAddr(c)
+	if !trusted {
+		return remote
+	}
+	if forwarded := c.GetHeader("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isTrustedProxy(ip) || i == 0 {
+				return ip.String()
+			}
+		}
+		return remote
+	}
+	if ip := net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+// ProxyHeader returns a header set by a reverse proxy, like ClientIP it is
+// empty unless the request came through a trusted one.
+func ProxyHeader(c *gin.Context, name string) string {
+	if _, trusted := remoteAddr(c); !trusted {
+		return ""
+	}
+	return c.GetHeader(name)
+}
+
+// IPFilter rejects clients outside the allowlist or inside the denylist, the
+// denylist wins. An empty allowlist allows everybody. Paths starting with one
+// of the skipped prefixes are not filtered.
+func IPFilter(allow []*net.IPNet, deny []*net.IPNet, skip ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, prefix := range skip {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
+		ip := net.ParseIP(ClientIP(c))
+		if ip == nil || util.ContainsIP(deny, ip) || (len(allow) > 0 && !util.ContainsIP(allow, ip)) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BanGuard rejects clients which are locked out after too many failed logins.
+func BanGuard(isBanned func(ip string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isBanned(ClientIP(c)) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"msg":     "too many failed logins, try again later",
+				"obj":     nil,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
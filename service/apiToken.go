@@ -0,0 +1,164 @@
+package service
+
+import (
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util"
+)
+
+// How often the last use of a token is written to the database, unless its IP changes
+const tokenTouchInterval = time.Minute
+
+// ApiToken is a valid API token in the cache.
+type ApiToken struct {
+	Id          uint
+	Expiry      int64
+	Username    string
+	Permissions []string
+	Groups      []string // Client groups the token is limited to, nil for all
+
+	hash    string
+	limiter *tokenLimiter // nil for unlimited
+
+	mu        sync.Mutex
+	lastIp    string
+	lastTouch time.Time
+}
+
+// tokenLimiter allows max requests per minute in fixed windows.
+type tokenLimiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Time
+	count  int
+}
+
+func (l *tokenLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.window) >= time.Minute {
+		l.window = now
+		l.count = 0
+	}
+	if l.count >= l.max {
+		return false
+	}
+	l.count++
+	return true
+}
+
+var (
+	tokensMu   sync.RWMutex
+	tokenCache = map[string]*ApiToken{} // By hash
+)
+
+// LoadTokens fills the token cache from the database. Plaintext tokens of
+// older versions are hashed on the way. The rate limit windows of unchanged
+// tokens are kept.
+func (s *UserService) LoadTokens() error {
+	db := database.GetDB()
+	var tokens []model.Tokens
+	err := db.Model(model.Tokens{}).Preload("User").Where("expiry == 0 or expiry > ?", time.Now().Unix()).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	tokensMu.RLock()
+	old := tokenCache
+	tokensMu.RUnlock()
+
+	cache := make(map[string]*ApiToken, len(tokens))
+	for _, t := range tokens {
+		if t.User == nil {
+			continue
+		}
+		permissions, err := TokenPermissions(t.User.Role, t.Scopes)
+		if err != nil {
+			logger.Warning("token ", t.Id, ": ", err)
+			continue
+		}
+		if !util.IsTokenHash(t.Token) {
+			t.Token = util.HashToken(t.Token)
+			err = db.Model(model.Tokens{}).Where("id = ?", t.Id).Update("token", t.Token).Error
+			if err != nil {
+				return err
+			}
+			logger.Info("hashed API token ", t.Id)
+		}
+		token := &ApiToken{
+			Id:          t.Id,
+			Expiry:      t.Expiry,
+			Username:    t.User.Username,
+			Permissions: permissions,
+			Groups:      splitAllowList(t.Groups),
+			hash:        t.Token,
+			lastIp:      t.LastIp,
+		}
+		if t.RateLimit > 0 {
+			if prev, ok := old[t.Token]; ok && prev.limiter != nil && prev.limiter.max == t.RateLimit {
+				token.limiter = prev.limiter
+			} else {
+				token.limiter = &tokenLimiter{max: t.RateLimit}
+			}
+		}
+		cache[t.Token] = token
+	}
+
+	tokensMu.Lock()
+	tokenCache = cache
+	tokensMu.Unlock()
+	return nil
+}
+
+// FindToken returns the cached token, nil if it is unknown or expired. The
+// cache is keyed by hash, so the lookup does not depend on how much of the
+// token matches.
+func (s *UserService) FindToken(token string) *ApiToken {
+	if token == "" {
+		return nil
+	}
+	hash := util.HashToken(token)
+	tokensMu.RLock()
+	t, ok := tokenCache[hash]
+	tokensMu.RUnlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(t.hash), []byte(hash)) != 1 {
+		return nil
+	}
+	if t.Expiry > 0 && t.Expiry < time.Now().Unix() {
+		tokensMu.Lock()
+		delete(tokenCache, hash)
+		tokensMu.Unlock()
+		return nil
+	}
+	return t
+}
+
+// Allow reports whether the token is within its rate limit, and counts the request.
+func (t *ApiToken) Allow() bool {
+	return t.limiter == nil || t.limiter.allow()
+}
+
+// Touch records a use of the token. It is written to the database at most
+// once per tokenTouchInterval, or when the IP changes.
+func (t *ApiToken) Touch(ip string) {
+	t.mu.Lock()
+	now := time.Now()
+	if ip == t.lastIp && now.Sub(t.lastTouch) < tokenTouchInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastIp = ip
+	t.lastTouch = now
+	t.mu.Unlock()
+
+	err := database.GetDB().Model(model.Tokens{}).Where("id = ?", t.Id).
+		Updates(map[string]interface{}{"last_used": now.Unix(), "last_ip": ip}).Error
+	if err != nil {
+		logger.Warning("unable to record the use of token ", t.Id, ": ", err)
+	}
+}
@@ -0,0 +1,761 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"gorm.io/gorm"
+)
+
+// Keys of the changes recorded by the tunnel handlers, next to the objects of
+// Save. Network namespaces and veth pairs live only in the kernel and are not
+// recorded, neither are starts and stops of tunnels.
+const (
+	ChangeGost        = "gost"
+	ChangeMTProto     = "mtproto"
+	ChangeGre         = "gre"
+	ChangeTap         = "tap"
+	ChangeVxlan       = "vxlan"
+	ChangeRoute       = "route"
+	ChangeRule        = "rule"
+	ChangeRouteTable  = "route_table"
+	ChangeUdpTunnel   = "udp_tunnel"
+	ChangeSubTemplate = "subtemplate"
+)
+
+// Objects the panel reloads after reverting a change, if they differ from its key
+var changeReload = map[string]string{
+	ChangeVxlan:      "vxlans",
+	ChangeRoute:      "routing",
+	ChangeRule:       "routing",
+	ChangeRouteTable: "routing",
+	ChangeUdpTunnel:  "udptunnels",
+}
+
+// isTunnelChange reports whether the objects of a change key have no Save
+// function and are reverted through their own service.
+func isTunnelChange(key string) bool {
+	switch key {
+	case ChangeGost, ChangeMTProto, ChangeGre, ChangeTap, ChangeVxlan, ChangeRoute, ChangeRule, ChangeRouteTable, ChangeUdpTunnel, ChangeSubTemplate:
+		return true
+	}
+	return false
+}
+
+// ChangeDiff is a value which differs between the snapshots of a change.
+type ChangeDiff struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// changeModel returns the table of the objects of a change key, nil for keys
+// without objects.
+func changeModel(key string) interface{} {
+	switch key {
+	case "clients":
+		return &model.Client{}
+	case "inbounds":
+		return &model.Inbound{}
+	case "outbounds":
+		return &model.Outbound{}
+	case "endpoints":
+		return &model.Endpoint{}
+	case "services":
+		return &model.Service{}
+	case "tls":
+		return &model.Tls{}
+	case "chisel":
+		return &model.ChiselConfig{}
+	case ChangeGost:
+		return &model.GostConfig{}
+	case ChangeMTProto:
+		return &model.MTProtoProxyConfig{}
+	case ChangeGre:
+		return &model.GreTunnel{}
+	case ChangeTap:
+		return &model.TapTunnel{}
+	case ChangeVxlan:
+		return &model.VxlanTunnel{}
+	case ChangeRoute:
+		return &model.Route{}
+	case ChangeRule:
+		return &model.RouteRule{}
+	case ChangeRouteTable:
+		return &model.RouteTable{}
+	case ChangeUdpTunnel:
+		return &model.UdpTunnelConfig{}
+	case ChangeSubTemplate:
+		return &model.SubTemplate{}
+	}
+	return nil
+}
+
+// Objects whose del action takes the tag instead of the id
+var deleteByTag = map[string]bool{"inbounds": true, "outbounds": true, "endpoints": true, "services": true}
+
+func isNull(data json.RawMessage) bool {
+	return len(data) == 0 || string(data) == "null"
+}
+
+// snapshot returns an object in the form its Save function accepts, nil if
+// it does not exist.
+func snapshot(db *gorm.DB, key string, id uint) (json.RawMessage, error) {
+	dest := changeModel(key)
+	if dest == nil || id == 0 {
+		return nil, nil
+	}
+	result := db.Model(dest).Where("id = ?", id).Limit(1).Find(dest)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	var data interface{}
+	var err error
+	switch obj := dest.(type) {
+	case *model.Inbound:
+		data, err = obj.MarshalFull()
+	case *model.Service:
+		data, err = obj.MarshalFull()
+	case *model.Outbound:
+		data, err = outboundData(obj)
+	case *model.Endpoint:
+		data, err = endpointData(obj)
+	default:
+		data = dest
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// changeRef returns the id of the object a saved change refers to, 0 for new objects.
+func changeRef(db *gorm.DB, key string, act string, data json.RawMessage) (uint, error) {
+	switch act {
+	case "edit", "update":
+		var obj map[string]interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return 0, err
+		}
+		for _, field := range []string{"id", "ID"} {
+			if id, ok := obj[field].(float64); ok {
+				return uint(id), nil
+			}
+		}
+	case "del":
+		if deleteByTag[key] {
+			var tag string
+			if err := json.Unmarshal(data, &tag); err != nil {
+				return 0, err
+			}
+			var id uint
+			err := db.Model(changeModel(key)).Select("id").Where("tag = ?", tag).Scan(&id).Error
+			return id, err
+		}
+		var id uint
+		err := json.Unmarshal(data, &id)
+		return id, err
+	}
+	return 0, nil
+}
+
+// snapshotBefore fills the reference and the state before a change of Save,
+// and returns the highest id for actions which create objects.
+func snapshotBefore(db *gorm.DB, change *model.Changes) (uint, error) {
+	var err error
+	switch change.Key {
+	case "settings":
+		var settings map[string]string
+		if err = json.Unmarshal(change.Obj, &settings); err != nil {
+			return 0, err
+		}
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		var rows []model.Setting
+		if err = db.Model(model.Setting{}).Where("key in ?", keys).Find(&rows).Error; err != nil {
+			return 0, err
+		}
+		before := make(map[string]string, len(rows))
+		for _, row := range rows {
+			before[row.Key] = row.Value
+		}
+		change.Before, err = json.Marshal(before)
+		return 0, err
+	case "config":
+		var config string
+		if err = db.Model(model.Setting{}).Select("value").Where("key = ?", "config").Scan(&config).Error; err != nil {
+			return 0, err
+		}
+		if json.Valid([]byte(config)) {
+			change.Before = json.RawMessage(config)
+		}
+		return 0, nil
+	}
+
+	change.Ref, err = changeRef(db, change.Key, change.Action, change.Obj)
+	if err != nil {
+		return 0, err
+	}
+	if change.Ref > 0 {
+		change.Before, err = snapshot(db, change.Key, change.Ref)
+		return 0, err
+	}
+	var lastId uint
+	err = db.Unscoped().Model(changeModel(change.Key)).Select("coalesce(max(id), 0)").Scan(&lastId).Error
+	return lastId, err
+}
+
+// snapshotAfter fills the state after a change of Save. Objects created by the
+// change are the ones above lastId.
+func snapshotAfter(db *gorm.DB, change *model.Changes, lastId uint) error {
+	switch change.Key {
+	case "settings", "config":
+		change.After = change.Obj
+		return nil
+	}
+	var err error
+	if change.Ref == 0 {
+		var ids []uint
+		err = db.Model(changeModel(change.Key)).Where("id > ?", lastId).Order("id").Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) > 1 {
+			objs := make([]json.RawMessage, 0, len(ids))
+			for _, id := range ids {
+				obj, err := snapshot(db, change.Key, id)
+				if err != nil {
+					return err
+				}
+				objs = append(objs, obj)
+			}
+			change.After, err = json.Marshal(objs)
+			return err
+		}
+		if len(ids) == 1 {
+			change.Ref = ids[0]
+		}
+	}
+	change.After, err = snapshot(db, change.Key, change.Ref)
+	return err
+}
+
+// Snapshot returns the current state of an object of the change log, nil if
+// it does not exist.
+func (s *ConfigService) Snapshot(key string, id uint) json.RawMessage {
+	data, err := snapshot(database.GetDB(), key, id)
+	if err != nil {
+		logger.Warning("unable to read ", key, " ", id, " for the change log: ", err)
+	}
+	return data
+}
+
+// RecordChange writes a change made outside Save to the change log, before
+// is the Snapshot from before the change.
+func (s *ConfigService) RecordChange(key string, act string, actor string, id uint, before json.RawMessage) {
+	s.recordChange(key, act, actor, id, before, 0)
+}
+
+func (s *ConfigService) recordChange(key string, act string, actor string, id uint, before json.RawMessage, revertOf uint64) {
+	db := database.GetDB()
+	after, err := snapshot(db, key, id)
+	if err != nil {
+		logger.Warning("unable to read ", key, " ", id, " for the change log: ", err)
+	}
+	obj, _ := json.Marshal(id)
+	dt := time.Now().Unix()
+	err = db.Create(&model.Changes{
+		DateTime: dt,
+		Actor:    actor,
+		Key:      key,
+		Action:   act,
+		Obj:      obj,
+		Ref:      id,
+		Before:   before,
+		After:    after,
+		RevertOf: revertOf,
+	}).Error
+	if err != nil {
+		logger.Warning("unable to record the change of ", key, " ", id, ": ", err)
+		return
+	}
+	LastUpdate = dt
+}
+
+// GetChange returns a change with the differences between its snapshots.
+func (s *ConfigService) GetChange(id uint64) (*model.Changes, []ChangeDiff, error) {
+	var change model.Changes
+	err := database.GetDB().Model(model.Changes{}).Where("id = ?", id).First(&change).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	diff, err := diffJSON(change.Before, change.After)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &change, diff, nil
+}
+
+// diffJSON returns the values which differ between two JSON documents, with
+// paths like outbounds[1].tag.
+func diffJSON(before json.RawMessage, after json.RawMessage) ([]ChangeDiff, error) {
+	var a, b interface{}
+	if !isNull(before) {
+		if err := json.Unmarshal(before, &a); err != nil {
+			return nil, err
+		}
+	}
+	if !isNull(after) {
+		if err := json.Unmarshal(after, &b); err != nil {
+			return nil, err
+		}
+	}
+	diff := []ChangeDiff{}
+	diffValues("", a, b, &diff)
+	return diff, nil
+}
+
+func diffValues(path string, a interface{}, b interface{}, diff *[]ChangeDiff) {
+	// A created or deleted object is compared field by field with nothing
+	if a == nil {
+		switch b.(type) {
+		case map[string]interface{}:
+			a = map[string]interface{}{}
+		case []interface{}:
+			a = []interface{}{}
+		}
+	} else if b == nil {
+		switch a.(type) {
+		case map[string]interface{}:
+			b = map[string]interface{}{}
+		case []interface{}:
+			b = []interface{}{}
+		}
+	}
+
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := make([]string, 0, len(mapA)+len(mapB))
+		for key := range mapA {
+			keys = append(keys, key)
+		}
+		for key := range mapB {
+			if _, ok := mapA[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			subPath := key
+			if path != "" {
+				subPath = path + "." + key
+			}
+			diffValues(subPath, mapA[key], mapB[key], diff)
+		}
+		return
+	}
+
+	listA, okA := a.([]interface{})
+	listB, okB := b.([]interface{})
+	if okA && okB {
+		for i := 0; i < max(len(listA), len(listB)); i++ {
+			var itemA, itemB interface{}
+			if i < len(listA) {
+				itemA = listA[i]
+			}
+			if i < len(listB) {
+				itemB = listB[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), itemA, itemB, diff)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*diff = append(*diff, ChangeDiff{Path: path, Before: a, After: b})
+	}
+}
+
+// Revert restores the state from before a change through the Save function
+// of its object. The revert is recorded as a change of its own.
+func (s *ConfigService) Revert(id uint64, actor string, hostname string) ([]string, error) {
+	db := database.GetDB()
+	var change model.Changes
+	err := db.Model(model.Changes{}).Where("id = ?", id).First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	if isNull(change.Before) && isNull(change.After) {
+		return nil, common.NewErrorf("change %d has no snapshots to revert to", id)
+	}
+
+	switch change.Key {
+	case "settings", "config":
+		return s.save(change.Key, "revert", change.Before, "", actor, hostname, change.Id)
+	}
+	if isTunnelChange(change.Key) {
+		reload := change.Key
+		if obj, ok := changeReload[change.Key]; ok {
+			reload = obj
+		}
+		return []string{reload}, s.revertTunnel(&change, actor)
+	}
+	if changeModel(change.Key) == nil {
+		return nil, common.NewErrorf("changes of %s can not be reverted", change.Key)
+	}
+
+	if change.Action == "addbulk" {
+		var clients []struct {
+			Id uint `json:"id"`
+		}
+		if err = json.Unmarshal(change.After, &clients); err != nil {
+			return nil, err
+		}
+		var objs []string
+		for _, client := range clients {
+			data, _ := json.Marshal(client.Id)
+			objs, err = s.save(change.Key, "del", data, "", actor, hostname, change.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return objs, nil
+	}
+
+	current, err := snapshot(db, change.Key, change.Ref)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isNull(change.Before):
+		if current == nil {
+			return nil, common.NewErrorf("%s %d does not exist anymore", change.Key, change.Ref)
+		}
+		data, err := deleteData(change.Key, current)
+		if err != nil {
+			return nil, err
+		}
+		return s.save(change.Key, "del", data, "", actor, hostname, change.Id)
+	case current == nil:
+		if change.Key == "chisel" {
+			// Free the id and the name of the soft deleted row
+			if err = db.Unscoped().Delete(&model.ChiselConfig{}, change.Ref).Error; err != nil {
+				return nil, err
+			}
+		}
+		return s.save(change.Key, "new", change.Before, "", actor, hostname, change.Id)
+	default:
+		act := "edit"
+		data := change.Before
+		switch change.Key {
+		case "chisel":
+			act = "update"
+		case "clients":
+			data, err = keepClientState(data, current)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return s.save(change.Key, act, data, "", actor, hostname, change.Id)
+	}
+}
+
+// keepClientState copies what is not the admin's configuration from the
+// current snapshot of a client into an older one: the usage, the subscription
+// token and the fields of the reset and hold jobs. A client which was
+// activated since keeps its expiry too.
+func keepClientState(before json.RawMessage, current json.RawMessage) (json.RawMessage, error) {
+	var old, now map[string]interface{}
+	if err := json.Unmarshal(before, &old); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(current, &now); err != nil {
+		return nil, err
+	}
+	keep := []string{"up", "down", "subToken", "lastReset", "holdSince"}
+	if old["onHold"] == true && now["onHold"] != true {
+		keep = append(keep, "onHold", "expiry")
+	}
+	for _, field := range keep {
+		old[field] = now[field]
+	}
+	return json.Marshal(old)
+}
+
+// deleteData returns the data of the del action of an object from its snapshot.
+func deleteData(key string, obj json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(obj, &fields); err != nil {
+		return nil, err
+	}
+	if deleteByTag[key] {
+		return json.Marshal(fields["tag"])
+	}
+	if id, ok := fields["id"]; ok {
+		return json.Marshal(id)
+	}
+	return json.Marshal(fields["ID"])
+}
+
+// revertTunnel restores a tunnel, a route or a template through its service,
+// they have no Save function. Recreated objects keep their id.
+func (s *ConfigService) revertTunnel(change *model.Changes, actor string) error {
+	db := database.GetDB()
+	current, err := snapshot(db, change.Key, change.Ref)
+	if err != nil {
+		return err
+	}
+	var act string
+	switch {
+	case isNull(change.Before):
+		if current == nil {
+			return common.NewErrorf("%s %d does not exist anymore", change.Key, change.Ref)
+		}
+		act = "del"
+		err = s.deleteTunnel(change.Key, change.Ref)
+	case current == nil:
+		act = "new"
+		// Free the id and the name of the soft deleted row
+		if err = db.Unscoped().Delete(changeModel(change.Key), change.Ref).Error; err != nil {
+			return err
+		}
+		err = s.createTunnel(change.Key, change.Before)
+	default:
+		act = "edit"
+		err = s.updateTunnel(change.Key, change.Before, current)
+	}
+	if err != nil {
+		return err
+	}
+	s.recordChange(change.Key, act, actor, change.Ref, current, change.Id)
+	return nil
+}
+
+func (s *ConfigService) deleteTunnel(key string, id uint) error {
+	switch key {
+	case ChangeGost:
+		return s.gostService().DeleteGostConfig(id)
+	case ChangeMTProto:
+		return NewMTProtoService().DeleteMTProtoProxy(id)
+	case ChangeGre:
+		return s.greService().DeleteGreTunnel(id)
+	case ChangeTap:
+		return s.tapService().DeleteTapTunnel(id)
+	case ChangeVxlan:
+		return s.vxlanService().DeleteVxlanTunnel(id)
+	case ChangeRoute:
+		return s.routingService().DeleteRoute(id)
+	case ChangeRule:
+		return s.routingService().DeleteRouteRule(id)
+	case ChangeRouteTable:
+		return s.routingService().DeleteRouteTable(id)
+	case ChangeUdpTunnel:
+		return s.udpTunnelService().DeleteUdpTunnel(id)
+	case ChangeSubTemplate:
+		var subTemplateService SubTemplateService
+		return subTemplateService.Delete(id)
+	}
+	return common.NewErrorf("unknown object: %s", key)
+}
+
+func (s *ConfigService) createTunnel(key string, data json.RawMessage) error {
+	switch key {
+	case ChangeGost:
+		var cfg model.GostConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = "down"
+		return s.gostService().CreateGostConfig(&cfg)
+	case ChangeMTProto:
+		var cfg model.MTProtoProxyConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = "down"
+		return NewMTProtoService().CreateMTProtoProxy(&cfg)
+	case ChangeGre:
+		var cfg model.GreTunnel
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		return s.greService().CreateGreTunnel(&cfg)
+	case ChangeTap:
+		var cfg model.TapTunnel
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		return s.tapService().CreateTapTunnel(&cfg)
+	case ChangeVxlan:
+		var cfg model.VxlanTunnel
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		return s.vxlanService().CreateVxlanTunnel(&cfg)
+	case ChangeRoute:
+		var route model.Route
+		if err := json.Unmarshal(data, &route); err != nil {
+			return err
+		}
+		return s.routingService().CreateRoute(&route)
+	case ChangeRule:
+		var rule model.RouteRule
+		if err := json.Unmarshal(data, &rule); err != nil {
+			return err
+		}
+		return s.routingService().CreateRouteRule(&rule)
+	case ChangeRouteTable:
+		var table model.RouteTable
+		if err := json.Unmarshal(data, &table); err != nil {
+			return err
+		}
+		return s.routingService().CreateRouteTable(&table)
+	case ChangeUdpTunnel:
+		var cfg model.UdpTunnelConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = "stopped"
+		return s.udpTunnelService().CreateUdpTunnel(&cfg)
+	case ChangeSubTemplate:
+		var template model.SubTemplate
+		if err := json.Unmarshal(data, &template); err != nil {
+			return err
+		}
+		var subTemplateService SubTemplateService
+		return subTemplateService.Save(&template)
+	}
+	return common.NewErrorf("unknown object: %s", key)
+}
+
+// updateTunnel restores the configuration of a tunnel, its status stays.
+func (s *ConfigService) updateTunnel(key string, data json.RawMessage, current json.RawMessage) error {
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(current, &status); err != nil {
+		return err
+	}
+	switch key {
+	case ChangeGost:
+		var cfg model.GostConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = status.Status
+		return database.GetDB().Save(&cfg).Error
+	case ChangeMTProto:
+		var cfg model.MTProtoProxyConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = status.Status
+		return NewMTProtoService().UpdateMTProtoProxy(&cfg)
+	case ChangeVxlan:
+		return s.revertFdbEntries(data, current)
+	case ChangeUdpTunnel:
+		var cfg model.UdpTunnelConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return err
+		}
+		cfg.Status = status.Status
+		return s.udpTunnelService().UpdateUdpTunnel(&cfg)
+	case ChangeSubTemplate:
+		var template model.SubTemplate
+		if err := json.Unmarshal(data, &template); err != nil {
+			return err
+		}
+		var subTemplateService SubTemplateService
+		return subTemplateService.Save(&template)
+	}
+	return common.NewErrorf("%s tunnels can not be edited, delete and recreate them", key)
+}
+
+// revertFdbEntries restores the static FDB entries of an overlay tunnel, the
+// only part of it which can be edited.
+func (s *ConfigService) revertFdbEntries(data json.RawMessage, current json.RawMessage) error {
+	var before, after model.VxlanTunnel
+	if err := json.Unmarshal(data, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(current, &after); err != nil {
+		return err
+	}
+	beforeEntries, err := parseFdbEntries(before.FdbEntries)
+	if err != nil {
+		return err
+	}
+	afterEntries, err := parseFdbEntries(after.FdbEntries)
+	if err != nil {
+		return err
+	}
+	for _, entry := range afterEntries {
+		if !slices.Contains(beforeEntries, entry) {
+			if err = s.vxlanService().DeleteVxlanFdbEntry(after.ID, entry); err != nil {
+				return err
+			}
+		}
+	}
+	for _, entry := range beforeEntries {
+		if !slices.Contains(afterEntries, entry) {
+			if err = s.vxlanService().AddVxlanFdbEntry(after.ID, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ConfigService) gostService() *GostService {
+	if s.Gost == nil {
+		return NewGostService()
+	}
+	return s.Gost
+}
+
+func (s *ConfigService) greService() *GreService {
+	if s.Gre == nil {
+		return NewGreService()
+	}
+	return s.Gre
+}
+
+func (s *ConfigService) tapService() *TapService {
+	if s.Tap == nil {
+		return NewTapService()
+	}
+	return s.Tap
+}
+
+func (s *ConfigService) vxlanService() *VxlanService {
+	if s.Vxlan == nil {
+		return NewVxlanService()
+	}
+	return s.Vxlan
+}
+
+func (s *ConfigService) routingService() *RoutingService {
+	if s.Routing == nil {
+		return NewRoutingService()
+	}
+	return s.Routing
+}
+
+func (s *ConfigService) udpTunnelService() *UdpTunnelService {
+	if s.UdpTunnel == nil {
+		return NewUdpTunnelService(database.GetDB())
+	}
+	return s.UdpTunnel
+}
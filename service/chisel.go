@@ -12,6 +12,7 @@ import (
 
 	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
 	chclient "github.com/jpillora/chisel/client"
 	chserver "github.com/jpillora/chisel/server"
 )
@@ -275,8 +276,28 @@ func (s *ChiselService) StartChisel(config *model.ChiselConfig) error {
 					log.Printf("Error running chisel service '%s': %v", cfg.Name, runErr)
 				} else if runErr == nil { // If Start was successful, wait for context cancellation
 					log.Printf("ChiselService: Goroutine: Chisel service '%s' (ID: %d) started successfully, waiting for context cancellation.", cfg.Name, cfg.ID)
-					<-ctx.Done() // Block until context is cancelled
-					log.Printf("ChiselService: Goroutine: Context cancelled for '%s' (ID: %d).", cfg.Name, cfg.ID)
+					if cfg.Mode == "client" {
+						// The client gives up once the connection to its server is lost
+						lost := make(chan struct{})
+						go func() {
+							client.Wait()
+							close(lost)
+						}()
+						select {
+						case <-ctx.Done():
+						case <-lost:
+						}
+					} else {
+						<-ctx.Done() // Block until context is cancelled
+					}
+					if ctx.Err() == nil {
+						log.Printf("ChiselService: Goroutine: Chisel client '%s' (ID: %d) lost its server.", cfg.Name, cfg.ID)
+						events.Publish(events.ChiselDisconnected,
+							fmt.Sprintf("chisel client '%s' lost its server %s:%d", cfg.Name, cfg.ServerAddress, cfg.ServerPort),
+							map[string]interface{}{"id": cfg.ID, "name": cfg.Name, "server": fmt.Sprintf("%s:%d", cfg.ServerAddress, cfg.ServerPort)})
+					} else {
+						log.Printf("ChiselService: Goroutine: Context cancelled for '%s' (ID: %d).", cfg.Name, cfg.ID)
+					}
 				}	}(config, chiselClient, chiselServer) // Pass client/server instance to the goroutine
 
 	return nil
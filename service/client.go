@@ -3,11 +3,13 @@ package service
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
 	"github.com/igor04091968/sing-chisel-tel/logger"
 	"github.com/igor04091968/sing-chisel-tel/util"
 	"github.com/igor04091968/sing-chisel-tel/util/common"
@@ -38,7 +40,7 @@ func (s *ClientService) getById(id string) (*[]model.Client, error) {
 func (s *ClientService) GetAllUsers() (*[]model.Client, error) {
 	db := database.GetDB()
 	var clients []model.Client
-	err := db.Model(model.Client{}).Select("`id`, `enable`, `name`, `desc`, `group`, `inbounds`, `up`, `down`, `volume`, `expiry`").Scan(&clients).Error
+	err := db.Model(model.Client{}).Select("`id`, `enable`, `name`, `desc`, `group`, `inbounds`, `up`, `down`, `volume`, `expiry`, `on_hold`, `duration`").Scan(&clients).Error
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +58,24 @@ func (s *ClientService) Save(tx *gorm.DB, act string, data json.RawMessage, host
 		if err != nil {
 			return nil, err
 		}
+		err = checkResetPolicy(&client)
+		if err != nil {
+			return nil, err
+		}
+		err = checkHold(&client)
+		if err != nil {
+			return nil, err
+		}
+		if client.MaxIps < 0 {
+			return nil, common.NewError("the IP limit can not be negative")
+		}
+		if client.UpLimit < 0 || client.DownLimit < 0 {
+			return nil, common.NewError("the rate limits can not be negative")
+		}
+		err = s.prepareSubAccess(tx, &client)
+		if err != nil {
+			return nil, err
+		}
 		err = s.updateLinksWithFixedInbounds(tx, []*model.Client{&client}, hostname)
 		if err != nil {
 			return nil, err
@@ -86,6 +106,20 @@ func (s *ClientService) Save(tx *gorm.DB, act string, data json.RawMessage, host
 		if err != nil {
 			return nil, err
 		}
+		for _, client := range clients {
+			err = checkResetPolicy(client)
+			if err != nil {
+				return nil, err
+			}
+			err = checkHold(client)
+			if err != nil {
+				return nil, err
+			}
+			err = s.prepareSubAccess(tx, client)
+			if err != nil {
+				return nil, err
+			}
+		}
 		err = s.updateLinksWithFixedInbounds(tx, clients, hostname)
 		if err != nil {
 			return nil, err
@@ -113,6 +147,19 @@ func (s *ClientService) Save(tx *gorm.DB, act string, data json.RawMessage, host
 		if err != nil {
 			return nil, err
 		}
+		// Drop the Telegram links of the client
+		err = tx.Where("client_id = ?", id).Delete(model.TgBinding{}).Error
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Where("client_id = ?", id).Delete(model.TgBindCode{}).Error
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Where("client_id = ?", id).Delete(model.ClientUsage{}).Error
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, common.NewErrorf("unknown action: %s", act)
 	}
@@ -316,6 +363,11 @@ func (s *ClientService) DepleteClients() ([]uint, error) {
 	defer func() {
 		if err == nil {
 			tx.Commit()
+			if len(users) > 0 {
+				events.Publish(events.ClientsDepleted,
+					fmt.Sprintf("%d client(s) disabled for exceeding volume or expiry: %s", len(users), strings.Join(users, ", ")),
+					map[string]interface{}{"clients": users})
+			}
 		} else {
 			tx.Rollback()
 		}
@@ -334,12 +386,18 @@ func (s *ClientService) DepleteClients() ([]uint, error) {
 		json.Unmarshal(client.Inbounds, &userInbounds)
 		// Find changed inbounds
 		inboundIds = common.UnionUintArray(inboundIds, userInbounds)
+		before, err := snapshot(tx, "clients", client.Id)
+		if err != nil {
+			return nil, err
+		}
 		changes = append(changes, model.Changes{
 			DateTime: dt,
 			Actor:    "DepleteJob",
 			Key:      "clients",
 			Action:   "disable",
 			Obj:      json.RawMessage("\"" + client.Name + "\""),
+			Ref:      client.Id,
+			Before:   before,
 		})
 	}
 
@@ -349,6 +407,12 @@ func (s *ClientService) DepleteClients() ([]uint, error) {
 		if err != nil {
 			return nil, err
 		}
+		for i := range changes {
+			changes[i].After, err = snapshot(tx, "clients", changes[i].Ref)
+			if err != nil {
+				return nil, err
+			}
+		}
 		err = tx.Model(model.Changes{}).Create(&changes).Error
 		if err != nil {
 			return nil, err
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"gorm.io/gorm"
+)
+
+// GetInGroups returns the clients of some groups, like Get.
+func (s *ClientService) GetInGroups(id string, groups []string) (*[]model.Client, error) {
+	clients, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	result := []model.Client{}
+	for _, client := range *clients {
+		if slices.Contains(groups, client.Group) {
+			result = append(result, client)
+		}
+	}
+	return &result, nil
+}
+
+// GetInGroups returns the inbounds like Get, their users are only the clients
+// of some groups.
+func (s *InboundService) GetInGroups(ids string, groups []string) (*[]map[string]interface{}, error) {
+	inbounds, err := s.Get(ids)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	err = database.GetDB().Model(model.Client{}).Where("`group` in ?", groups).Pluck("name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range *inbounds {
+		users, ok := inbound["users"].([]string)
+		if !ok {
+			continue
+		}
+		allowed := []string{}
+		for _, user := range users {
+			if slices.Contains(names, user) {
+				allowed = append(allowed, user)
+			}
+		}
+		inbound["users"] = allowed
+	}
+	return inbounds, nil
+}
+
+// CheckClientGroups returns an error if a client is not in one of the groups.
+func (s *ClientService) CheckClientGroups(id uint, groups []string) error {
+	var group string
+	err := database.GetDB().Model(model.Client{}).Select("`group`").Where("id = ?", id).Scan(&group).Error
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(groups, group) {
+		return common.NewErrorf("client %d is not in the allowed groups", id)
+	}
+	return nil
+}
+
+// CheckSaveGroups returns an error if saving clients touches clients outside
+// the groups, before or after the change.
+func (s *ClientService) CheckSaveGroups(act string, data json.RawMessage, groups []string) error {
+	var clients []model.Client
+	switch act {
+	case "new", "edit":
+		var client model.Client
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		clients = append(clients, client)
+	case "addbulk":
+		if err := json.Unmarshal(data, &clients); err != nil {
+			return err
+		}
+	case "del":
+		var id uint
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		return s.CheckClientGroups(id, groups)
+	default:
+		return common.NewErrorf("unknown action: %s", act)
+	}
+	for _, client := range clients {
+		if !slices.Contains(groups, client.Group) {
+			return common.NewErrorf("group %q is not allowed", client.Group)
+		}
+		if client.Id > 0 {
+			if err := s.CheckClientGroups(client.Id, groups); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckChangeGroups returns an error if a change of the change log touches
+// something else than clients of the groups, in its snapshots or now.
+func (s *ClientService) CheckChangeGroups(change *model.Changes, groups []string) error {
+	if change.Key != "clients" {
+		return common.NewError("permission denied, the token is limited to client groups")
+	}
+	var ids []uint
+	for _, data := range []json.RawMessage{change.Before, change.After} {
+		if isNull(data) {
+			continue
+		}
+		// A snapshot is one client, or a list of them for bulk additions
+		var clients []model.Client
+		if err := json.Unmarshal(data, &clients); err != nil {
+			var client model.Client
+			if err := json.Unmarshal(data, &client); err != nil {
+				return err
+			}
+			clients = append(clients, client)
+		}
+		for _, client := range clients {
+			if !slices.Contains(groups, client.Group) {
+				return common.NewErrorf("group %q is not allowed", client.Group)
+			}
+			ids = append(ids, client.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return common.NewErrorf("change %d has no client snapshots", change.Id)
+	}
+	// The clients may have been moved since
+	var current []string
+	err := database.GetDB().Model(model.Client{}).Where("id in ?", ids).Pluck("group", &current).Error
+	if err != nil {
+		return err
+	}
+	for _, group := range current {
+		if !slices.Contains(groups, group) {
+			return common.NewErrorf("group %q is not allowed", group)
+		}
+	}
+	return nil
+}
+
+// GetChangesInGroups returns the latest client changes like GetChanges, only
+// those which CheckChangeGroups allows.
+func (s *ConfigService) GetChangesInGroups(actor string, count string, groups []string) []model.Changes {
+	const batchSize = 100
+	c, _ := strconv.Atoi(count)
+	query := database.GetDB().Model(model.Changes{}).Where("`key` = ?", "clients")
+	if len(actor) > 0 {
+		query = query.Where("`actor` = ?", actor)
+	}
+	query = query.Session(&gorm.Session{})
+	chngs := []model.Changes{}
+	for offset := 0; ; offset += batchSize {
+		var batch []model.Changes
+		err := query.Order("`id` desc").Offset(offset).Limit(batchSize).Find(&batch).Error
+		if err != nil {
+			logger.Warning(err)
+			return chngs
+		}
+		for _, change := range batch {
+			if s.ClientService.CheckChangeGroups(&change, groups) != nil {
+				continue
+			}
+			change.Before, change.After = nil, nil
+			chngs = append(chngs, change)
+			if c > 0 && len(chngs) >= c {
+				return chngs
+			}
+		}
+		if len(batch) < batchSize {
+			return chngs
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"gorm.io/gorm"
+)
+
+// checkHold validates the on hold state of a client. On hold clients have no
+// expiry until they are activated.
+func checkHold(client *model.Client) error {
+	if !client.OnHold {
+		client.HoldSince = 0
+		return nil
+	}
+	if client.Duration < 1 {
+		return common.NewError("on hold clients need a duration of at least one day")
+	}
+	if client.HoldMax < 0 {
+		return common.NewError("the maximum on hold period can not be negative")
+	}
+	client.Expiry = 0
+	if client.HoldSince == 0 {
+		client.HoldSince = time.Now().Unix()
+	}
+	return nil
+}
+
+// activateClients starts the clock of the on hold clients which had traffic.
+func activateClients(tx *gorm.DB, names []string, now int64) error {
+	if len(names) == 0 {
+		return nil
+	}
+	result := tx.Model(model.Client{}).Where("on_hold = true AND name in ?", names).Updates(map[string]interface{}{
+		"on_hold":    false,
+		"expiry":     gorm.Expr("? + duration * 86400", now),
+		"hold_since": 0,
+		"last_reset": 0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		logger.Info(result.RowsAffected, " on hold client(s) activated by their first traffic")
+		LastUpdate = now
+	}
+	return nil
+}
+
+// ActivateHeldClients starts the clock of the clients which were on hold for
+// longer than their maximum period. Their expiry counts from the end of that period.
+func (s *ClientService) ActivateHeldClients() error {
+	var clients []model.Client
+	now := time.Now().Unix()
+	db := database.GetDB()
+	err := db.Model(model.Client{}).Where("on_hold = true AND hold_max > 0 AND hold_since + hold_max * 86400 < ?", now).Scan(&clients).Error
+	if err != nil || len(clients) == 0 {
+		return err
+	}
+	var users []string
+	for _, client := range clients {
+		users = append(users, client.Name)
+	}
+	err = db.Model(model.Client{}).Where("on_hold = true AND hold_max > 0 AND hold_since + hold_max * 86400 < ?", now).Updates(map[string]interface{}{
+		"on_hold":    false,
+		"expiry":     gorm.Expr("hold_since + (hold_max + duration) * 86400"),
+		"hold_since": 0,
+		"last_reset": 0,
+	}).Error
+	if err != nil {
+		return err
+	}
+	logger.Info(len(users), " client(s) activated after their maximum on hold period: ", strings.Join(users, ", "))
+	LastUpdate = now
+	return nil
+}
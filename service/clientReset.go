@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+// Reset modes of the usage of clients
+const (
+	ResetDaily   = "daily"
+	ResetWeekly  = "weekly"
+	ResetMonthly = "monthly"
+	ResetDays    = "days" // Every ResetDay days after the activation
+)
+
+func checkResetPolicy(client *model.Client) error {
+	switch client.ResetMode {
+	case "", ResetDaily:
+	case ResetWeekly:
+		if client.ResetDay < 0 || client.ResetDay > 6 {
+			return common.NewError("the reset weekday must be between 0 (Sunday) and 6")
+		}
+	case ResetMonthly:
+		if client.ResetDay < 1 || client.ResetDay > 31 {
+			return common.NewError("the reset day of the month must be between 1 and 31")
+		}
+	case ResetDays:
+		if client.ResetDay < 1 {
+			return common.NewError("the reset period must be at least one day")
+		}
+	default:
+		return common.NewErrorf("unknown reset mode: %s", client.ResetMode)
+	}
+	return nil
+}
+
+// nextReset returns the end of the period which starts at start. Periods end
+// at midnight, except those counted in days.
+func nextReset(mode string, day int, start time.Time) time.Time {
+	y, m, d := start.Date()
+	loc := start.Location()
+	switch mode {
+	case ResetDaily:
+		return time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	case ResetWeekly:
+		days := (day - int(start.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return time.Date(y, m, d+days, 0, 0, 0, 0, loc)
+	case ResetMonthly:
+		next := time.Date(y, m, monthDay(y, m, day), 0, 0, 0, 0, loc)
+		if !next.After(start) {
+			next = time.Date(y, m+1, monthDay(y, m+1, day), 0, 0, 0, 0, loc)
+		}
+		return next
+	case ResetDays:
+		return start.AddDate(0, 0, day)
+	}
+	return time.Time{}
+}
+
+// monthDay caps day to the length of the month, so day 31 resets on the last
+// day of shorter months.
+func monthDay(y int, m time.Month, day int) int {
+	return min(day, time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day())
+}
+
+// ResetClients archives the usage of the clients whose period ended and
+// starts their next period. Clients which were disabled only for exceeding
+// their volume are enabled again. It returns the inbounds to restart.
+func (s *ClientService) ResetClients(loc *time.Location) ([]uint, error) {
+	var err error
+	var clients []model.Client
+	var changes []model.Changes
+	var users []string
+	var inboundIds []uint
+
+	now := time.Now()
+	db := database.GetDB()
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+			if len(users) > 0 {
+				logger.Info("usage of ", len(users), " client(s) was reset: ", strings.Join(users, ", "))
+			}
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.Model(model.Client{}).Where("reset_mode <> '' AND on_hold = false").Scan(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, client := range clients {
+		if client.LastReset == 0 {
+			// The first period starts at the activation of the policy, or of
+			// the client if it was on hold
+			err = tx.Model(model.Client{}).Where("id = ?", client.Id).Update("last_reset", now.Unix()).Error
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		end := nextReset(client.ResetMode, client.ResetDay, time.Unix(client.LastReset, 0).In(loc))
+		if end.IsZero() || end.After(now) {
+			continue
+		}
+		// Skip the periods which passed while the panel was down
+		for next := nextReset(client.ResetMode, client.ResetDay, end); !next.After(now); next = nextReset(client.ResetMode, client.ResetDay, next) {
+			end = next
+		}
+
+		err = tx.Create(&model.ClientUsage{
+			ClientId: client.Id,
+			Start:    client.LastReset,
+			End:      end.Unix(),
+			Up:       client.Up,
+			Down:     client.Down,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+		updates := map[string]interface{}{"up": 0, "down": 0, "last_reset": end.Unix()}
+
+		expired := client.Expiry > 0 && client.Expiry < now.Unix()
+		depleted := client.Volume > 0 && client.Up+client.Down > client.Volume
+		enable := !client.Enable && depleted && !expired
+		var before json.RawMessage
+		if enable {
+			before, err = snapshot(tx, "clients", client.Id)
+			if err != nil {
+				return nil, err
+			}
+			updates["enable"] = true
+			var userInbounds []uint
+			json.Unmarshal(client.Inbounds, &userInbounds)
+			inboundIds = common.UnionUintArray(inboundIds, userInbounds)
+		}
+		err = tx.Model(model.Client{}).Where("id = ?", client.Id).Updates(updates).Error
+		if err != nil {
+			return nil, err
+		}
+		if enable {
+			after, err := snapshot(tx, "clients", client.Id)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, model.Changes{
+				DateTime: now.Unix(),
+				Actor:    "ResetJob",
+				Key:      "clients",
+				Action:   "enable",
+				Obj:      json.RawMessage("\"" + client.Name + "\""),
+				Ref:      client.Id,
+				Before:   before,
+				After:    after,
+			})
+		}
+		users = append(users, client.Name)
+	}
+
+	if len(changes) > 0 {
+		err = tx.Model(model.Changes{}).Create(&changes).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(users) > 0 {
+		LastUpdate = now.Unix()
+	}
+	return inboundIds, nil
+}
+
+// GetUsage returns the usage of a client in its past reset periods, the latest first.
+func (s *ClientService) GetUsage(id uint) ([]model.ClientUsage, error) {
+	var usage []model.ClientUsage
+	err := database.GetDB().Model(model.ClientUsage{}).Where("client_id = ?", id).Order("id desc").Find(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
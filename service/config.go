@@ -26,6 +26,14 @@ type ConfigService struct {
 	ServicesService
 	EndpointService
 	Chisel *ChiselService
+
+	// Services of the tunnels reverted from the change log, new ones are made if nil
+	Gost      *GostService
+	Gre       *GreService
+	Tap       *TapService
+	Vxlan     *VxlanService
+	Routing   *RoutingService
+	UdpTunnel *UdpTunnelService
 }
 
 type SingBoxConfig struct {
@@ -98,9 +106,15 @@ func (s *ConfigService) StartCore(defaultConfig string) error {
 		return err
 	}
 	logger.Info("sing-box started")
+	s.LoadIpLimits()
+	s.LoadRateLimits()
 	return nil
 }
 
+func (s *ConfigService) IsCoreRunning() bool {
+	return corePtr.IsRunning()
+}
+
 func (s *ConfigService) RestartCore() error {
 	err := s.StopCore()
 	if err != nil {
@@ -127,6 +141,10 @@ func (s *ConfigService) StopCore() error {
 }
 
 func (s *ConfigService) Save(obj string, act string, data json.RawMessage, initUsers string, loginUser string, hostname string) ([]string, error) {
+	return s.save(obj, act, data, initUsers, loginUser, hostname, 0)
+}
+
+func (s *ConfigService) save(obj string, act string, data json.RawMessage, initUsers string, loginUser string, hostname string, revertOf uint64) ([]string, error) {
 	var err error
 	var objs []string = []string{obj}
 
@@ -139,11 +157,39 @@ func (s *ConfigService) Save(obj string, act string, data json.RawMessage, initU
 			if !corePtr.IsRunning() {
 				s.StartCore("")
 			}
+			if obj == "settings" {
+				s.SettingService.LoadAlertSinks()
+				notifySettingsChanged()
+			}
+			if obj == "clients" || obj == "settings" {
+				s.LoadIpLimits()
+				s.LoadRateLimits()
+			}
 		} else {
 			tx.Rollback()
 		}
 	}()
 
+	// The chisel service writes outside the transaction, so its snapshots are read outside too
+	reader := tx
+	if obj == "chisel" {
+		reader = db
+	}
+	change := &model.Changes{
+		Actor:    loginUser,
+		Key:      obj,
+		Action:   act,
+		Obj:      data,
+		RevertOf: revertOf,
+	}
+	var lastId uint
+	if changeModel(obj) != nil || obj == "settings" || obj == "config" {
+		lastId, err = snapshotBefore(reader, change)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	switch obj {
 	case "clients":
 		var inboundIds []uint
@@ -184,14 +230,12 @@ func (s *ConfigService) Save(obj string, act string, data json.RawMessage, initU
 		return nil, err
 	}
 
-	dt := time.Now().Unix()
-	err = tx.Create(&model.Changes{
-		DateTime: dt,
-		Actor:    loginUser,
-		Key:      obj,
-		Action:   act,
-		Obj:      data,
-	}).Error
+	err = snapshotAfter(reader, change, lastId)
+	if err != nil {
+		return nil, err
+	}
+	change.DateTime = time.Now().Unix()
+	err = tx.Create(change).Error
 	if err != nil {
 		return nil, err
 	}
@@ -201,6 +245,69 @@ func (s *ConfigService) Save(obj string, act string, data json.RawMessage, initU
 	return objs, nil
 }
 
+// SetClientEnable enables or disables a single client and restarts its inbounds.
+func (s *ConfigService) SetClientEnable(id uint, enable bool, actor string) error {
+	var err error
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	var client model.Client
+	err = tx.Model(model.Client{}).Where("id = ?", id).First(&client).Error
+	if err != nil {
+		return err
+	}
+	if client.Enable == enable {
+		return nil
+	}
+	before, err := snapshot(tx, "clients", client.Id)
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&client).Update("enable", enable).Error
+	if err != nil {
+		return err
+	}
+
+	var inboundIds []uint
+	json.Unmarshal(client.Inbounds, &inboundIds)
+	err = s.InboundService.RestartInbounds(tx, inboundIds)
+	if err != nil {
+		return common.NewErrorf("failed to update users for inbounds: %v", err)
+	}
+
+	action := "disable"
+	if enable {
+		action = "enable"
+	}
+	after, err := snapshot(tx, "clients", client.Id)
+	if err != nil {
+		return err
+	}
+	dt := time.Now().Unix()
+	err = tx.Create(&model.Changes{
+		DateTime: dt,
+		Actor:    actor,
+		Key:      "clients",
+		Action:   action,
+		Obj:      json.RawMessage("\"" + client.Name + "\""),
+		Ref:      client.Id,
+		Before:   before,
+		After:    after,
+	}).Error
+	if err != nil {
+		return err
+	}
+	LastUpdate = dt
+	return nil
+}
+
 func (s *ConfigService) CheckChanges(lu string) (bool, error) {
 	if lu == "" {
 		return true, nil
@@ -219,18 +326,23 @@ func (s *ConfigService) CheckChanges(lu string) (bool, error) {
 	}
 }
 
-func (s *ConfigService) GetChanges(actor string, chngKey string, count string) []model.Changes {
+// GetChanges returns the latest changes except those of the keys in exclude,
+// without their snapshots. GetChange has them.
+func (s *ConfigService) GetChanges(actor string, chngKey string, count string, exclude []string) []model.Changes {
 	c, _ := strconv.Atoi(count)
-	whereString := "`id`>0"
+	db := database.GetDB()
+	query := db.Model(model.Changes{}).Select("`id`, `date_time`, `actor`, `key`, `action`, `obj`, `ref`, `revert_of`")
 	if len(actor) > 0 {
-		whereString += " and `actor`='" + actor + "'"
+		query = query.Where("`actor` = ?", actor)
 	}
 	if len(chngKey) > 0 {
-		whereString += " and `key`='" + chngKey + "'"
+		query = query.Where("`key` = ?", chngKey)
+	}
+	if len(exclude) > 0 {
+		query = query.Where("`key` NOT IN ?", exclude)
 	}
-	db := database.GetDB()
 	var chngs []model.Changes
-	err := db.Model(model.Changes{}).Where(whereString).Order("`id` desc").Limit(c).Scan(&chngs).Error
+	err := query.Order("`id` desc").Limit(c).Scan(&chngs).Error
 	if err != nil {
 		logger.Warning(err)
 	}
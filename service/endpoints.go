@@ -24,26 +24,35 @@ func (o *EndpointService) GetAll() (*[]map[string]interface{}, error) {
 	}
 	var data []map[string]interface{}
 	for _, endpoint := range endpoints {
-		epData := map[string]interface{}{
-			"id":   endpoint.Id,
-			"type": endpoint.Type,
-			"tag":  endpoint.Tag,
-			"ext":  endpoint.Ext,
-		}
-		if endpoint.Options != nil {
-			var restFields map[string]json.RawMessage
-			if err := json.Unmarshal(endpoint.Options, &restFields); err != nil {
-				return nil, err
-			}
-			for k, v := range restFields {
-				epData[k] = v
-			}
+		epData, err := endpointData(endpoint)
+		if err != nil {
+			return nil, err
 		}
 		data = append(data, epData)
 	}
 	return &data, nil
 }
 
+// endpointData returns an endpoint in the form the frontend edits and Save accepts.
+func endpointData(endpoint *model.Endpoint) (map[string]interface{}, error) {
+	epData := map[string]interface{}{
+		"id":   endpoint.Id,
+		"type": endpoint.Type,
+		"tag":  endpoint.Tag,
+		"ext":  endpoint.Ext,
+	}
+	if endpoint.Options != nil {
+		var restFields map[string]json.RawMessage
+		if err := json.Unmarshal(endpoint.Options, &restFields); err != nil {
+			return nil, err
+		}
+		for k, v := range restFields {
+			epData[k] = v
+		}
+	}
+	return epData, nil
+}
+
 func (o *EndpointService) GetAllConfig(db *gorm.DB) ([]json.RawMessage, error) {
 	var endpointsJson []json.RawMessage
 	var endpoints []*model.Endpoint
@@ -195,6 +195,13 @@ func (s *GostService) GetAllGostConfigs() ([]model.GostConfig, error) {
 	return configs, err
 }
 
+// GetGostConfig retrieves a gost configuration by ID.
+func (s *GostService) GetGostConfig(id uint) (*model.GostConfig, error) {
+	var config model.GostConfig
+	err := database.GetDB().First(&config, id).Error
+	return &config, err
+}
+
 // GetGostConfigByName retrieves a gost configuration by name.
 func (s *GostService) GetGostConfigByName(name string) (*model.GostConfig, error) {
 	var config model.GostConfig
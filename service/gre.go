@@ -13,13 +13,17 @@ import (
 // GreService handles the business logic for GRE tunnels.
 // NOTE: All methods that manipulate network interfaces require root privileges to run.
 type GreService struct {
-	db *gorm.DB
+	db      *gorm.DB
+	routing *RoutingService
+	netns   *NetnsService
 }
 
 // NewGreService creates a new instance of GreService.
 func NewGreService() *GreService {
 	return &GreService{
-		db: database.GetDB(),
+		db:      database.GetDB(),
+		routing: NewRoutingService(),
+		netns:   NewNetnsService(),
 	}
 }
 
@@ -36,6 +40,11 @@ func (s *GreService) CreateGreTunnel(config *model.GreTunnel) error {
 		return fmt.Errorf("invalid remote address: %s", config.RemoteAddress)
 	}
 
+	// Make sure the target namespace exists
+	if err := s.netns.EnsureNamespace(config.Namespace); err != nil {
+		return err
+	}
+
 	// Define the GRE tunnel interface
 	greTunnel := &netlink.Gretun{
 		LinkAttrs: netlink.LinkAttrs{
@@ -45,27 +54,51 @@ func (s *GreService) CreateGreTunnel(config *model.GreTunnel) error {
 		Remote: remoteIP,
 	}
 
+	// The tunnel is created from the host namespace, so its underlay stays there
+	// even when the interface itself is moved into the target namespace
+	nsFd, err := namespaceFd(config.Namespace)
+	if err != nil {
+		return err
+	}
+	if nsFd != nil {
+		defer nsFd.Close()
+		greTunnel.Namespace = netlink.NsFd(*nsFd)
+	}
+
 	// Add the tunnel interface
 	if err := netlink.LinkAdd(greTunnel); err != nil {
 		return fmt.Errorf("failed to add GRE tunnel interface '%s': %w", config.Name, err)
 	}
 
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		_ = s.netns.DeleteLink(config.Namespace, config.Name) // Rollback
+		return err
+	}
+	defer handle.Close()
+
+	link, err := handle.LinkByName(config.Name)
+	if err != nil {
+		_ = s.netns.DeleteLink(config.Namespace, config.Name) // Rollback
+		return fmt.Errorf("failed to find GRE tunnel interface '%s': %w", config.Name, err)
+	}
+
 	// Parse the tunnel address
 	addr, err := netlink.ParseAddr(config.TunnelAddress)
 	if err != nil {
-		_ = netlink.LinkDel(greTunnel) // Rollback
+		_ = handle.LinkDel(link) // Rollback
 		return fmt.Errorf("invalid tunnel address '%s': %w", config.TunnelAddress, err)
 	}
 
 	// Add the address to the tunnel interface
-	if err := netlink.AddrAdd(greTunnel, addr); err != nil {
-		_ = netlink.LinkDel(greTunnel) // Rollback
+	if err := handle.AddrAdd(link, addr); err != nil {
+		_ = handle.LinkDel(link) // Rollback
 		return fmt.Errorf("failed to add address to tunnel '%s': %w", config.Name, err)
 	}
 
 	// Bring the tunnel interface up
-	if err := netlink.LinkSetUp(greTunnel); err != nil {
-		_ = netlink.LinkDel(greTunnel) // Rollback
+	if err := handle.LinkSetUp(link); err != nil {
+		_ = handle.LinkDel(link) // Rollback
 		return fmt.Errorf("failed to bring up tunnel '%s': %w", config.Name, err)
 	}
 
@@ -76,6 +109,9 @@ func (s *GreService) CreateGreTunnel(config *model.GreTunnel) error {
 		return fmt.Errorf("failed to save GRE tunnel config to database: %w", err)
 	}
 
+	// Install the routes and policy rules bound to this tunnel
+	s.routing.ApplyTunnelRoutes(config.Name, config.Namespace)
+
 	return nil
 }
 
@@ -88,15 +124,24 @@ func (s *GreService) DeleteGreTunnel(id uint) error {
 		return fmt.Errorf("failed to find GRE tunnel with ID %d: %w", id, err)
 	}
 
+	// Remove the routes and policy rules bound to this tunnel
+	s.routing.RemoveTunnelRoutes(config.Name, config.Namespace)
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
 	// Find the link by name
-	link, err := netlink.LinkByName(config.Name)
+	link, err := handle.LinkByName(config.Name)
 	if err != nil {
 		// If link doesn't exist, we can still proceed to delete from DB
 		// but we should log it.
 		fmt.Printf("Warning: could not find link '%s' to delete, but proceeding with DB record removal. Error: %v\n", config.Name, err)
 	} else {
 		// If link exists, delete it
-		if err := netlink.LinkDel(link); err != nil {
+		if err := handle.LinkDel(link); err != nil {
 			return fmt.Errorf("failed to delete GRE tunnel interface '%s': %w", config.Name, err)
 		}
 	}
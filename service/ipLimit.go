@@ -0,0 +1,35 @@
+package service
+
+import (
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+)
+
+// Modes of the concurrent IP limit of clients
+const (
+	IpLimitReject = "reject" // Connections from further IPs are rejected
+	IpLimitOldest = "oldest" // The connections of the oldest IP are dropped
+)
+
+// LoadIpLimits passes the concurrent IP limits of the clients to the core.
+func (s *ConfigService) LoadIpLimits() {
+	if !corePtr.IsRunning() {
+		return
+	}
+	var clients []model.Client
+	err := database.GetDB().Model(model.Client{}).Select("name, max_ips").Where("max_ips > 0").Scan(&clients).Error
+	if err != nil {
+		logger.Warning("unable to load the IP limits of clients: ", err)
+		return
+	}
+	limits := make(map[string]int, len(clients))
+	for _, client := range clients {
+		limits[client.Name] = client.MaxIps
+	}
+	mode, err := s.SettingService.GetIpLimitMode()
+	if err != nil {
+		logger.Warning("unable to load the IP limit mode: ", err)
+	}
+	corePtr.GetInstance().ConnTracker().SetIpLimits(limits, mode == IpLimitOldest)
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/events"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+// loginFailures counts the failed logins of an IP or a username.
+type loginFailures struct {
+	count int
+	last  time.Time
+	until time.Time // End of the lockout, zero if not locked out
+}
+
+// LoginBan is a locked out IP or username.
+type LoginBan struct {
+	Kind     string `json:"kind"` // "ip" or "user"
+	Key      string `json:"key"`
+	Failures int    `json:"failures"`
+	Until    int64  `json:"until"`
+}
+
+var (
+	guardMu      sync.Mutex
+	ipFailures   = map[string]*loginFailures{}
+	userFailures = map[string]*loginFailures{}
+)
+
+// LoginGuardService locks out IPs and usernames after repeated failed logins,
+// every further failure doubles the lockout. The state is kept in memory, a
+// restart lifts all lockouts.
+type LoginGuardService struct {
+	SettingService
+}
+
+// IsBanned reports whether an IP is locked out.
+func (s *LoginGuardService) IsBanned(ip string) bool {
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	f, ok := ipFailures[ip]
+	return ok && time.Now().Before(f.until)
+}
+
+// Check returns an error if the IP or the username is locked out.
+func (s *LoginGuardService) Check(ip string, username string) error {
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	now := time.Now()
+	until := time.Time{}
+	if f, ok := ipFailures[ip]; ok && now.Before(f.until) {
+		until = f.until
+	}
+	if f, ok := userFailures[username]; ok && username != "" && now.Before(f.until) && f.until.After(until) {
+		until = f.until
+	}
+	if until.IsZero() {
+		return nil
+	}
+	return common.NewErrorf("too many failed logins, try again in %s", until.Sub(now).Round(time.Second))
+}
+
+// Failed records a failed login, username is empty for invalid API tokens.
+func (s *LoginGuardService) Failed(ip string, username string) {
+	maxFailures, banTime, banMaxTime, window, err := s.SettingService.GetLoginLimits()
+	if err != nil {
+		logger.Warning("unable to load login limits: ", err)
+		return
+	}
+	if maxFailures == 0 {
+		return
+	}
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	now := time.Now()
+	windowTime := time.Duration(window) * time.Second
+	sweepFailures(now, windowTime)
+
+	record := func(failures map[string]*loginFailures, kind string, key string) {
+		f, ok := failures[key]
+		if !ok {
+			f = &loginFailures{}
+			failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count < maxFailures {
+			return
+		}
+		// 1x, 2x, 4x ... the first lockout, up to the longest one
+		maxLockout := time.Duration(banMaxTime) * time.Second
+		lockout := time.Duration(banTime) * time.Second
+		// Doubling stops at the longest lockout, so it can not overflow
+		for i := maxFailures; i < f.count && lockout < maxLockout; i++ {
+			lockout *= 2
+		}
+		lockout = min(lockout, maxLockout)
+		f.until = now.Add(lockout)
+		logger.Warning("login: ", kind, " ", key, " locked out for ", lockout, " after ", f.count, " failed logins")
+		events.Publish(events.LoginBanned, fmt.Sprintf("%s %s locked out for %s after %d failed logins", kind, key, lockout, f.count),
+			map[string]interface{}{"kind": kind, "key": key, "failures": f.count, "until": f.until.Unix()})
+	}
+	if ip != "" {
+		record(ipFailures, "ip", ip)
+	}
+	if username != "" {
+		record(userFailures, "user", username)
+	}
+}
+
+// Succeeded forgets the failures of an IP and a username after a complete login.
+func (s *LoginGuardService) Succeeded(ip string, username string) {
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	delete(ipFailures, ip)
+	delete(userFailures, username)
+}
+
+// GetBans returns the locked out IPs and usernames.
+func (s *LoginGuardService) GetBans() []LoginBan {
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	now := time.Now()
+	bans := []LoginBan{}
+	add := func(failures map[string]*loginFailures, kind string) {
+		for key, f := range failures {
+			if now.Before(f.until) {
+				bans = append(bans, LoginBan{Kind: kind, Key: key, Failures: f.count, Until: f.until.Unix()})
+			}
+		}
+	}
+	add(ipFailures, "ip")
+	add(userFailures, "user")
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until > bans[j].Until })
+	return bans
+}
+
+// Unban lifts the lockout of an IP or username, and forgets its failures.
+func (s *LoginGuardService) Unban(key string) error {
+	guardMu.Lock()
+	defer guardMu.Unlock()
+	_, isIp := ipFailures[key]
+	_, isUser := userFailures[key]
+	if !isIp && !isUser {
+		return common.NewErrorf("%s is not locked out", key)
+	}
+	delete(ipFailures, key)
+	delete(userFailures, key)
+	logger.Info("login: lockout of ", key, " lifted")
+	return nil
+}
+
+// sweepFailures drops the entries without a lockout and without failures
+// within the window. The window counts from the end of the last lockout, so
+// a failure right after a lockout doubles it. guardMu has to be held.
+func sweepFailures(now time.Time, window time.Duration) {
+	for _, failures := range []map[string]*loginFailures{ipFailures, userFailures} {
+		for key, f := range failures {
+			if now.After(f.until) && now.Sub(later(f.last, f.until)) > window {
+				delete(failures, key)
+			}
+		}
+	}
+}
+
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -234,6 +234,13 @@ func (s *MTProtoEmbeddedService) GetAllMTProtoConfigs() ([]model.MTProtoProxyCon
 	return configs, err
 }
 
+// GetMTProtoConfig retrieves MTProto config by ID
+func (s *MTProtoEmbeddedService) GetMTProtoConfig(id uint) (*model.MTProtoProxyConfig, error) {
+	var config model.MTProtoProxyConfig
+	err := database.GetDB().First(&config, id).Error
+	return &config, err
+}
+
 // GetMTProtoConfigByName retrieves MTProto config by name
 func (s *MTProtoEmbeddedService) GetMTProtoConfigByName(name string) (*model.MTProtoProxyConfig, error) {
 	var config model.MTProtoProxyConfig
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// netnsDir is where iproute2 keeps the bind mounts of named namespaces.
+const netnsDir = "/var/run/netns"
+
+// namespaceNamePattern limits namespace names to what is safe as a file name
+// inside netnsDir.
+var namespaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`)
+
+// validateNamespace rejects names which would reach outside netnsDir, like
+// "..". The empty name of the root namespace is valid.
+func validateNamespace(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == "." || name == ".." || !namespaceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid network namespace name '%s'", name)
+	}
+	return nil
+}
+
+// NetnsService manages the named network namespaces tunnels can be isolated in.
+// An empty namespace name always refers to the host's root namespace.
+// NOTE: All methods require root privileges to run.
+type NetnsService struct{}
+
+// NewNetnsService creates a new instance of NetnsService.
+func NewNetnsService() *NetnsService {
+	return &NetnsService{}
+}
+
+// EnsureNamespace creates the named network namespace unless it already exists.
+func (s *NetnsService) EnsureNamespace(name string) error {
+	if name == "" {
+		return nil
+	}
+	if err := validateNamespace(name); err != nil {
+		return err
+	}
+	if ns, err := netns.GetFromName(name); err == nil {
+		ns.Close()
+		return nil
+	}
+
+	// netns.NewNamed switches the calling thread into the new namespace
+	return withLockedThread(func() error {
+		ns, err := netns.NewNamed(name)
+		if err != nil {
+			return fmt.Errorf("failed to create network namespace '%s': %w", name, err)
+		}
+		ns.Close()
+		return nil
+	})
+}
+
+// DeleteNamespace removes the named network namespace. Links still inside it are destroyed by the kernel.
+func (s *NetnsService) DeleteNamespace(name string) error {
+	if name == "" {
+		return fmt.Errorf("the root namespace cannot be deleted")
+	}
+	if err := validateNamespace(name); err != nil {
+		return err
+	}
+	if err := netns.DeleteNamed(name); err != nil {
+		return fmt.Errorf("failed to delete network namespace '%s': %w", name, err)
+	}
+	return nil
+}
+
+// ListNamespaces returns the names of all named network namespaces.
+func (s *NetnsService) ListNamespaces() ([]string, error) {
+	names := []string{}
+	entries, err := os.ReadDir(netnsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return names, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// CreateVethPair connects two namespaces with a veth pair, creating the namespaces if needed.
+// Both ends are brought up, so they only need an address to carry traffic.
+func (s *NetnsService) CreateVethPair(name string, namespace string, peerName string, peerNamespace string) error {
+	if err := s.EnsureNamespace(namespace); err != nil {
+		return err
+	}
+	if err := s.EnsureNamespace(peerNamespace); err != nil {
+		return err
+	}
+
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: name,
+		},
+		PeerName: peerName,
+	}
+	nsFd, err := namespaceFd(namespace)
+	if err != nil {
+		return err
+	}
+	if nsFd != nil {
+		defer nsFd.Close()
+		veth.Namespace = netlink.NsFd(*nsFd)
+	}
+	peerFd, err := namespaceFd(peerNamespace)
+	if err != nil {
+		return err
+	}
+	if peerFd != nil {
+		defer peerFd.Close()
+		veth.PeerNamespace = netlink.NsFd(*peerFd)
+	}
+
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("failed to add veth pair '%s'/'%s': %w", name, peerName, err)
+	}
+
+	for _, end := range []struct{ name, namespace string }{{name, namespace}, {peerName, peerNamespace}} {
+		if err := setLinkUpIn(end.namespace, end.name); err != nil {
+			_ = s.DeleteLink(namespace, name) // Rollback
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteLink removes a link from the given namespace.
+func (s *NetnsService) DeleteLink(namespace string, name string) error {
+	handle, err := netlinkHandle(namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	link, err := handle.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find link '%s': %w", name, err)
+	}
+	return handle.LinkDel(link)
+}
+
+func setLinkUpIn(namespace string, name string) error {
+	handle, err := netlinkHandle(namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	link, err := handle.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find link '%s': %w", name, err)
+	}
+	if err := handle.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to bring up link '%s': %w", name, err)
+	}
+	return nil
+}
+
+// namespaceFd opens the named namespace, returning nil for the root namespace.
+func namespaceFd(name string) (*netns.NsHandle, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if err := validateNamespace(name); err != nil {
+		return nil, err
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network namespace '%s': %w", name, err)
+	}
+	return &ns, nil
+}
+
+// netlinkHandle returns a netlink handle operating inside the named namespace,
+// or in the root namespace when the name is empty. The caller must close it.
+func netlinkHandle(name string) (*netlink.Handle, error) {
+	if name == "" {
+		return netlink.NewHandle()
+	}
+	if err := validateNamespace(name); err != nil {
+		return nil, err
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open network namespace '%s': %w", name, err)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket in namespace '%s': %w", name, err)
+	}
+	return handle, nil
+}
+
+// runInNamespace runs fn on an OS thread switched into the named namespace, so
+// sockets and devices it opens belong to that namespace. fn must not rely on
+// goroutines it starts staying in the namespace.
+func runInNamespace(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	if err := validateNamespace(name); err != nil {
+		return err
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return fmt.Errorf("failed to open network namespace '%s': %w", name, err)
+	}
+	defer ns.Close()
+
+	return withLockedThread(func() error {
+		if err := netns.Set(ns); err != nil {
+			return fmt.Errorf("failed to enter network namespace '%s': %w", name, err)
+		}
+		return fn()
+	})
+}
+
+// withLockedThread runs fn on a locked OS thread and switches the thread back to
+// its original namespace afterwards.
+func withLockedThread(fn func() error) error {
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to get current network namespace: %w", err)
+	}
+	defer origin.Close()
+
+	defer func() {
+		if err := netns.Set(origin); err != nil {
+			// Keep the thread locked, so the runtime throws it away instead of reusing it
+			log.Printf("Failed to restore network namespace: %v", err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+	return fn()
+}
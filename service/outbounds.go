@@ -22,25 +22,34 @@ func (o *OutboundService) GetAll() (*[]map[string]interface{}, error) {
 	}
 	var data []map[string]interface{}
 	for _, outbound := range outbounds {
-		outData := map[string]interface{}{
-			"id":   outbound.Id,
-			"type": outbound.Type,
-			"tag":  outbound.Tag,
-		}
-		if outbound.Options != nil {
-			var restFields map[string]json.RawMessage
-			if err := json.Unmarshal(outbound.Options, &restFields); err != nil {
-				return nil, err
-			}
-			for k, v := range restFields {
-				outData[k] = v
-			}
+		outData, err := outboundData(outbound)
+		if err != nil {
+			return nil, err
 		}
 		data = append(data, outData)
 	}
 	return &data, nil
 }
 
+// outboundData returns an outbound in the form the frontend edits and Save accepts.
+func outboundData(outbound *model.Outbound) (map[string]interface{}, error) {
+	outData := map[string]interface{}{
+		"id":   outbound.Id,
+		"type": outbound.Type,
+		"tag":  outbound.Tag,
+	}
+	if outbound.Options != nil {
+		var restFields map[string]json.RawMessage
+		if err := json.Unmarshal(outbound.Options, &restFields); err != nil {
+			return nil, err
+		}
+		for k, v := range restFields {
+			outData[k] = v
+		}
+	}
+	return outData, nil
+}
+
 func (o *OutboundService) GetAllConfig(db *gorm.DB) ([]json.RawMessage, error) {
 	var outboundsJson []json.RawMessage
 	var outbounds []*model.Outbound
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/igor04091968/sing-chisel-tel/core"
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+// parseRateLimits parses a setting of bandwidth limits by name.
+func parseRateLimits(data string) (map[string]core.RateLimit, error) {
+	limits := map[string]core.RateLimit{}
+	if data == "" {
+		return limits, nil
+	}
+	err := json.Unmarshal([]byte(data), &limits)
+	if err != nil {
+		return nil, err
+	}
+	for name, limit := range limits {
+		if limit.Up < 0 || limit.Down < 0 {
+			return nil, common.NewErrorf("the rate limit of %s can not be negative", name)
+		}
+	}
+	return limits, nil
+}
+
+// LoadRateLimits passes the bandwidth limits of the clients, their groups and
+// the inbounds to the core.
+func (s *ConfigService) LoadRateLimits() {
+	if !corePtr.IsRunning() {
+		return
+	}
+	var err error
+	limits := core.RateLimits{
+		Users:      map[string]core.RateLimit{},
+		UserGroups: map[string]string{},
+	}
+	limits.Groups, err = s.SettingService.GetGroupRateLimits()
+	if err != nil {
+		logger.Warning("unable to load the rate limits of groups: ", err)
+		limits.Groups = map[string]core.RateLimit{}
+	}
+	limits.Inbounds, err = s.SettingService.GetInboundRateLimits()
+	if err != nil {
+		logger.Warning("unable to load the rate limits of inbounds: ", err)
+		limits.Inbounds = map[string]core.RateLimit{}
+	}
+
+	var clients []model.Client
+	err = database.GetDB().Model(model.Client{}).Select("`name`, `group`, `up_limit`, `down_limit`").
+		Where("up_limit > 0 OR down_limit > 0 OR `group` <> ''").Scan(&clients).Error
+	if err != nil {
+		logger.Warning("unable to load the rate limits of clients: ", err)
+		return
+	}
+	for _, client := range clients {
+		if client.UpLimit > 0 || client.DownLimit > 0 {
+			limits.Users[client.Name] = core.RateLimit{Up: client.UpLimit, Down: client.DownLimit}
+		}
+		if _, ok := limits.Groups[client.Group]; ok {
+			limits.UserGroups[client.Name] = client.Group
+		}
+	}
+	corePtr.GetInstance().StatsTracker().SetRateLimits(limits)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+// Permissions checked by the API
+const (
+	PermRead    = "read"    // View clients, configuration, stats and logs
+	PermClients = "clients" // Manage clients and their subscriptions
+	PermTunnels = "tunnels" // Manage chisel, gost, GRE, TAP, VXLAN, MTProto, UDP tunnels and routing
+	PermConfig  = "config"  // Manage inbounds, outbounds, endpoints, services, TLS and the core
+	PermSystem  = "system"  // Settings, restarts, the database, admins and lockouts
+)
+
+// Permissions lists all permissions, in the order they are shown.
+var Permissions = []string{PermRead, PermClients, PermTunnels, PermConfig, PermSystem}
+
+// Roles of the admins
+const (
+	RoleAdmin          = "admin"
+	RoleClientManager  = "client-manager"
+	RoleTunnelOperator = "tunnel-operator"
+	RoleViewer         = "viewer"
+)
+
+var rolePermissions = map[string][]string{
+	RoleAdmin:          Permissions,
+	RoleClientManager:  {PermRead, PermClients},
+	RoleTunnelOperator: {PermRead, PermTunnels},
+	RoleViewer:         {PermRead},
+}
+
+// RolePermissions returns the permissions of a role. Users of older versions
+// have no role and stay admins.
+func RolePermissions(role string) ([]string, error) {
+	if role == "" {
+		role = RoleAdmin
+	}
+	permissions, ok := rolePermissions[role]
+	if !ok {
+		return nil, common.NewErrorf("unknown role: %s", role)
+	}
+	return permissions, nil
+}
+
+// TokenPermissions returns the permissions of a token, its scopes limited to
+// the role of its user. A token without scopes has all permissions of the role.
+func TokenPermissions(role string, scopes string) ([]string, error) {
+	permissions, err := RolePermissions(role)
+	if err != nil {
+		return nil, err
+	}
+	list := splitAllowList(scopes)
+	if len(list) == 0 {
+		return permissions, nil
+	}
+	var result []string
+	for _, scope := range list {
+		if slices.Contains(permissions, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// validateScopes checks the scopes of a new token against the role of its user.
+func validateScopes(role string, scopes string) error {
+	permissions, err := RolePermissions(role)
+	if err != nil {
+		return err
+	}
+	for _, scope := range splitAllowList(scopes) {
+		if !slices.Contains(Permissions, scope) {
+			return common.NewErrorf("unknown scope: %s", scope)
+		}
+		if !slices.Contains(permissions, scope) {
+			return common.NewErrorf("scope %s is not allowed for role %s", scope, role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/vishvananda/netlink"
+	"gorm.io/gorm"
+)
+
+// RoutingService manages static routes, custom route tables and policy rules.
+// Routes and rules tied to a tunnel are installed when the tunnel comes up and
+// removed when it goes down.
+// NOTE: All methods that manipulate the kernel routing state require root privileges to run.
+type RoutingService struct {
+	db *gorm.DB
+}
+
+// NewRoutingService creates a new instance of RoutingService.
+func NewRoutingService() *RoutingService {
+	return &RoutingService{
+		db: database.GetDB(),
+	}
+}
+
+// CreateRouteTable saves a custom route table.
+func (s *RoutingService) CreateRouteTable(table *model.RouteTable) error {
+	// 0, 253, 254 and 255 are reserved for unspec, default, main and local
+	if table.TableId < 1 || table.TableId > 252 {
+		return fmt.Errorf("invalid table id %d: must be between 1 and 252", table.TableId)
+	}
+	if err := s.db.Create(table).Error; err != nil {
+		return fmt.Errorf("failed to save route table to database: %w", err)
+	}
+	return nil
+}
+
+// DeleteRouteTable removes a custom route table which is not referenced by any route or rule.
+func (s *RoutingService) DeleteRouteTable(id uint) error {
+	var table model.RouteTable
+	if err := s.db.First(&table, id).Error; err != nil {
+		return fmt.Errorf("failed to find route table with ID %d: %w", id, err)
+	}
+	var count int64
+	s.db.Model(&model.Route{}).Where("`table` = ?", table.TableId).Count(&count)
+	if count == 0 {
+		s.db.Model(&model.RouteRule{}).Where("`table` = ?", table.TableId).Count(&count)
+	}
+	if count > 0 {
+		return fmt.Errorf("route table '%s' is still in use", table.Name)
+	}
+	return s.db.Delete(&model.RouteTable{}, id).Error
+}
+
+// GetAllRouteTables retrieves all custom route tables from the database.
+func (s *RoutingService) GetAllRouteTables() ([]model.RouteTable, error) {
+	var tables []model.RouteTable
+	err := s.db.Find(&tables).Error
+	return tables, err
+}
+
+// CreateRoute saves a static route and installs it right away unless it is tied
+// to a tunnel which is not up yet.
+// This operation requires root privileges.
+func (s *RoutingService) CreateRoute(route *model.Route) error {
+	// Validate the config before the tunnel device exists
+	nlRoute, err := s.buildRoute(nil, route, false)
+	if err != nil {
+		return err
+	}
+
+	handle, err := netlinkHandle(route.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	route.Status = "down"
+	if route.Tunnel == "" || s.isLinkUp(handle, route.Tunnel) {
+		nlRoute, err = s.buildRoute(handle, route, true)
+		if err != nil {
+			return err
+		}
+		if err := handle.RouteReplace(nlRoute); err != nil {
+			return fmt.Errorf("failed to install route '%s': %w", route.Destination, err)
+		}
+		route.Status = "up"
+	}
+
+	if err := s.db.Create(route).Error; err != nil {
+		if route.Status == "up" {
+			_ = handle.RouteDel(nlRoute) // Rollback
+		}
+		return fmt.Errorf("failed to save route to database: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoute removes a static route from the kernel and the database.
+// This operation requires root privileges.
+func (s *RoutingService) DeleteRoute(id uint) error {
+	var route model.Route
+	if err := s.db.First(&route, id).Error; err != nil {
+		return fmt.Errorf("failed to find route with ID %d: %w", id, err)
+	}
+	if route.Status == "up" {
+		if err := s.removeRoute(&route); err != nil {
+			return err
+		}
+	}
+	return s.db.Delete(&model.Route{}, id).Error
+}
+
+// GetAllRoutes retrieves all static routes from the database.
+func (s *RoutingService) GetAllRoutes() ([]model.Route, error) {
+	var routes []model.Route
+	err := s.db.Find(&routes).Error
+	return routes, err
+}
+
+// CreateRouteRule saves a policy rule and installs it right away unless it is
+// tied to a tunnel which is not up yet.
+// This operation requires root privileges.
+func (s *RoutingService) CreateRouteRule(rule *model.RouteRule) error {
+	nlRule, err := s.buildRule(rule)
+	if err != nil {
+		return err
+	}
+
+	handle, err := netlinkHandle(rule.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	rule.Status = "down"
+	if rule.Tunnel == "" || s.isLinkUp(handle, rule.Tunnel) {
+		if err := handle.RuleAdd(nlRule); err != nil {
+			return fmt.Errorf("failed to install rule: %w", err)
+		}
+		rule.Status = "up"
+	}
+
+	if err := s.db.Create(rule).Error; err != nil {
+		if rule.Status == "up" {
+			_ = handle.RuleDel(nlRule) // Rollback
+		}
+		return fmt.Errorf("failed to save rule to database: %w", err)
+	}
+	return nil
+}
+
+// DeleteRouteRule removes a policy rule from the kernel and the database.
+// This operation requires root privileges.
+func (s *RoutingService) DeleteRouteRule(id uint) error {
+	var rule model.RouteRule
+	if err := s.db.First(&rule, id).Error; err != nil {
+		return fmt.Errorf("failed to find rule with ID %d: %w", id, err)
+	}
+	if rule.Status == "up" {
+		if err := s.removeRule(&rule); err != nil {
+			return err
+		}
+	}
+	return s.db.Delete(&model.RouteRule{}, id).Error
+}
+
+// GetAllRouteRules retrieves all policy rules from the database.
+func (s *RoutingService) GetAllRouteRules() ([]model.RouteRule, error) {
+	var rules []model.RouteRule
+	err := s.db.Find(&rules).Error
+	return rules, err
+}
+
+// ApplyStaticRoutes installs every route and rule which is not tied to a tunnel.
+// It is called once at startup, as the kernel forgets them on reboot.
+func (s *RoutingService) ApplyStaticRoutes() {
+	var routes []model.Route
+	s.db.Where("tunnel = ?", "").Find(&routes)
+	var rules []model.RouteRule
+	s.db.Where("tunnel = ?", "").Find(&rules)
+	s.applyRouting("", routes, rules)
+}
+
+// ApplyTunnelRoutes installs the routes and rules tied to the given tunnel interface
+// of the given network namespace.
+func (s *RoutingService) ApplyTunnelRoutes(tunnel string, namespace string) {
+	if tunnel == "" {
+		return
+	}
+	var routes []model.Route
+	s.db.Where("tunnel = ? and namespace = ?", tunnel, namespace).Find(&routes)
+	var rules []model.RouteRule
+	s.db.Where("tunnel = ? and namespace = ?", tunnel, namespace).Find(&rules)
+	s.applyRouting(tunnel, routes, rules)
+}
+
+// RemoveTunnelRoutes removes the routes and rules tied to the given tunnel interface
+// of the given network namespace.
+func (s *RoutingService) RemoveTunnelRoutes(tunnel string, namespace string) {
+	if tunnel == "" {
+		return
+	}
+
+	var rules []model.RouteRule
+	s.db.Where("tunnel = ? and namespace = ? and status = ?", tunnel, namespace, "up").Find(&rules)
+	for _, rule := range rules {
+		if err := s.removeRule(&rule); err != nil {
+			log.Printf("Failed to remove rule %d of tunnel '%s': %v", rule.ID, tunnel, err)
+			continue
+		}
+		s.db.Model(&rule).Update("status", "down")
+	}
+
+	var routes []model.Route
+	s.db.Where("tunnel = ? and namespace = ? and status = ?", tunnel, namespace, "up").Find(&routes)
+	for _, route := range routes {
+		if err := s.removeRoute(&route); err != nil {
+			log.Printf("Failed to remove route '%s' of tunnel '%s': %v", route.Destination, tunnel, err)
+			continue
+		}
+		s.db.Model(&route).Update("status", "down")
+	}
+}
+
+func (s *RoutingService) applyRouting(tunnel string, routes []model.Route, rules []model.RouteRule) {
+	// Routes go first, so rules never point to an empty table
+	for _, route := range routes {
+		err := s.withHandle(route.Namespace, func(handle *netlink.Handle) error {
+			nlRoute, err := s.buildRoute(handle, &route, true)
+			if err != nil {
+				return err
+			}
+			return handle.RouteReplace(nlRoute)
+		})
+		if err != nil {
+			log.Printf("Failed to install route '%s' of tunnel '%s': %v", route.Destination, tunnel, err)
+			s.db.Model(&route).Update("status", "down")
+			continue
+		}
+		s.db.Model(&route).Update("status", "up")
+	}
+
+	for _, rule := range rules {
+		err := s.withHandle(rule.Namespace, func(handle *netlink.Handle) error {
+			nlRule, err := s.buildRule(&rule)
+			if err != nil {
+				return err
+			}
+			if err := handle.RuleAdd(nlRule); err != nil && !errors.Is(err, syscall.EEXIST) {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to install rule %d of tunnel '%s': %v", rule.ID, tunnel, err)
+			s.db.Model(&rule).Update("status", "down")
+			continue
+		}
+		s.db.Model(&rule).Update("status", "up")
+	}
+}
+
+func (s *RoutingService) removeRoute(route *model.Route) error {
+	handle, err := netlinkHandle(route.Namespace)
+	if err != nil {
+		// The kernel drops routes together with their namespace
+		return nil
+	}
+	defer handle.Close()
+
+	nlRoute, err := s.buildRoute(handle, route, true)
+	if err != nil {
+		// The kernel drops routes together with their output device
+		return nil
+	}
+	if err := handle.RouteDel(nlRoute); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to remove route '%s': %w", route.Destination, err)
+	}
+	return nil
+}
+
+func (s *RoutingService) removeRule(rule *model.RouteRule) error {
+	nlRule, err := s.buildRule(rule)
+	if err != nil {
+		return err
+	}
+	return s.withHandle(rule.Namespace, func(handle *netlink.Handle) error {
+		if err := handle.RuleDel(nlRule); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return fmt.Errorf("failed to remove rule %d: %w", rule.ID, err)
+		}
+		return nil
+	})
+}
+
+// withHandle runs fn with a netlink handle bound to the given network namespace.
+func (s *RoutingService) withHandle(namespace string, fn func(handle *netlink.Handle) error) error {
+	handle, err := netlinkHandle(namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return fn(handle)
+}
+
+// buildRoute converts a route config into a netlink route. The output device is
+// only resolved when resolveLink is set, since it may not exist before its tunnel.
+func (s *RoutingService) buildRoute(handle *netlink.Handle, route *model.Route, resolveLink bool) (*netlink.Route, error) {
+	if err := validateNamespace(route.Namespace); err != nil {
+		return nil, err
+	}
+	nlRoute := &netlink.Route{
+		Table:    route.Table,
+		Priority: route.Metric,
+	}
+
+	if route.Destination != "default" && route.Destination != "" {
+		_, dst, err := net.ParseCIDR(route.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route destination '%s': %w", route.Destination, err)
+		}
+		nlRoute.Dst = dst
+	}
+
+	if route.Gateway != "" {
+		gw := net.ParseIP(route.Gateway)
+		if gw == nil {
+			return nil, fmt.Errorf("invalid route gateway: %s", route.Gateway)
+		}
+		nlRoute.Gw = gw
+	}
+
+	device := route.Device
+	if device == "" {
+		device = route.Tunnel
+	}
+	if device == "" && nlRoute.Gw == nil {
+		return nil, fmt.Errorf("route '%s' needs a gateway or an output device", route.Destination)
+	}
+	if device != "" && resolveLink {
+		link, err := handle.LinkByName(device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find route device '%s': %w", device, err)
+		}
+		nlRoute.LinkIndex = link.Attrs().Index
+	}
+
+	return nlRoute, nil
+}
+
+// buildRule converts a policy rule config into a netlink rule.
+func (s *RoutingService) buildRule(rule *model.RouteRule) (*netlink.Rule, error) {
+	if err := validateNamespace(rule.Namespace); err != nil {
+		return nil, err
+	}
+	if rule.Table == 0 {
+		return nil, fmt.Errorf("rule needs a routing table")
+	}
+	if rule.Src == "" && rule.Dst == "" && rule.Fwmark == 0 && rule.IifName == "" {
+		return nil, fmt.Errorf("rule needs at least one of source, destination, fwmark or incoming interface")
+	}
+
+	nlRule := netlink.NewRule()
+	nlRule.Table = rule.Table
+	nlRule.Family = netlink.FAMILY_V4
+	if rule.Priority > 0 {
+		nlRule.Priority = rule.Priority
+	}
+
+	if rule.Src != "" {
+		_, src, err := net.ParseCIDR(rule.Src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule source '%s': %w", rule.Src, err)
+		}
+		nlRule.Src = src
+		if src.IP.To4() == nil {
+			nlRule.Family = netlink.FAMILY_V6
+		}
+	}
+	if rule.Dst != "" {
+		_, dst, err := net.ParseCIDR(rule.Dst)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule destination '%s': %w", rule.Dst, err)
+		}
+		nlRule.Dst = dst
+		if dst.IP.To4() == nil {
+			nlRule.Family = netlink.FAMILY_V6
+		}
+	}
+	if rule.Fwmark != 0 {
+		nlRule.Mark = rule.Fwmark
+		if rule.Mask != 0 {
+			mask := rule.Mask
+			nlRule.Mask = &mask
+		}
+	}
+	nlRule.IifName = rule.IifName
+
+	return nlRule, nil
+}
+
+func (s *RoutingService) isLinkUp(handle *netlink.Handle, name string) bool {
+	link, err := handle.LinkByName(name)
+	if err != nil {
+		return false
+	}
+	return link.Attrs().Flags&net.FlagUp != 0
+}
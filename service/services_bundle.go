@@ -17,6 +17,9 @@ type ServicesBundle struct {
 	ServerService    ServerService
 	ChiselService    *ChiselService
 	GostService      *GostService
+	GreService       *GreService
 	TapService       *TapService
 	UdpTunnelService *UdpTunnelService
+	VxlanService     *VxlanService
+	RoutingService   *RoutingService
 }
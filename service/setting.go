@@ -2,16 +2,23 @@ package service
 
 import (
 	"encoding/json"
+	"html/template"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/igor04091968/sing-chisel-tel/config"
+	"github.com/igor04091968/sing-chisel-tel/core"
 	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
 	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util"
 	"github.com/igor04091968/sing-chisel-tel/util/common"
 
 	"gorm.io/gorm"
@@ -51,6 +58,17 @@ var defaultValueMap = map[string]string{
 	"webPath":       "/app/",
 	"webURI":        "",
 	"sessionMaxAge": "0",
+	"webIpAllow":    "",
+	"webIpDeny":     "",
+	"apiIpAllow":    "",
+	"apiIpDeny":     "",
+	"subIpAllow":    "",
+	"subIpDeny":     "",
+	"trustedProxies": "127.0.0.1,::1",
+	"loginMaxFailures": "5",
+	"loginBanTime":  "60",
+	"loginBanMaxTime": "86400",
+	"loginFailWindow": "900",
 	"trafficAge":    "30",
 	"timeLocation":  "Asia/Tehran",
 	"subListen":     "",
@@ -65,7 +83,32 @@ var defaultValueMap = map[string]string{
 	"subURI":        "",
 	"subJsonExt":    "",
 	"subClashExt":   "",
+	"subTokenGrace": "60",
+	"subNameAccess": "false",
+	"subLogAge":     "30",
+	"subExtCacheTTL": "300",
+	"subExtTimeout": "10",
+	"subExtInsecure": "false",
+	"subLanding":    "true",
+	"subLandingTemplate": "",
+	"subAbuseWindow": "60",
+	"subAbuseIps":   "5",
+	"subAbuseCountries": "3",
 	"subscriptionDomain": "", // Added for custom subscription domain
+	"alertSinks":    "[]",
+	"ipLimitMode":   "reject",
+	"groupRateLimits": "{}",
+	"inboundRateLimits": "{}",
+	"tgEnable":      "false",
+	"tgBotToken":    "",
+	"tgAdminIds":    "",
+	"tgClientMode":  "false",
+	"tgWarnVolume":  "80,95",
+	"tgWarnDays":    "3,1",
+	"tgProxy":       "",
+	"tgWebhook":     "false",
+	"tgWebhookURL":  "",
+	"tgWebhookSecret": common.Random(32),
 	"config":        defaultConfig,
 	"version":       config.GetVersion(),
 }
@@ -73,6 +116,19 @@ var defaultValueMap = map[string]string{
 type SettingService struct {
 }
 
+var settingsListeners []func()
+
+// OnSettingsChanged registers fn to be called after the settings were saved.
+func OnSettingsChanged(fn func()) {
+	settingsListeners = append(settingsListeners, fn)
+}
+
+func notifySettingsChanged() {
+	for _, fn := range settingsListeners {
+		fn()
+	}
+}
+
 func (s *SettingService) GetAllSetting() (*map[string]string, error) {
 	db := database.GetDB()
 	settings := make([]*model.Setting, 0)
@@ -396,6 +452,60 @@ func (s *SettingService) Save(tx *gorm.DB, data json.RawMessage) error {
 			}
 		}
 
+		if key == "webURI" && obj != "" {
+			if _, err = parseWebURI(obj); err != nil {
+				return err
+			}
+		}
+
+		if key == "ipLimitMode" && obj != IpLimitReject && obj != IpLimitOldest {
+			return common.NewErrorf("invalid %s: %s", key, obj)
+		}
+
+		if key == "groupRateLimits" || key == "inboundRateLimits" {
+			if _, err = parseRateLimits(obj); err != nil {
+				return common.NewErrorf("invalid %s: %v", key, err)
+			}
+		}
+
+		if key == "alertSinks" {
+			_, err = events.ParseSinks(obj)
+			if err != nil {
+				return err
+			}
+		}
+
+		if key == "subTokenGrace" || key == "subLogAge" || key == "subExtCacheTTL" || key == "subExtTimeout" || strings.HasPrefix(key, "subAbuse") {
+			if grace, err := strconv.Atoi(obj); err != nil || grace < 0 {
+				return common.NewErrorf("invalid %s: %s", key, obj)
+			}
+		}
+
+		if strings.HasSuffix(key, "IpAllow") || strings.HasSuffix(key, "IpDeny") || key == "trustedProxies" {
+			if _, err := util.ParseIPNets(obj); err != nil {
+				return common.NewErrorf("invalid %s: %v", key, err)
+			}
+		}
+
+		if strings.HasPrefix(key, "login") {
+			if value, err := strconv.Atoi(obj); err != nil || value < 0 {
+				return common.NewErrorf("invalid %s: %s", key, obj)
+			}
+		}
+
+		if key == "subLandingTemplate" && obj != "" {
+			if _, err := template.New("landing").Parse(obj); err != nil {
+				return common.NewErrorf("invalid landing page template: %v", err)
+			}
+		}
+
+		if strings.HasPrefix(key, "tg") {
+			err = validateTelegramSetting(key, obj)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Correct Pathes start and ends with `/`
 		if key == "webPath" ||
 			key == "subPath" {
@@ -430,6 +540,350 @@ func (s *SettingService) GetSubClashExt() (string, error) {
 	return s.getString("subClashExt")
 }
 
+// GetSubTokenGrace returns the minutes an old subscription token keeps working after a rotation.
+func (s *SettingService) GetSubTokenGrace() (int, error) {
+	return s.getInt("subTokenGrace")
+}
+
+// GetSubLogAge returns the days subscription fetches are kept, 0 disables the log.
+func (s *SettingService) GetSubLogAge() (int, error) {
+	return s.getInt("subLogAge")
+}
+
+// GetSubAbuseLimits returns the window in minutes and the number of distinct
+// IPs and countries a subscription may be fetched from within it, 0 is no limit.
+func (s *SettingService) GetSubAbuseLimits() (window int, ips int, countries int, err error) {
+	if window, err = s.getInt("subAbuseWindow"); err != nil {
+		return
+	}
+	if ips, err = s.getInt("subAbuseIps"); err != nil {
+		return
+	}
+	countries, err = s.getInt("subAbuseCountries")
+	return
+}
+
+// GetSubExtCacheTTL returns the seconds external subscriptions are cached.
+func (s *SettingService) GetSubExtCacheTTL() (int, error) {
+	return s.getInt("subExtCacheTTL")
+}
+
+// GetSubExtTimeout returns the timeout in seconds for fetching external subscriptions.
+func (s *SettingService) GetSubExtTimeout() (int, error) {
+	return s.getInt("subExtTimeout")
+}
+
+func (s *SettingService) GetSubExtInsecure() (bool, error) {
+	return s.getBool("subExtInsecure")
+}
+
+// GetSubLanding reports whether browsers get the landing page instead of the subscription.
+func (s *SettingService) GetSubLanding() (bool, error) {
+	return s.getBool("subLanding")
+}
+
+// GetSubLandingTemplate returns the custom landing page template, empty for the built-in one.
+func (s *SettingService) GetSubLandingTemplate() (string, error) {
+	return s.getString("subLandingTemplate")
+}
+
+// GetIPFilter returns the allowlist and denylist of the web panel ("web"),
+// the token API ("api") or the subscription server ("sub").
+func (s *SettingService) GetIPFilter(server string) (allow []*net.IPNet, deny []*net.IPNet, err error) {
+	list, err := s.getString(server + "IpAllow")
+	if err != nil {
+		return nil, nil, err
+	}
+	if allow, err = util.ParseIPNets(list); err != nil {
+		return nil, nil, err
+	}
+	if list, err = s.getString(server + "IpDeny"); err != nil {
+		return nil, nil, err
+	}
+	deny, err = util.ParseIPNets(list)
+	return allow, deny, err
+}
+
+// GetTrustedProxies returns the reverse proxies whose forwarded headers are trusted.
+func (s *SettingService) GetTrustedProxies() ([]*net.IPNet, error) {
+	list, err := s.getString("trustedProxies")
+	if err != nil {
+		return nil, err
+	}
+	return util.ParseIPNets(list)
+}
+
+// GetLoginLimits returns the failed logins before a lockout, the first and
+// the longest lockout in seconds, and the seconds after which failures are
+// forgotten. maxFailures 0 disables lockouts.
+func (s *SettingService) GetLoginLimits() (maxFailures int, banTime int, banMaxTime int, window int, err error) {
+	if maxFailures, err = s.getInt("loginMaxFailures"); err != nil {
+		return
+	}
+	if banTime, err = s.getInt("loginBanTime"); err != nil {
+		return
+	}
+	if banMaxTime, err = s.getInt("loginBanMaxTime"); err != nil {
+		return
+	}
+	window, err = s.getInt("loginFailWindow")
+	return
+}
+
+// GetSubNameAccess reports whether subscriptions are still served by client name.
+func (s *SettingService) GetSubNameAccess() (bool, error) {
+	return s.getBool("subNameAccess")
+}
+
+func (s *SettingService) GetAlertSinks() ([]events.SinkConfig, error) {
+	sinks, err := s.getString("alertSinks")
+	if err != nil {
+		return nil, err
+	}
+	return events.ParseSinks(sinks)
+}
+
+// GetIpLimitMode returns what happens to connections over the IP limit of a client.
+func (s *SettingService) GetIpLimitMode() (string, error) {
+	return s.getString("ipLimitMode")
+}
+
+// GetGroupRateLimits returns the bandwidth limits shared by the clients of each group.
+func (s *SettingService) GetGroupRateLimits() (map[string]core.RateLimit, error) {
+	limits, err := s.getString("groupRateLimits")
+	if err != nil {
+		return nil, err
+	}
+	return parseRateLimits(limits)
+}
+
+// GetInboundRateLimits returns the bandwidth limits of inbounds by tag.
+func (s *SettingService) GetInboundRateLimits() (map[string]core.RateLimit, error) {
+	limits, err := s.getString("inboundRateLimits")
+	if err != nil {
+		return nil, err
+	}
+	return parseRateLimits(limits)
+}
+
+// LoadAlertSinks (re)configures the event sinks from the settings.
+func (s *SettingService) LoadAlertSinks() {
+	sinks, err := s.GetAlertSinks()
+	if err == nil {
+		err = events.Configure(sinks)
+	}
+	if err != nil {
+		logger.Warning("unable to load alert sinks: ", err)
+	}
+}
+
+func (s *SettingService) GetTgEnable() (bool, error) {
+	return s.getBool("tgEnable")
+}
+
+func (s *SettingService) GetTgBotToken() (string, error) {
+	return s.getString("tgBotToken")
+}
+
+func (s *SettingService) GetTgAdminIds() ([]int64, error) {
+	str, err := s.getString("tgAdminIds")
+	if err != nil {
+		return nil, err
+	}
+	return parseInt64List(str)
+}
+
+func (s *SettingService) GetTgClientMode() (bool, error) {
+	return s.getBool("tgClientMode")
+}
+
+func (s *SettingService) GetTgWarnVolume() ([]int, error) {
+	return s.getIntList("tgWarnVolume")
+}
+
+func (s *SettingService) GetTgWarnDays() ([]int, error) {
+	return s.getIntList("tgWarnDays")
+}
+
+func (s *SettingService) GetTgProxy() (string, error) {
+	return s.getString("tgProxy")
+}
+
+func (s *SettingService) GetTgWebhook() (bool, error) {
+	return s.getBool("tgWebhook")
+}
+
+// GetTgWebhookSecret returns the secret of the webhook path. The random
+// default is saved on first use, so it survives restarts.
+func (s *SettingService) GetTgWebhookSecret() (string, error) {
+	secret, err := s.getString("tgWebhookSecret")
+	if err == nil && secret == defaultValueMap["tgWebhookSecret"] {
+		if err := s.saveSetting("tgWebhookSecret", secret); err != nil {
+			logger.Warning("save webhook secret failed:", err)
+		}
+	}
+	return secret, err
+}
+
+// GetTgWebhookURL returns the public https URL of the panel which Telegram
+// pushes updates to, or an empty string if the panel is not served over https.
+func (s *SettingService) GetTgWebhookURL() (string, error) {
+	webhookURL, err := s.getString("tgWebhookURL")
+	if err != nil || webhookURL != "" {
+		return webhookURL, err
+	}
+	domain, err := s.getString("webDomain")
+	if err != nil {
+		return "", err
+	}
+	certFile, err := s.GetCertFile()
+	if err != nil {
+		return "", err
+	}
+	if domain == "" || certFile == "" {
+		return "", nil
+	}
+	port, err := s.GetPort()
+	if err != nil {
+		return "", err
+	}
+	webPath, err := s.GetWebPath()
+	if err != nil {
+		return "", err
+	}
+	return "https://" + net.JoinHostPort(domain, strconv.Itoa(port)) + webPath, nil
+}
+
+// GetWebOrigin returns the origin of the panel, from webURI or else from
+// webDomain, the certificate and the port. It is empty without both.
+func (s *SettingService) GetWebOrigin() (string, error) {
+	webURI, err := s.getString("webURI")
+	if err != nil {
+		return "", err
+	}
+	if webURI != "" {
+		u, err := parseWebURI(webURI)
+		if err != nil {
+			return "", err
+		}
+		return u.Scheme + "://" + u.Host, nil
+	}
+	domain, err := s.getString("webDomain")
+	if err != nil || domain == "" {
+		return "", err
+	}
+	certFile, err := s.GetCertFile()
+	if err != nil {
+		return "", err
+	}
+	port, err := s.GetPort()
+	if err != nil {
+		return "", err
+	}
+	scheme, defaultPort := "http", 80
+	if certFile != "" {
+		scheme, defaultPort = "https", 443
+	}
+	if port == defaultPort {
+		return scheme + "://" + domain, nil
+	}
+	return scheme + "://" + net.JoinHostPort(domain, strconv.Itoa(port)), nil
+}
+
+func parseWebURI(webURI string) (*url.URL, error) {
+	u, err := url.Parse(webURI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, common.NewErrorf("invalid webURI: %s", webURI)
+	}
+	return u, nil
+}
+
+func (s *SettingService) getIntList(key string) ([]int, error) {
+	str, err := s.getString(key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseInt64List(str)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int, len(values))
+	for i, v := range values {
+		result[i] = int(v)
+	}
+	return result, nil
+}
+
+// parseInt64List parses a comma separated list of numbers.
+func parseInt64List(str string) ([]int64, error) {
+	var result []int64
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, common.NewErrorf("invalid number: %s", part)
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+var (
+	tgBotTokenRegex      = regexp.MustCompile(`^[0-9]+:[A-Za-z0-9_-]+$`)
+	tgWebhookSecretRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{16,256}$`)
+)
+
+func validateTelegramSetting(key string, value string) error {
+	switch key {
+	case "tgEnable", "tgClientMode", "tgWebhook":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return common.NewErrorf("%s must be true or false", key)
+		}
+	case "tgBotToken":
+		if value != "" && !tgBotTokenRegex.MatchString(value) {
+			return common.NewError("invalid Telegram bot token")
+		}
+	case "tgAdminIds":
+		if _, err := parseInt64List(value); err != nil {
+			return common.NewErrorf("invalid Telegram admin IDs: %v", err)
+		}
+	case "tgWarnVolume", "tgWarnDays":
+		values, err := parseInt64List(value)
+		if err != nil {
+			return common.NewErrorf("invalid %s: %v", key, err)
+		}
+		for _, v := range values {
+			if v < 1 || (key == "tgWarnVolume" && v > 100) {
+				return common.NewErrorf("invalid %s: %d is out of range", key, v)
+			}
+		}
+	case "tgProxy":
+		if value == "" {
+			return nil
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return common.NewError("invalid Telegram proxy, use http://, https:// or socks5://host:port")
+		}
+	case "tgWebhookURL":
+		if value == "" {
+			return nil
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return common.NewError("the Telegram webhook URL must be an https:// URL")
+		}
+	case "tgWebhookSecret":
+		if !tgWebhookSecretRegex.MatchString(value) {
+			return common.NewError("the Telegram webhook secret must be 16 to 256 letters, digits, _ or -")
+		}
+	}
+	return nil
+}
+
 func (s *SettingService) fileExists(path string) error {
 	_, err := os.Stat(path)
 	return err
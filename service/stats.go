@@ -1,6 +1,7 @@
 package service
 
 import (
+	"slices"
 	"time"
 
 	"github.com/igor04091968/sing-chisel-tel/database"
@@ -10,9 +11,10 @@ import (
 )
 
 type Onlines struct {
-	Inbound  []string `json:"inbound,omitempty"`
-	User     []string `json:"user,omitempty"`
-	Outbound []string `json:"outbound,omitempty"`
+	Inbound  []string            `json:"inbound,omitempty"`
+	User     []string            `json:"user,omitempty"`
+	Outbound []string            `json:"outbound,omitempty"`
+	UserIps  map[string][]string `json:"userIps,omitempty"` // Source IPs of the connections of each user
 }
 
 var onlineResources = &Onlines{}
@@ -46,8 +48,12 @@ func (s *StatsService) SaveStats(enableTraffic bool) error {
 		}
 	}()
 
+	var users []string
 	for _, stat := range *stats {
 		if stat.Resource == "user" {
+			if stat.Traffic > 0 && !slices.Contains(users, stat.Tag) {
+				users = append(users, stat.Tag)
+			}
 			if stat.Direction {
 				err = tx.Model(model.Client{}).Where("name = ?", stat.Tag).
 					UpdateColumn("up", gorm.Expr("up + ?", stat.Traffic)).Error
@@ -71,6 +77,12 @@ func (s *StatsService) SaveStats(enableTraffic bool) error {
 		}
 	}
 
+	// The first traffic starts the clock of on hold clients
+	err = activateClients(tx, users, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
 	if !enableTraffic {
 		return nil
 	}
@@ -97,7 +109,12 @@ func (s *StatsService) GetStats(resource string, tag string, limit int) ([]model
 }
 
 func (s *StatsService) GetOnlines() (*Onlines, error) {
-	return onlineResources, nil
+	if !corePtr.IsRunning() {
+		return onlineResources, nil
+	}
+	onlines := *onlineResources
+	onlines.UserIps = corePtr.GetInstance().ConnTracker().UserIps()
+	return &onlines, nil
 }
 func (s *StatsService) DelOldStats(days int) error {
 	oldTime := time.Now().AddDate(0, 0, -(days)).Unix()
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+)
+
+// subAbuseAlerted keeps the time of the last abuse alert per client, so a
+// shared subscription alerts once per window.
+var subAbuseAlerted sync.Map
+
+type SubAccessService struct {
+	SettingService
+}
+
+// Log records a subscription fetch and alerts if the subscription was fetched
+// from too many IPs or countries.
+func (s *SubAccessService) Log(client *model.Client, ip string, country string, userAgent string, format string) {
+	logAge, err := s.SettingService.GetSubLogAge()
+	if err != nil || logAge == 0 {
+		return
+	}
+	if format == "" {
+		format = "links"
+	}
+	access := &model.SubAccess{
+		DateTime:  time.Now().Unix(),
+		ClientId:  client.Id,
+		Ip:        ip,
+		Country:   country,
+		UserAgent: userAgent,
+		Format:    format,
+	}
+	err = database.GetDB().Create(access).Error
+	if err != nil {
+		logger.Warning("sub: unable to log the access of ", client.Name, ": ", err)
+		return
+	}
+	s.checkAbuse(client)
+}
+
+func (s *SubAccessService) checkAbuse(client *model.Client) {
+	window, maxIps, maxCountries, err := s.SettingService.GetSubAbuseLimits()
+	if err != nil || window <= 0 || (maxIps <= 0 && maxCountries <= 0) {
+		return
+	}
+	now := time.Now()
+	since := now.Add(-time.Duration(window) * time.Minute)
+	if last, ok := subAbuseAlerted.Load(client.Id); ok && last.(time.Time).After(since) {
+		return
+	}
+
+	db := database.GetDB()
+	var ips, countries []string
+	err = db.Model(model.SubAccess{}).Where("client_id = ? and date_time >= ?", client.Id, since.Unix()).
+		Distinct().Pluck("ip", &ips).Error
+	if err != nil {
+		return
+	}
+	err = db.Model(model.SubAccess{}).Where("client_id = ? and date_time >= ? and country != ''", client.Id, since.Unix()).
+		Distinct().Pluck("country", &countries).Error
+	if err != nil {
+		return
+	}
+
+	ipsExceeded := maxIps > 0 && len(ips) > maxIps
+	countriesExceeded := maxCountries > 0 && len(countries) > maxCountries
+	if !ipsExceeded && !countriesExceeded {
+		return
+	}
+	subAbuseAlerted.Store(client.Id, now)
+	events.Publish(events.SubAbuse,
+		fmt.Sprintf("subscription of '%s' was fetched from %d IPs and %d countries in %d minutes", client.Name, len(ips), len(countries), window),
+		map[string]interface{}{
+			"client":    client.Name,
+			"ips":       ips,
+			"countries": countries,
+			"window":    window,
+		})
+}
+
+// GetByClient returns the latest subscription fetches of a client.
+func (s *SubAccessService) GetByClient(clientId uint, limit int) ([]model.SubAccess, error) {
+	var accesses []model.SubAccess
+	err := database.GetDB().Model(model.SubAccess{}).Where("client_id = ?", clientId).
+		Order("date_time desc").Limit(limit).Find(&accesses).Error
+	return accesses, err
+}
+
+func (s *SubAccessService) DelOldAccesses(days int) error {
+	oldTime := time.Now().AddDate(0, 0, -(days)).Unix()
+	return database.GetDB().Where("date_time < ?", oldTime).Delete(model.SubAccess{}).Error
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Platforms a subscription template can be restricted to
+var SubPlatforms = []string{"android", "ios", "desktop"}
+
+// subTemplateFormats validates the content of each template format.
+var subTemplateFormats = map[string]func(content string) error{
+	"singbox": func(content string) error {
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &config); err != nil {
+			return common.NewErrorf("invalid sing-box template: %v", err)
+		}
+		return nil
+	},
+	"clash": func(content string) error {
+		var config map[string]interface{}
+		if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+			return common.NewErrorf("invalid Clash template: %v", err)
+		}
+		return nil
+	},
+}
+
+type SubTemplateService struct{}
+
+func (s *SubTemplateService) GetAll() ([]model.SubTemplate, error) {
+	var templates []model.SubTemplate
+	err := database.GetDB().Model(model.SubTemplate{}).Find(&templates).Error
+	return templates, err
+}
+
+func (s *SubTemplateService) Get(id uint) (*model.SubTemplate, error) {
+	var template model.SubTemplate
+	err := database.GetDB().Model(model.SubTemplate{}).Where("id = ?", id).First(&template).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// Save creates the template, or updates it if it has an ID.
+func (s *SubTemplateService) Save(template *model.SubTemplate) error {
+	if template.Name == "" {
+		return common.NewError("template name can not be empty")
+	}
+	validate, ok := subTemplateFormats[template.Format]
+	if !ok {
+		return common.NewErrorf("unknown template format: %s", template.Format)
+	}
+	if template.Platform != "" && !slices.Contains(SubPlatforms, template.Platform) {
+		return common.NewErrorf("unknown platform: %s", template.Platform)
+	}
+	if _, err := parseNameList(template.Clients); err != nil {
+		return common.NewErrorf("invalid clients: %v", err)
+	}
+	if _, err := parseNameList(template.Groups); err != nil {
+		return common.NewErrorf("invalid groups: %v", err)
+	}
+	if err := validate(template.Content); err != nil {
+		return err
+	}
+	err := database.GetDB().Save(template).Error
+	if err == nil {
+		LastUpdate = time.Now().Unix()
+	}
+	return err
+}
+
+func (s *SubTemplateService) Delete(id uint) error {
+	err := database.GetDB().Delete(model.SubTemplate{}, id).Error
+	if err == nil {
+		LastUpdate = time.Now().Unix()
+	}
+	return err
+}
+
+// Find returns the most specific template of a format for the client and
+// platform, or nil if there is none.
+func (s *SubTemplateService) Find(format string, platform string, client *model.Client) (*model.SubTemplate, error) {
+	var templates []model.SubTemplate
+	err := database.GetDB().Model(model.SubTemplate{}).Where("format = ?", format).Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.SubTemplate
+	bestScore := 0
+	for i := range templates {
+		score := templateScore(&templates[i], platform, client)
+		if score > bestScore {
+			best = &templates[i]
+			bestScore = score
+		}
+	}
+	return best, nil
+}
+
+// templateScore ranks a template for a client, 0 means it does not apply.
+func templateScore(template *model.SubTemplate, platform string, client *model.Client) int {
+	score := 1
+	if template.Platform != "" {
+		if template.Platform != platform {
+			return 0
+		}
+		score++
+	}
+
+	clients, _ := parseNameList(template.Clients)
+	groups, _ := parseNameList(template.Groups)
+	switch {
+	case len(clients) > 0 && slices.Contains(clients, client.Name):
+		score += 4
+	case len(groups) > 0 && client.Group != "" && slices.Contains(groups, client.Group):
+		score += 2
+	case len(clients) > 0 || len(groups) > 0:
+		return 0
+	}
+	return score
+}
+
+func parseNameList(data json.RawMessage) ([]string, error) {
+	var names []string
+	if len(data) == 0 || string(data) == "null" {
+		return names, nil
+	}
+	err := json.Unmarshal(data, &names)
+	return names, err
+}
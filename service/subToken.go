@@ -0,0 +1,184 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"gorm.io/gorm"
+)
+
+func newSubToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// InitSubTokens gives the clients created before subscription tokens existed a token.
+func (s *ClientService) InitSubTokens() error {
+	var clients []model.Client
+	db := database.GetDB()
+	err := db.Model(model.Client{}).Select("id").Where("sub_token = ? or sub_token is null", "").Find(&clients).Error
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		token, err := newSubToken()
+		if err != nil {
+			return err
+		}
+		err = db.Model(model.Client{}).Where("id = ?", client.Id).Update("sub_token", token).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(clients) > 0 {
+		logger.Info("generated subscription tokens for ", len(clients), " clients")
+	}
+	return nil
+}
+
+// GetBySubToken returns the enabled client of a subscription token. The token
+// replaced by the last rotation works until its grace period ends.
+func (s *ClientService) GetBySubToken(token string) (*model.Client, error) {
+	if token == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	db := database.GetDB()
+	client := &model.Client{}
+	err := db.Model(model.Client{}).
+		Where("enable = true and (sub_token = ? or (sub_prev_token = ? and sub_prev_expiry > ?))", token, token, time.Now().Unix()).
+		First(client).Error
+	if database.IsNotFound(err) {
+		var settingService SettingService
+		if nameAccess, _ := settingService.GetSubNameAccess(); nameAccess {
+			err = db.Model(model.Client{}).Where("enable = true and name = ?", token).First(client).Error
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// RotateSubToken gives a client a new subscription token and returns it.
+func (s *ClientService) RotateSubToken(id uint) (string, error) {
+	var settingService SettingService
+	grace, err := settingService.GetSubTokenGrace()
+	if err != nil {
+		return "", err
+	}
+	token, err := newSubToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var client model.Client
+		err := tx.Model(model.Client{}).Where("id = ?", id).First(&client).Error
+		if err != nil {
+			return err
+		}
+		prevToken, prevExpiry := "", int64(0)
+		if grace > 0 && client.SubToken != "" {
+			prevToken = client.SubToken
+			prevExpiry = time.Now().Add(time.Duration(grace) * time.Minute).Unix()
+		}
+		return tx.Model(model.Client{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"sub_token":       token,
+			"sub_prev_token":  prevToken,
+			"sub_prev_expiry": prevExpiry,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SubAccessAllowed checks the request against the IP and User-Agent allowlists
+// of a client. Empty lists allow everyone. ip must not come from a forwarded
+// header of an untrusted peer, see middleware.ClientIP.
+func (s *ClientService) SubAccessAllowed(client *model.Client, ip string, userAgent string) bool {
+	if ips := splitAllowList(client.SubAllowIps); len(ips) > 0 {
+		addr := net.ParseIP(ip)
+		if addr == nil || !ipAllowed(ips, addr) {
+			return false
+		}
+	}
+	if agents := splitAllowList(client.SubAllowUAs); len(agents) > 0 {
+		userAgent = strings.ToLower(userAgent)
+		for _, agent := range agents {
+			if strings.Contains(userAgent, strings.ToLower(agent)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func ipAllowed(allowed []string, addr net.IP) bool {
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedIp := net.ParseIP(entry); allowedIp != nil && allowedIp.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitAllowList splits a list separated by commas or new lines.
+func splitAllowList(list string) []string {
+	var result []string
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// prepareSubAccess validates the allowlists and keeps the tokens of a saved
+// client, which the editor does not send back in full.
+func (s *ClientService) prepareSubAccess(tx *gorm.DB, client *model.Client) error {
+	for _, entry := range splitAllowList(client.SubAllowIps) {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return common.NewErrorf("invalid subscription IP allowlist entry: %s", entry)
+		}
+	}
+
+	if client.Id > 0 {
+		var saved model.Client
+		err := tx.Model(model.Client{}).Select("sub_token", "sub_prev_token", "sub_prev_expiry").
+			Where("id = ?", client.Id).First(&saved).Error
+		if err != nil && !database.IsNotFound(err) {
+			return err
+		}
+		if client.SubToken == "" {
+			client.SubToken = saved.SubToken
+		}
+		client.SubPrevToken = saved.SubPrevToken
+		client.SubPrevExpiry = saved.SubPrevExpiry
+	}
+	if client.SubToken == "" {
+		token, err := newSubToken()
+		if err != nil {
+			return err
+		}
+		client.SubToken = token
+	}
+	return nil
+}
@@ -17,13 +17,17 @@ import (
 // require root privileges to run. Creating the TAP device itself might not,
 // depending on /dev/net/tun permissions, but full configuration does.
 type TapService struct {
-	db *gorm.DB
+	db      *gorm.DB
+	routing *RoutingService
+	netns   *NetnsService
 }
 
 // NewTapService creates a new instance of TapService.
 func NewTapService() *TapService {
 	return &TapService{
-		db: database.GetDB(),
+		db:      database.GetDB(),
+		routing: NewRoutingService(),
+		netns:   NewNetnsService(),
 	}
 }
 
@@ -35,15 +39,31 @@ func (s *TapService) CreateTapTunnel(config *model.TapTunnel) error {
 		DeviceType: water.TAP,
 		// Name: config.Name, // water library might not respect this name directly, it generates one
 	}
-	ifce, err := water.New(waterConfig)
+	if err := s.netns.EnsureNamespace(config.Namespace); err != nil {
+		return err
+	}
+	// TUN/TAP devices are created in the namespace of the calling thread
+	var ifce *water.Interface
+	err := runInNamespace(config.Namespace, func() error {
+		var err error
+		ifce, err = water.New(waterConfig)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create TAP device: %w", err)
 	}
 	// Update config name with the actual name generated by water
 	config.Name = ifce.Name()
 
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		_ = ifce.Close() // Rollback water device
+		return err
+	}
+	defer handle.Close()
+
 	// 2. Get the netlink link for the created device
-	link, err := netlink.LinkByName(config.Name)
+	link, err := handle.LinkByName(config.Name)
 	if err != nil {
 		_ = ifce.Close() // Rollback water device
 		return fmt.Errorf("failed to get netlink link for TAP device '%s': %w", config.Name, err)
@@ -51,9 +71,9 @@ func (s *TapService) CreateTapTunnel(config *model.TapTunnel) error {
 
 	// 3. Set MTU
 	if config.MTU > 0 {
-		if err := netlink.LinkSetMTU(link, config.MTU); err != nil {
-			_ = netlink.LinkDel(link) // Rollback netlink device
-			_ = ifce.Close()          // Rollback water device
+		if err := handle.LinkSetMTU(link, config.MTU); err != nil {
+			_ = handle.LinkDel(link) // Rollback netlink device
+			_ = ifce.Close()         // Rollback water device
 			return fmt.Errorf("failed to set MTU for TAP device '%s': %w", config.Name, err)
 		}
 	}
@@ -61,20 +81,20 @@ func (s *TapService) CreateTapTunnel(config *model.TapTunnel) error {
 	// 4. Parse and add IP address
 	addr, err := netlink.ParseAddr(config.LocalAddress)
 	if err != nil {
-		_ = netlink.LinkDel(link) // Rollback netlink device
-		_ = ifce.Close()          // Rollback water device
+		_ = handle.LinkDel(link) // Rollback netlink device
+		_ = ifce.Close()         // Rollback water device
 		return fmt.Errorf("invalid local address '%s' for TAP device: %w", config.LocalAddress, err)
 	}
-	if err := netlink.AddrAdd(link, addr); err != nil {
-		_ = netlink.LinkDel(link) // Rollback netlink device
-		_ = ifce.Close()          // Rollback water device
+	if err := handle.AddrAdd(link, addr); err != nil {
+		_ = handle.LinkDel(link) // Rollback netlink device
+		_ = ifce.Close()         // Rollback water device
 		return fmt.Errorf("failed to add IP address to TAP device '%s': %w", config.Name, err)
 	}
 
 	// 5. Bring the interface up
-	if err := netlink.LinkSetUp(link); err != nil {
-		_ = netlink.LinkDel(link) // Rollback netlink device
-		_ = ifce.Close()          // Rollback water device
+	if err := handle.LinkSetUp(link); err != nil {
+		_ = handle.LinkDel(link) // Rollback netlink device
+		_ = ifce.Close()         // Rollback water device
 		return fmt.Errorf("failed to bring up TAP device '%s': %w", config.Name, err)
 	}
 
@@ -86,6 +106,9 @@ func (s *TapService) CreateTapTunnel(config *model.TapTunnel) error {
 		return fmt.Errorf("failed to save TAP tunnel config to database: %w", err)
 	}
 
+	// Install the routes and policy rules bound to this tunnel
+	s.routing.ApplyTunnelRoutes(config.Name, config.Namespace)
+
 	// NOTE: The 'ifce' (water.Interface) needs to be kept open for the TAP device to persist
 	// and for data to be read/written. For a simple API, we create it and assume
 	// an external process or future logic will handle the data plane.
@@ -104,15 +127,24 @@ func (s *TapService) DeleteTapTunnel(id uint) error {
 		return fmt.Errorf("failed to find TAP tunnel with ID %d: %w", id, err)
 	}
 
+	// Remove the routes and policy rules bound to this tunnel
+	s.routing.RemoveTunnelRoutes(config.Name, config.Namespace)
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
 	// Find the link by name
-	link, err := netlink.LinkByName(config.Name)
+	link, err := handle.LinkByName(config.Name)
 	if err != nil {
 		// If link doesn't exist, we can still proceed to delete from DB
 		// but we should log it.
 		fmt.Printf("Warning: could not find link '%s' to delete, but proceeding with DB record removal. Error: %v\n", config.Name, err)
 	} else {
 		// If link exists, delete it
-		if err := netlink.LinkDel(link); err != nil {
+		if err := handle.LinkDel(link); err != nil {
 			return fmt.Errorf("failed to delete TAP interface '%s': %w", config.Name, err)
 		}
 	}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+const (
+	tgBindCodeLength = 10
+	tgBindCodeTTL    = 15 * time.Minute
+	// No 0/O or 1/I, as clients type the code by hand
+	tgBindCodeChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// TgBindingService binds Telegram accounts to clients for the self-service bot.
+type TgBindingService struct{}
+
+// NewBindCode replaces the pending bind codes of a client with a fresh one-time code.
+func (s *TgBindingService) NewBindCode(clientId uint) (*model.TgBindCode, error) {
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.Client{}).Where("id = ?", clientId).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, common.NewErrorf("client %d not found", clientId)
+	}
+
+	code, err := randomBindCode()
+	if err != nil {
+		return nil, err
+	}
+	bindCode := &model.TgBindCode{
+		ClientId: clientId,
+		Code:     code,
+		Expiry:   time.Now().Add(tgBindCodeTTL).Unix(),
+	}
+
+	tx := db.Begin()
+	err = tx.Where("client_id = ? OR expiry < ?", clientId, time.Now().Unix()).Delete(model.TgBindCode{}).Error
+	if err == nil {
+		err = tx.Create(bindCode).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return bindCode, tx.Commit().Error
+}
+
+// Bind consumes a bind code and links the chat to its client.
+// A chat can only be bound to one client, so binding again replaces the old link.
+func (s *TgBindingService) Bind(code string, chatId int64, username string) (*model.Client, error) {
+	db := database.GetDB()
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	var bindCode model.TgBindCode
+	err := db.Model(model.TgBindCode{}).Where("code = ?", code).First(&bindCode).Error
+	if err != nil {
+		return nil, common.NewError("invalid bind code")
+	}
+	// Codes are single use, even when they have expired
+	db.Delete(&bindCode)
+	if bindCode.Expiry < time.Now().Unix() {
+		return nil, common.NewError("bind code has expired")
+	}
+
+	var client model.Client
+	err = db.Model(model.Client{}).Where("id = ?", bindCode.ClientId).First(&client).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	err = tx.Where("chat_id = ?", chatId).Delete(model.TgBinding{}).Error
+	if err == nil {
+		err = tx.Create(&model.TgBinding{
+			ClientId: client.Id,
+			ChatId:   chatId,
+			Username: username,
+			DateTime: time.Now().Unix(),
+		}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &client, tx.Commit().Error
+}
+
+// Unbind removes the link of a chat.
+func (s *TgBindingService) Unbind(chatId int64) error {
+	return database.GetDB().Where("chat_id = ?", chatId).Delete(model.TgBinding{}).Error
+}
+
+// DeleteBinding removes a link by its ID, used from the panel.
+func (s *TgBindingService) DeleteBinding(id uint) error {
+	return database.GetDB().Delete(model.TgBinding{}, id).Error
+}
+
+// GetBindings returns all links between chats and clients.
+func (s *TgBindingService) GetBindings() ([]model.TgBinding, error) {
+	var bindings []model.TgBinding
+	err := database.GetDB().Model(model.TgBinding{}).Find(&bindings).Error
+	return bindings, err
+}
+
+// GetClientByChat returns the client bound to a chat.
+func (s *TgBindingService) GetClientByChat(chatId int64) (*model.Client, error) {
+	db := database.GetDB()
+	var binding model.TgBinding
+	err := db.Model(model.TgBinding{}).Where("chat_id = ?", chatId).First(&binding).Error
+	if err != nil {
+		return nil, err
+	}
+	var client model.Client
+	err = db.Model(model.Client{}).Where("id = ?", binding.ClientId).First(&client).Error
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// SetWarned records the thresholds a chat has already been warned about.
+func (s *TgBindingService) SetWarned(id uint, volume int, days int) error {
+	return database.GetDB().Model(model.TgBinding{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"warned_volume": volume,
+		"warned_days":   days,
+	}).Error
+}
+
+func randomBindCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(tgBindCodeChars)))
+	for i := 0; i < tgBindCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(tgBindCodeChars[n.Int64()])
+	}
+	return sb.String(), nil
+}
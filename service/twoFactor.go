@@ -0,0 +1,676 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	pendingLoginTTL   = 5 * time.Minute
+	pendingLoginTries = 5
+	recoveryCodeCount = 10
+	totpPeriod        = 30
+	totpIssuer        = "S-UI"
+)
+
+// Second factors offered at login
+const (
+	TwoFactorTotp     = "totp"
+	TwoFactorWebAuthn = "webauthn"
+	TwoFactorTelegram = "telegram"
+)
+
+// RelyingParty identifies the panel to WebAuthn authenticators, it is taken
+// from the request so passkeys work on every domain of the panel.
+type RelyingParty struct {
+	Id     string // Host name without port
+	Origin string // Scheme, host and port
+}
+
+// pendingLogin is a login with a correct password, waiting for the second factor.
+type pendingLogin struct {
+	username string
+	ip       string
+	expiry   time.Time
+	tries    int
+	session  *webauthn.SessionData
+	asked    bool // Telegram approval requested
+	approved int  // Telegram answer, 1 approved and -1 denied
+}
+
+// LoginApprover asks the admins to approve the pending login id.
+type LoginApprover func(id string, username string, ip string) error
+
+var (
+	pendingMu     sync.Mutex
+	pendingLogins = map[string]*pendingLogin{}
+	loginApprover LoginApprover
+)
+
+// SetLoginApprover makes login approval available, the Telegram bot sets it
+// while it runs. A nil approver removes it again.
+func SetLoginApprover(approver LoginApprover) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	loginApprover = approver
+}
+
+// TwoFactorService handles the enrollment and verification of second login factors.
+type TwoFactorService struct{}
+
+func (s *TwoFactorService) getUser(username string) (*model.User, error) {
+	user := &model.User{}
+	err := database.GetDB().Model(model.User{}).Where("username = ?", username).First(user).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Methods returns the second factors of a user, none when 2FA is off.
+func (s *TwoFactorService) Methods(username string) ([]string, error) {
+	user, err := s.getUser(username)
+	if err != nil {
+		return nil, err
+	}
+	var methods []string
+	if user.TotpEnabled {
+		methods = append(methods, TwoFactorTotp)
+	}
+	var count int64
+	err = database.GetDB().Model(model.WebAuthnCredential{}).Where("user_id = ?", user.Id).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		methods = append(methods, TwoFactorWebAuthn)
+	}
+	pendingMu.Lock()
+	hasApprover := loginApprover != nil
+	pendingMu.Unlock()
+	// Telegram approval is an alternative, not a factor on its own
+	if len(methods) > 0 && hasApprover {
+		methods = append(methods, TwoFactorTelegram)
+	}
+	return methods, nil
+}
+
+// GetStatus returns the 2FA enrollment of a user for the settings page.
+func (s *TwoFactorService) GetStatus(username string) (map[string]interface{}, error) {
+	user, err := s.getUser(username)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []model.WebAuthnCredential
+	err = database.GetDB().Model(model.WebAuthnCredential{}).Where("user_id = ?", user.Id).Find(&credentials).Error
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	if user.RecoveryCodes != "" {
+		json.Unmarshal([]byte(user.RecoveryCodes), &codes)
+	}
+	return map[string]interface{}{
+		"totp":          user.TotpEnabled,
+		"recoveryCodes": len(codes),
+		"credentials":   credentials,
+	}, nil
+}
+
+// TotpSetup creates a new TOTP secret and returns its otpauth:// URL. The
+// secret is only used after TotpEnable confirmed it with a code.
+func (s *TwoFactorService) TotpSetup(username string) (string, error) {
+	user, err := s.getUser(username)
+	if err != nil {
+		return "", err
+	}
+	if user.TotpEnabled {
+		return "", common.NewError("TOTP is already enabled")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: username,
+	})
+	if err != nil {
+		return "", err
+	}
+	err = database.GetDB().Model(model.User{}).Where("id = ?", user.Id).Update("totp_secret", key.Secret()).Error
+	if err != nil {
+		return "", err
+	}
+	return key.URL(), nil
+}
+
+// TotpEnable turns TOTP on after checking a code of the pending secret, and
+// returns new recovery codes. They are only shown this once.
+func (s *TwoFactorService) TotpEnable(username string, code string) ([]string, error) {
+	user, err := s.getUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, common.NewError("TOTP is already enabled")
+	}
+	if user.TotpSecret == "" {
+		return nil, common.NewError("TOTP setup has not been started")
+	}
+	step := totpStep(strings.TrimSpace(code), user.TotpSecret)
+	if step < 0 {
+		return nil, common.NewError("invalid code")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = database.GetDB().Model(model.User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"totp_enabled":   true,
+		"totp_last_step": step,
+		"recovery_codes": hashes,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("user ", username, " enabled TOTP")
+	return codes, nil
+}
+
+// TotpDisable turns TOTP off, it takes a current code or a recovery code.
+func (s *TwoFactorService) TotpDisable(username string, code string) error {
+	user, err := s.getUser(username)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return common.NewError("TOTP is not enabled")
+	}
+	if !s.verifyCode(user, code) {
+		return common.NewError("invalid code")
+	}
+	err = database.GetDB().Model(model.User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"recovery_codes": "",
+	}).Error
+	if err == nil {
+		logger.Info("user ", username, " disabled TOTP")
+	}
+	return err
+}
+
+// Reset removes every second factor of a user, for admins who lost them.
+func (s *TwoFactorService) Reset(username string) error {
+	user, err := s.getUser(username)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	tx := db.Begin()
+	err = tx.Model(model.User{}).Where("id = ?", user.Id).Updates(map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"recovery_codes": "",
+	}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", user.Id).Delete(model.WebAuthnCredential{}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// verifyCode consumes a TOTP code or a recovery code, each is accepted once.
+func (s *TwoFactorService) verifyCode(user *model.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false
+	}
+	if user.TotpEnabled && s.useTotp(user, code) {
+		return true
+	}
+	var hashes []string
+	if user.RecoveryCodes == "" || json.Unmarshal([]byte(user.RecoveryCodes), &hashes) != nil {
+		return false
+	}
+	hash := hashRecoveryCode(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			remaining, _ := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+			// Only one of concurrent logins with the same code may remove it
+			result := database.GetDB().Model(model.User{}).
+				Where("id = ? AND recovery_codes = ?", user.Id, user.RecoveryCodes).
+				Update("recovery_codes", string(remaining))
+			if result.Error != nil {
+				logger.Warning("unable to consume the recovery code of ", user.Username, ": ", result.Error)
+				return false
+			}
+			if result.RowsAffected != 1 {
+				return false
+			}
+			logger.Info("user ", user.Username, " used a recovery code, ", len(hashes)-1, " left")
+			return true
+		}
+	}
+	return false
+}
+
+// useTotp accepts a TOTP code unless its time step, or a later one, was
+// accepted before, so a captured code can't be replayed.
+func (s *TwoFactorService) useTotp(user *model.User, code string) bool {
+	step := totpStep(code, user.TotpSecret)
+	if step < 0 {
+		return false
+	}
+	result := database.GetDB().Model(model.User{}).
+		Where("id = ? AND totp_last_step < ?", user.Id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		logger.Warning("unable to record the TOTP code of ", user.Username, ": ", result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+// totpStep returns the time step a TOTP code is valid for, allowing one step
+// of clock skew like totp.Validate, or -1 for an invalid code.
+func totpStep(code string, secret string) int64 {
+	now := time.Now().Unix() / totpPeriod
+	for _, step := range []int64{now, now - 1, now + 1} {
+		valid, err := hotp.ValidateCustom(code, uint64(step), secret, hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err == nil && valid {
+			return step
+		}
+	}
+	return -1
+}
+
+// newRecoveryCodes returns recovery codes and the JSON list of their hashes.
+// They are random enough for a plain SHA-256.
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	hashesJson, err := json.Marshal(hashes)
+	return codes, string(hashesJson), err
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// webAuthnUser adapts an admin to the WebAuthn user interface.
+type webAuthnUser struct {
+	user        *model.User
+	credentials []webauthn.Credential
+}
+
+// WebAuthnID is the user ID, so renaming the admin keeps the credentials.
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.Id), 10))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (s *TwoFactorService) getWebAuthnUser(username string) (*webAuthnUser, error) {
+	user, err := s.getUser(username)
+	if err != nil {
+		return nil, err
+	}
+	var stored []model.WebAuthnCredential
+	err = database.GetDB().Model(model.WebAuthnCredential{}).Where("user_id = ?", user.Id).Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	result := &webAuthnUser{user: user}
+	for _, c := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(c.Credential, &credential); err != nil {
+			logger.Warning("invalid WebAuthn credential ", c.Id, ": ", err)
+			continue
+		}
+		result.credentials = append(result.credentials, credential)
+	}
+	return result, nil
+}
+
+func newWebAuthn(rp RelyingParty) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          rp.Id,
+		RPDisplayName: totpIssuer,
+		RPOrigins:     []string{rp.Origin},
+	})
+}
+
+// registrations holds the WebAuthn sessions of started registrations, per user.
+var registrations sync.Map // username -> *webauthn.SessionData
+
+// WebAuthnBeginRegistration returns the options for navigator.credentials.create().
+func (s *TwoFactorService) WebAuthnBeginRegistration(username string, rp RelyingParty) (*protocol.CredentialCreation, error) {
+	user, err := s.getWebAuthnUser(username)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWebAuthn(rp)
+	if err != nil {
+		return nil, err
+	}
+	creation, session, err := w.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()))
+	if err != nil {
+		return nil, err
+	}
+	registrations.Store(username, session)
+	return creation, nil
+}
+
+// WebAuthnFinishRegistration stores the credential created by the browser,
+// the request body is its response.
+func (s *TwoFactorService) WebAuthnFinishRegistration(username string, name string, rp RelyingParty, r *http.Request) error {
+	value, ok := registrations.LoadAndDelete(username)
+	if !ok {
+		return common.NewError("WebAuthn registration has not been started")
+	}
+	user, err := s.getWebAuthnUser(username)
+	if err != nil {
+		return err
+	}
+	w, err := newWebAuthn(rp)
+	if err != nil {
+		return err
+	}
+	credential, err := w.FinishRegistration(user, *value.(*webauthn.SessionData), r)
+	if err != nil {
+		return err
+	}
+	credentialJson, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = "Key " + time.Now().Format("2006-01-02")
+	}
+	err = database.GetDB().Create(&model.WebAuthnCredential{
+		UserId:       user.user.Id,
+		Name:         name,
+		CredentialId: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Credential:   credentialJson,
+		CreatedAt:    time.Now().Unix(),
+	}).Error
+	if err == nil {
+		logger.Info("user ", username, " registered WebAuthn credential ", name)
+	}
+	return err
+}
+
+// WebAuthnDelete removes a credential of a user.
+func (s *TwoFactorService) WebAuthnDelete(username string, id uint) error {
+	user, err := s.getUser(username)
+	if err != nil {
+		return err
+	}
+	result := database.GetDB().Where("id = ? AND user_id = ?", id, user.Id).Delete(model.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewErrorf("credential %d not found", id)
+	}
+	return nil
+}
+
+// StartLogin keeps a login with a correct password until its second factor
+// arrives, and returns the ID which the browser passes back.
+func (s *TwoFactorService) StartLogin(username string, ip string) string {
+	id := common.Random(32)
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	now := time.Now()
+	for key, p := range pendingLogins {
+		if now.After(p.expiry) {
+			delete(pendingLogins, key)
+		}
+	}
+	pendingLogins[id] = &pendingLogin{
+		username: username,
+		ip:       ip,
+		expiry:   now.Add(pendingLoginTTL),
+	}
+	return id
+}
+
+// getPending returns a pending login and counts the attempt. Logins without
+// attempts left are dropped, so the password has to be entered again.
+// pendingMu has to be held.
+func getPending(id string, attempt bool) (*pendingLogin, error) {
+	p, ok := pendingLogins[id]
+	if !ok || time.Now().After(p.expiry) {
+		delete(pendingLogins, id)
+		return nil, common.NewError("login expired, please sign in again")
+	}
+	if attempt {
+		p.tries++
+		if p.tries > pendingLoginTries {
+			delete(pendingLogins, id)
+			return nil, common.NewError("too many attempts, please sign in again")
+		}
+	}
+	return p, nil
+}
+
+func (s *TwoFactorService) loginFailed(p *pendingLogin, method string) {
+	var loginGuard LoginGuardService
+	loginGuard.Failed(p.ip, p.username)
+	events.Publish(events.LoginFailed, "failed "+method+" login for user '"+p.username+"' from "+p.ip,
+		map[string]interface{}{"user": p.username, "ip": p.ip})
+}
+
+// LoginCode completes a pending login with a TOTP or recovery code.
+func (s *TwoFactorService) LoginCode(id string, code string) (string, error) {
+	pendingMu.Lock()
+	p, err := getPending(id, true)
+	pendingMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	user, err := s.getUser(p.username)
+	if err != nil {
+		return "", err
+	}
+	if !s.verifyCode(user, code) {
+		s.loginFailed(p, "2FA")
+		return "", common.NewError("invalid code")
+	}
+	if !s.finishLogin(id) {
+		return "", common.NewError("login expired, please sign in again")
+	}
+	return p.username, nil
+}
+
+// LoginWebAuthnBegin returns the options for navigator.credentials.get().
+func (s *TwoFactorService) LoginWebAuthnBegin(id string, rp RelyingParty) (*protocol.CredentialAssertion, error) {
+	pendingMu.Lock()
+	p, err := getPending(id, false)
+	pendingMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.getWebAuthnUser(p.username)
+	if err != nil {
+		return nil, err
+	}
+	w, err := newWebAuthn(rp)
+	if err != nil {
+		return nil, err
+	}
+	assertion, session, err := w.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+	pendingMu.Lock()
+	p.session = session
+	pendingMu.Unlock()
+	return assertion, nil
+}
+
+// LoginWebAuthn completes a pending login with the assertion in the request body.
+func (s *TwoFactorService) LoginWebAuthn(id string, rp RelyingParty, r *http.Request) (string, error) {
+	pendingMu.Lock()
+	p, err := getPending(id, true)
+	var session *webauthn.SessionData
+	if err == nil {
+		session, p.session = p.session, nil
+	}
+	pendingMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if session == nil {
+		return "", common.NewError("WebAuthn login has not been started")
+	}
+	user, err := s.getWebAuthnUser(p.username)
+	if err != nil {
+		return "", err
+	}
+	w, err := newWebAuthn(rp)
+	if err != nil {
+		return "", err
+	}
+	credential, err := w.FinishLogin(user, *session, r)
+	if err != nil {
+		s.loginFailed(p, "WebAuthn")
+		return "", err
+	}
+	if credential.Authenticator.CloneWarning {
+		logger.Warning("WebAuthn credential of ", p.username, " may be cloned, its sign count went back")
+	}
+	// Keep the sign count up to date
+	credentialJson, _ := json.Marshal(credential)
+	err = database.GetDB().Model(model.WebAuthnCredential{}).
+		Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(credential.ID)).
+		Updates(map[string]interface{}{"credential": credentialJson, "last_used": time.Now().Unix()}).Error
+	if err != nil {
+		logger.Warning("unable to update WebAuthn credential: ", err)
+	}
+	if !s.finishLogin(id) {
+		return "", common.NewError("login expired, please sign in again")
+	}
+	return p.username, nil
+}
+
+// LoginTelegram asks the admins to approve a pending login on its first call,
+// and returns the username once approved. done is false while nobody answered.
+func (s *TwoFactorService) LoginTelegram(id string) (username string, done bool, err error) {
+	pendingMu.Lock()
+	p, err := getPending(id, false)
+	if err != nil {
+		pendingMu.Unlock()
+		return "", false, err
+	}
+	approver := loginApprover
+	ask := !p.asked
+	p.asked = true
+	approved := p.approved
+	pendingMu.Unlock()
+
+	if approver == nil {
+		return "", false, common.NewError("Telegram bot is not running")
+	}
+	if ask {
+		if err := approver(id, p.username, p.ip); err != nil {
+			pendingMu.Lock()
+			p.asked = false
+			pendingMu.Unlock()
+			return "", false, err
+		}
+		return "", false, nil
+	}
+	switch approved {
+	case 1:
+		if !s.finishLogin(id) {
+			return "", true, common.NewError("login expired, please sign in again")
+		}
+		return p.username, true, nil
+	case -1:
+		s.finishLogin(id)
+		s.loginFailed(p, "Telegram")
+		return "", true, common.NewError("login denied")
+	}
+	return "", false, nil
+}
+
+// ResolveLogin records the answer of an admin to a login approval request.
+func (s *TwoFactorService) ResolveLogin(id string, approve bool) (username string, ip string, err error) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	p, err := getPending(id, false)
+	if err != nil {
+		return "", "", err
+	}
+	if !p.asked || p.approved != 0 {
+		return "", "", common.NewError("login has already been answered")
+	}
+	if approve {
+		p.approved = 1
+	} else {
+		p.approved = -1
+	}
+	return p.username, p.ip, nil
+}
+
+// finishLogin removes a pending login once its second factor is verified. It
+// reports false when a concurrent request has already finished it, only the
+// request which removed it may log in.
+func (s *TwoFactorService) finishLogin(id string) bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if _, ok := pendingLogins[id]; !ok {
+		return false
+	}
+	delete(pendingLogins, id)
+	return true
+}
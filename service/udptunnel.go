@@ -21,6 +21,7 @@ type UdpTunnelService struct {
 	db             *gorm.DB
 	runningTunnels map[uint]*UdpTunnelInstance
 	mu             sync.Mutex
+	netns          *NetnsService
 }
 
 // UdpTunnelInstance holds the context and cancel function for a running tunnel
@@ -34,6 +35,7 @@ func NewUdpTunnelService(db *gorm.DB) *UdpTunnelService {
 	return &UdpTunnelService{
 		db:             db,
 		runningTunnels: make(map[uint]*UdpTunnelInstance),
+		netns:          NewNetnsService(),
 	}
 }
 
@@ -45,6 +47,11 @@ func (s *UdpTunnelService) StartUdpTunnel(cfg *model.UdpTunnelConfig) error {
 		return fmt.Errorf("UDP tunnel %s is already running", cfg.Name)
 	}
 
+	if err := s.netns.EnsureNamespace(cfg.Namespace); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	instance := &UdpTunnelInstance{
 		Cancel: cancel,
@@ -56,7 +63,10 @@ func (s *UdpTunnelService) StartUdpTunnel(cfg *model.UdpTunnelConfig) error {
 	log.Printf("Starting pure Go UDP tunnel %s (Mode: %s, Role: %s)", cfg.Name, cfg.Mode, cfg.Role)
 
 	go func() {
-		err := s.runTunnel(ctx, cfg) // Corrected function name
+		// The tunnel loop opens its sockets and runs on a thread inside the configured namespace
+		err := runInNamespace(cfg.Namespace, func() error {
+			return s.runTunnel(ctx, cfg)
+		})
 		if err != nil {
 			log.Printf("Error running tunnel %s: %v", cfg.Name, err)
 		}
@@ -635,10 +645,16 @@ func (s *UdpTunnelService) GetUdpTunnelByName(name string) (*model.UdpTunnelConf
 }
 
 func (s *UdpTunnelService) CreateUdpTunnel(cfg *model.UdpTunnelConfig) error {
+	if err := validateNamespace(cfg.Namespace); err != nil {
+		return err
+	}
 	return s.db.Create(cfg).Error
 }
 
 func (s *UdpTunnelService) UpdateUdpTunnel(cfg *model.UdpTunnelConfig) error {
+	if err := validateNamespace(cfg.Namespace); err != nil {
+		return err
+	}
 	return s.db.Save(cfg).Error
 }
 
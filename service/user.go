@@ -1,12 +1,16 @@
 package service
 
 import (
-	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
 	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util"
 	"github.com/igor04091968/sing-chisel-tel/util/common"
 )
 
@@ -32,24 +36,35 @@ func (s *UserService) UpdateFirstUser(username string, password string) error {
 	} else if password == "" {
 		return common.NewError("password can not be empty")
 	}
+	hash, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
 	db := database.GetDB()
 	user := &model.User{}
-	err := db.Model(model.User{}).First(user).Error
+	err = db.Model(model.User{}).First(user).Error
 	if database.IsNotFound(err) {
 		user.Username = username
-		user.Password = password
+		user.Password = hash
 		return db.Model(model.User{}).Create(user).Error
 	} else if err != nil {
 		return err
 	}
 	user.Username = username
-	user.Password = password
+	user.Password = hash
 	return db.Save(user).Error
 }
 
 func (s *UserService) Login(username string, password string, remoteIP string) (string, error) {
+	var loginGuard LoginGuardService
+	if err := loginGuard.Check(remoteIP, username); err != nil {
+		return "", err
+	}
 	user := s.CheckUser(username, password, remoteIP)
 	if user == nil {
+		loginGuard.Failed(remoteIP, username)
+		events.Publish(events.LoginFailed, fmt.Sprintf("failed login for user '%s' from %s", username, remoteIP),
+			map[string]interface{}{"user": username, "ip": remoteIP})
 		return "", common.NewError("wrong user or password! IP: ", remoteIP)
 	}
 	return user.Username, nil
@@ -60,15 +75,24 @@ func (s *UserService) CheckUser(username string, password string, remoteIP strin
 
 	user := &model.User{}
 	err := db.Model(model.User{}).
-		Where("username = ? and password = ?", username, password).
+		Where("username = ?", username).
 		First(user).
 		Error
 	if database.IsNotFound(err) {
+		// Take as long as for an existing user
+		util.VerifyPassword(dummyPasswordHash(), password)
 		return nil
 	} else if err != nil {
 		logger.Warning("check user err:", err, " IP: ", remoteIP)
 		return nil
 	}
+	ok, needsRehash := util.VerifyPassword(user.Password, password)
+	if !ok {
+		return nil
+	}
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
 
 	lastLoginTxt := time.Now().Format("2006-01-02 15:04:05") + " " + remoteIP
 	err = db.Model(model.User{}).
@@ -80,10 +104,32 @@ func (s *UserService) CheckUser(username string, password string, remoteIP strin
 	return user
 }
 
+// dummyPasswordHash is verified for unknown users, so their logins are not
+// answered faster.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := util.HashPassword(common.Random(16))
+	return hash
+})
+
+// rehashPassword replaces a plaintext or bcrypt password with an argon2id hash.
+func (s *UserService) rehashPassword(user *model.User, password string) {
+	hash, err := util.HashPassword(password)
+	if err != nil {
+		logger.Warning("unable to hash the password of ", user.Username, ": ", err)
+		return
+	}
+	err = database.GetDB().Model(model.User{}).Where("id = ?", user.Id).Update("password", hash).Error
+	if err != nil {
+		logger.Warning("unable to store the password hash of ", user.Username, ": ", err)
+		return
+	}
+	user.Password = hash
+}
+
 func (s *UserService) GetUsers() (*[]model.User, error) {
 	var users []model.User
 	db := database.GetDB()
-	err := db.Model(model.User{}).Select("id,username,last_logins").Scan(&users).Error
+	err := db.Model(model.User{}).Select("id,username,last_logins,role,totp_enabled").Scan(&users).Error
 	if err != nil {
 		return nil, err
 	}
@@ -93,38 +139,29 @@ func (s *UserService) GetUsers() (*[]model.User, error) {
 func (s *UserService) ChangePass(id string, oldPass string, newUser string, newPass string) error {
 	db := database.GetDB()
 	user := &model.User{}
-	err := db.Model(model.User{}).Where("id = ? AND password = ?", id, oldPass).First(user).Error
-	if err != nil || database.IsNotFound(err) {
+	err := db.Model(model.User{}).Where("id = ?", id).First(user).Error
+	if err != nil {
 		return err
 	}
-	user.Username = newUser
-	user.Password = newPass
-	return db.Save(user).Error
-}
-
-func (s *UserService) LoadTokens() ([]byte, error) {
-	db := database.GetDB()
-	var tokens []model.Tokens
-	err := db.Model(model.Tokens{}).Preload("User").Where("expiry == 0 or expiry > ?", time.Now().Unix()).Find(&tokens).Error
-	if err != nil {
-		return nil, err
+	if ok, _ := util.VerifyPassword(user.Password, oldPass); !ok {
+		return common.NewError("wrong password")
+	}
+	if newPass == "" {
+		return common.NewError("password can not be empty")
 	}
-	var result []map[string]interface{}
-	for _, t := range tokens {
-		result = append(result, map[string]interface{}{
-			"token":    t.Token,
-			"expiry":   t.Expiry,
-			"username": t.User.Username,
-		})
+	hash, err := util.HashPassword(newPass)
+	if err != nil {
+		return err
 	}
-	jsonResult, _ := json.MarshalIndent(result, "", "  ")
-	return jsonResult, nil
+	user.Username = newUser
+	user.Password = hash
+	return db.Save(user).Error
 }
 
 func (s *UserService) GetUserTokens(username string) (*[]model.Tokens, error) {
 	db := database.GetDB()
 	var token []model.Tokens
-	err := db.Model(model.Tokens{}).Select("id,desc,'****' as token,expiry,user_id").Where("user_id = (select id from users where username = ?)", username).Find(&token).Error
+	err := db.Model(model.Tokens{}).Select("id,desc,'****' as token,expiry,user_id,scopes,groups,rate_limit,last_used,last_ip").Where("user_id = (select id from users where username = ?)", username).Find(&token).Error
 	if err != nil && !database.IsNotFound(err) {
 		println(err.Error())
 		return nil, err
@@ -132,30 +169,152 @@ func (s *UserService) GetUserTokens(username string) (*[]model.Tokens, error) {
 	return &token, nil
 }
 
-func (s *UserService) AddToken(username string, expiry int64, desc string) (string, error) {
+// AddToken creates a token and returns it, only its hash is stored.
+func (s *UserService) AddToken(username string, expiry int64, desc string, scopes string, groups string, rateLimit int) (string, error) {
 	db := database.GetDB()
-	var userId uint
-	err := db.Model(model.User{}).Where("username = ?", username).Select("id").Scan(&userId).Error
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("username = ?", username).First(user).Error
 	if err != nil {
 		return "", err
 	}
+	if err = validateScopes(user.Role, scopes); err != nil {
+		return "", err
+	}
+	if rateLimit < 0 {
+		return "", common.NewError("rate limit can not be negative")
+	}
 	if expiry > 0 {
 		expiry = expiry*86400 + time.Now().Unix()
 	}
+	plain := common.Random(32)
 	token := &model.Tokens{
-		Token:  common.Random(32),
-		Desc:   desc,
-		Expiry: expiry,
-		UserId: userId,
+		Token:     util.HashToken(plain),
+		Desc:      desc,
+		Expiry:    expiry,
+		UserId:    user.Id,
+		Scopes:    strings.Join(splitAllowList(scopes), ","),
+		Groups:    strings.Join(splitAllowList(groups), ","),
+		RateLimit: rateLimit,
 	}
 	err = db.Create(token).Error
 	if err != nil {
 		return "", err
 	}
-	return token.Token, nil
+	return plain, nil
+}
+
+// DeleteToken deletes a token of a user, others' tokens are left alone.
+func (s *UserService) DeleteToken(username string, id string) error {
+	db := database.GetDB()
+	result := db.Where("id = ? AND user_id = (select id from users where username = ?)", id, username).Delete(&model.Tokens{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewErrorf("token %s not found", id)
+	}
+	return nil
+}
+
+// GetRole returns the role of a user.
+func (s *UserService) GetRole(username string) (string, error) {
+	var user model.User
+	err := database.GetDB().Model(model.User{}).Select("role").Where("username = ?", username).First(&user).Error
+	if err != nil {
+		return "", err
+	}
+	if user.Role == "" {
+		return RoleAdmin, nil
+	}
+	return user.Role, nil
+}
+
+// AddUser creates an admin with a role.
+func (s *UserService) AddUser(username string, password string, role string) error {
+	if username == "" {
+		return common.NewError("username can not be empty")
+	} else if password == "" {
+		return common.NewError("password can not be empty")
+	}
+	if _, err := RolePermissions(role); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.User{}).Where("username = ?", username).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewErrorf("user %s already exists", username)
+	}
+	hash, err := util.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Create(&model.User{Username: username, Password: hash, Role: role}).Error
+}
+
+// SetRole changes the role of an admin. The last admin role can't be given away.
+func (s *UserService) SetRole(id string, role string) error {
+	if _, err := RolePermissions(role); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("id = ?", id).First(user).Error
+	if err != nil {
+		return err
+	}
+	if role != RoleAdmin {
+		if err = s.keepLastAdmin(user); err != nil {
+			return err
+		}
+	}
+	return db.Model(model.User{}).Where("id = ?", id).Update("role", role).Error
 }
 
-func (s *UserService) DeleteToken(id string) error {
+// DeleteUser removes an admin with their tokens and second factors.
+func (s *UserService) DeleteUser(id string, actor string) error {
 	db := database.GetDB()
-	return db.Model(model.Tokens{}).Where("id = ?", id).Delete(&model.Tokens{}).Error
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("id = ?", id).First(user).Error
+	if err != nil {
+		return err
+	}
+	if user.Username == actor {
+		return common.NewError("you can not delete yourself")
+	}
+	if err = s.keepLastAdmin(user); err != nil {
+		return err
+	}
+	tx := db.Begin()
+	err = tx.Where("user_id = ?", user.Id).Delete(model.Tokens{}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", user.Id).Delete(model.WebAuthnCredential{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(user).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// keepLastAdmin returns an error if user is the only one with the admin role.
+func (s *UserService) keepLastAdmin(user *model.User) error {
+	if user.Role != RoleAdmin && user.Role != "" {
+		return nil
+	}
+	var count int64
+	err := database.GetDB().Model(model.User{}).Where("(role = ? OR role = '' OR role IS NULL) AND id <> ?", RoleAdmin, user.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return common.NewError("the last admin can not lose the admin role")
+	}
+	return nil
 }
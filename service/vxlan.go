@@ -0,0 +1,405 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/igor04091968/sing-chisel-tel/database"
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/vishvananda/netlink"
+	"gorm.io/gorm"
+)
+
+const (
+	vxlanDefaultPort  = 4789
+	geneveDefaultPort = 6081
+	vxlanMaxVNI       = 1<<24 - 1
+)
+
+// VxlanService handles the business logic for VXLAN and GENEVE overlay tunnels.
+// NOTE: All methods that manipulate network interfaces require root privileges to run.
+type VxlanService struct {
+	db      *gorm.DB
+	routing *RoutingService
+	netns   *NetnsService
+}
+
+// NewVxlanService creates a new instance of VxlanService.
+func NewVxlanService() *VxlanService {
+	return &VxlanService{
+		db:      database.GetDB(),
+		routing: NewRoutingService(),
+		netns:   NewNetnsService(),
+	}
+}
+
+// CreateVxlanTunnel creates a new VXLAN or GENEVE interface, installs its static
+// FDB entries and saves its config to the DB.
+// This operation requires root privileges.
+func (s *VxlanService) CreateVxlanTunnel(config *model.VxlanTunnel) error {
+	if config.Type == "" {
+		config.Type = "vxlan"
+	}
+	if config.VNI < 0 || config.VNI > vxlanMaxVNI {
+		return fmt.Errorf("invalid VNI %d: must be between 0 and %d", config.VNI, vxlanMaxVNI)
+	}
+
+	entries, err := parseFdbEntries(config.FdbEntries)
+	if err != nil {
+		return err
+	}
+
+	var link netlink.Link
+	switch config.Type {
+	case "vxlan":
+		link, err = s.buildVxlanLink(config)
+	case "geneve":
+		if len(entries) > 0 {
+			return fmt.Errorf("static FDB entries are not supported for GENEVE tunnel '%s'", config.Name)
+		}
+		link, err = s.buildGeneveLink(config)
+	default:
+		return fmt.Errorf("unsupported overlay tunnel type: %s", config.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Make sure the target namespace exists
+	if err := s.netns.EnsureNamespace(config.Namespace); err != nil {
+		return err
+	}
+
+	// The interface is created from the host namespace, so the UDP socket and the
+	// underlay device stay there even when the interface is moved into the target namespace
+	nsFd, err := namespaceFd(config.Namespace)
+	if err != nil {
+		return err
+	}
+	if nsFd != nil {
+		defer nsFd.Close()
+		link.Attrs().Namespace = netlink.NsFd(*nsFd)
+	}
+
+	// Add the overlay interface
+	if err := netlink.LinkAdd(link); err != nil {
+		return fmt.Errorf("failed to add %s interface '%s': %w", config.Type, config.Name, err)
+	}
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		_ = s.netns.DeleteLink(config.Namespace, config.Name) // Rollback
+		return err
+	}
+	defer handle.Close()
+
+	link, err = handle.LinkByName(config.Name)
+	if err != nil {
+		_ = s.netns.DeleteLink(config.Namespace, config.Name) // Rollback
+		return fmt.Errorf("failed to find %s interface '%s': %w", config.Type, config.Name, err)
+	}
+
+	if config.MTU > 0 {
+		if err := handle.LinkSetMTU(link, config.MTU); err != nil {
+			_ = handle.LinkDel(link) // Rollback
+			return fmt.Errorf("failed to set MTU for tunnel '%s': %w", config.Name, err)
+		}
+	}
+
+	if config.TunnelAddress != "" {
+		addr, err := netlink.ParseAddr(config.TunnelAddress)
+		if err != nil {
+			_ = handle.LinkDel(link) // Rollback
+			return fmt.Errorf("invalid tunnel address '%s': %w", config.TunnelAddress, err)
+		}
+		if err := handle.AddrAdd(link, addr); err != nil {
+			_ = handle.LinkDel(link) // Rollback
+			return fmt.Errorf("failed to add address to tunnel '%s': %w", config.Name, err)
+		}
+	}
+
+	for _, entry := range entries {
+		if err := s.appendFdbEntry(handle, link, entry); err != nil {
+			_ = handle.LinkDel(link) // Rollback
+			return err
+		}
+	}
+
+	// Bring the tunnel interface up
+	if err := handle.LinkSetUp(link); err != nil {
+		_ = handle.LinkDel(link) // Rollback
+		return fmt.Errorf("failed to bring up tunnel '%s': %w", config.Name, err)
+	}
+
+	// Save to database
+	config.Status = "up"
+	if err := s.db.Create(config).Error; err != nil {
+		_ = handle.LinkDel(link) // Rollback
+		return fmt.Errorf("failed to save %s tunnel config to database: %w", config.Type, err)
+	}
+
+	// Install the routes and policy rules bound to this tunnel
+	s.routing.ApplyTunnelRoutes(config.Name, config.Namespace)
+
+	return nil
+}
+
+func (s *VxlanService) buildVxlanLink(config *model.VxlanTunnel) (netlink.Link, error) {
+	vxlan := &netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: config.Name,
+		},
+		VxlanId:  config.VNI,
+		Learning: config.Learning,
+		Port:     config.Port,
+	}
+	if vxlan.Port == 0 {
+		vxlan.Port = vxlanDefaultPort
+		config.Port = vxlanDefaultPort
+	}
+
+	if config.LocalAddress != "" {
+		localIP := net.ParseIP(config.LocalAddress)
+		if localIP == nil {
+			return nil, fmt.Errorf("invalid local address: %s", config.LocalAddress)
+		}
+		vxlan.SrcAddr = localIP
+	}
+
+	if config.RemoteAddress != "" {
+		remoteIP := net.ParseIP(config.RemoteAddress)
+		if remoteIP == nil {
+			return nil, fmt.Errorf("invalid remote address: %s", config.RemoteAddress)
+		}
+		vxlan.Group = remoteIP
+		if remoteIP.IsMulticast() && config.Device == "" {
+			return nil, fmt.Errorf("multicast group %s requires an underlay device", config.RemoteAddress)
+		}
+	}
+
+	if config.Device != "" {
+		parent, err := netlink.LinkByName(config.Device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find underlay device '%s': %w", config.Device, err)
+		}
+		vxlan.VtepDevIndex = parent.Attrs().Index
+	}
+
+	return vxlan, nil
+}
+
+func (s *VxlanService) buildGeneveLink(config *model.VxlanTunnel) (netlink.Link, error) {
+	remoteIP := net.ParseIP(config.RemoteAddress)
+	if remoteIP == nil {
+		return nil, fmt.Errorf("invalid remote address: %s", config.RemoteAddress)
+	}
+	if config.Port == 0 {
+		config.Port = geneveDefaultPort
+	}
+	return &netlink.Geneve{
+		LinkAttrs: netlink.LinkAttrs{
+			Name: config.Name,
+		},
+		ID:     uint32(config.VNI),
+		Remote: remoteIP,
+		Dport:  uint16(config.Port),
+	}, nil
+}
+
+// DeleteVxlanTunnel deletes an overlay interface and removes its config from the DB.
+// This operation requires root privileges.
+func (s *VxlanService) DeleteVxlanTunnel(id uint) error {
+	// First, find the config in the DB
+	config, err := s.GetVxlanTunnel(id)
+	if err != nil {
+		return fmt.Errorf("failed to find overlay tunnel with ID %d: %w", id, err)
+	}
+
+	// Remove the routes and policy rules bound to this tunnel
+	s.routing.RemoveTunnelRoutes(config.Name, config.Namespace)
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	// Find the link by name
+	link, err := handle.LinkByName(config.Name)
+	if err != nil {
+		// If link doesn't exist, we can still proceed to delete from DB
+		logger.Warning("could not find link ", config.Name, " to delete, removing its config anyway: ", err)
+	} else {
+		// If link exists, delete it
+		if err := handle.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete %s interface '%s': %w", config.Type, config.Name, err)
+		}
+	}
+
+	// Delete from database
+	if err := s.db.Delete(&model.VxlanTunnel{}, id).Error; err != nil {
+		return fmt.Errorf("failed to delete overlay tunnel config from database: %w", err)
+	}
+
+	return nil
+}
+
+// AddVxlanFdbEntry installs a static FDB entry on a VXLAN tunnel and persists it.
+// This operation requires root privileges.
+func (s *VxlanService) AddVxlanFdbEntry(id uint, entry model.VxlanFdbEntry) error {
+	config, err := s.GetVxlanTunnel(id)
+	if err != nil {
+		return fmt.Errorf("failed to find overlay tunnel with ID %d: %w", id, err)
+	}
+	if config.Type != "vxlan" {
+		return fmt.Errorf("static FDB entries are not supported for %s tunnel '%s'", config.Type, config.Name)
+	}
+
+	entries, err := parseFdbEntries(config.FdbEntries)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Dst == entry.Dst && e.MAC == entry.MAC {
+			return fmt.Errorf("FDB entry %s -> %s already exists on tunnel '%s'", entry.MAC, entry.Dst, config.Name)
+		}
+	}
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	link, err := handle.LinkByName(config.Name)
+	if err != nil {
+		return fmt.Errorf("failed to find link '%s': %w", config.Name, err)
+	}
+	if err := s.appendFdbEntry(handle, link, entry); err != nil {
+		return err
+	}
+
+	entries = append(entries, entry)
+	config.FdbEntries, err = json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.db.Model(config).Update("fdb_entries", config.FdbEntries).Error
+}
+
+// DeleteVxlanFdbEntry removes a static FDB entry from a VXLAN tunnel and from its config.
+// This operation requires root privileges.
+func (s *VxlanService) DeleteVxlanFdbEntry(id uint, entry model.VxlanFdbEntry) error {
+	config, err := s.GetVxlanTunnel(id)
+	if err != nil {
+		return fmt.Errorf("failed to find overlay tunnel with ID %d: %w", id, err)
+	}
+
+	entries, err := parseFdbEntries(config.FdbEntries)
+	if err != nil {
+		return err
+	}
+	newEntries := []model.VxlanFdbEntry{}
+	for _, e := range entries {
+		if e.Dst != entry.Dst || e.MAC != entry.MAC {
+			newEntries = append(newEntries, e)
+		}
+	}
+	if len(newEntries) == len(entries) {
+		return fmt.Errorf("FDB entry %s -> %s not found on tunnel '%s'", entry.MAC, entry.Dst, config.Name)
+	}
+
+	handle, err := netlinkHandle(config.Namespace)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	link, err := handle.LinkByName(config.Name)
+	if err == nil {
+		neigh, err := newFdbNeigh(link, entry)
+		if err != nil {
+			return err
+		}
+		if err := handle.NeighDel(neigh); err != nil {
+			return fmt.Errorf("failed to delete FDB entry %s from tunnel '%s': %w", entry.Dst, config.Name, err)
+		}
+	}
+
+	config.FdbEntries, err = json.MarshalIndent(newEntries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.db.Model(config).Update("fdb_entries", config.FdbEntries).Error
+}
+
+func (s *VxlanService) appendFdbEntry(handle *netlink.Handle, link netlink.Link, entry model.VxlanFdbEntry) error {
+	neigh, err := newFdbNeigh(link, entry)
+	if err != nil {
+		return err
+	}
+	if err := handle.NeighAppend(neigh); err != nil {
+		return fmt.Errorf("failed to add FDB entry %s to tunnel '%s': %w", entry.Dst, link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// newFdbNeigh builds the bridge neighbour equivalent of
+// `bridge fdb append <mac> dev <link> dst <ip>`.
+func newFdbNeigh(link netlink.Link, entry model.VxlanFdbEntry) (*netlink.Neigh, error) {
+	dst := net.ParseIP(entry.Dst)
+	if dst == nil {
+		return nil, fmt.Errorf("invalid FDB destination: %s", entry.Dst)
+	}
+	mac := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+	if entry.MAC != "" {
+		var err error
+		mac, err = net.ParseMAC(entry.MAC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FDB MAC address '%s': %w", entry.MAC, err)
+		}
+	}
+	return &netlink.Neigh{
+		LinkIndex:    link.Attrs().Index,
+		Family:       syscall.AF_BRIDGE,
+		State:        netlink.NUD_PERMANENT | netlink.NUD_NOARP,
+		Flags:        netlink.NTF_SELF,
+		IP:           dst,
+		HardwareAddr: mac,
+	}, nil
+}
+
+func parseFdbEntries(data json.RawMessage) ([]model.VxlanFdbEntry, error) {
+	var entries []model.VxlanFdbEntry
+	if len(data) == 0 || string(data) == "null" {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid FDB entries: %w", err)
+	}
+	return entries, nil
+}
+
+// GetVxlanTunnelByName retrieves a single overlay tunnel configuration by its name.
+func (s *VxlanService) GetVxlanTunnelByName(name string) (*model.VxlanTunnel, error) {
+	var config model.VxlanTunnel
+	err := s.db.Where("name = ?", name).First(&config).Error
+	return &config, err
+}
+
+// GetAllVxlanTunnels retrieves all overlay tunnel configurations from the database.
+func (s *VxlanService) GetAllVxlanTunnels() ([]model.VxlanTunnel, error) {
+	var configs []model.VxlanTunnel
+	err := s.db.Find(&configs).Error
+	return configs, err
+}
+
+// GetVxlanTunnel retrieves a single overlay tunnel configuration by its ID.
+func (s *VxlanService) GetVxlanTunnel(id uint) (*model.VxlanTunnel, error) {
+	var config model.VxlanTunnel
+	err := s.db.First(&config, id).Error
+	return &config, err
+}
@@ -1,6 +1,8 @@
 package sub
 
 import (
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/igor04091968/sing-chisel-tel/logger"
@@ -61,7 +63,18 @@ const ProxyGroups = `- name: Proxy
   tolerance: 50
 `
 
-func (s *ClashService) GetClash(subId string) (*string, []string, error) {
+// Placeholders of Clash templates. List placeholders are replaced inside lists.
+const (
+	proxiesPlaceholder          = "{{proxies}}"
+	proxyNamesPlaceholder       = "{{proxy_names}}"
+	regionGroupsPlaceholder     = "{{region_groups}}"
+	regionGroupNamesPlaceholder = "{{region_group_names}}"
+	providerURLPlaceholder      = "{{provider_url}}"
+)
+
+// GetClash returns the Clash/Mihomo config of a client. host is used to build
+// the provider URL which points back at this subscription.
+func (s *ClashService) GetClash(subId string, platform string, host string) (*string, []string, error) {
 
 	client, inDatas, err := s.getData(subId)
 	if err != nil {
@@ -73,29 +86,70 @@ func (s *ClashService) GetClash(subId string) (*string, []string, error) {
 		return nil, nil, err
 	}
 
-	links := s.LinkService.GetLinks(&client.Links, "external", "")
-	tagNumEnable := 0
-	if len(links) > 1 {
-		tagNumEnable = 1
+	s.addExternalOutbounds(client, outbounds, outTags)
+
+	template, err := s.SubTemplateService.Find("clash", platform, client)
+	if err != nil {
+		return nil, nil, err
 	}
-	for index, link := range links {
-		json, tag, err := util.GetOutbound(link, (index+1)*tagNumEnable)
-		if err == nil && len(tag) > 0 {
-			*outbounds = append(*outbounds, *json)
-			*outTags = append(*outTags, tag)
+	var resultStr string
+	if template != nil {
+		subURI, err := s.SettingService.GetFinalSubURI(host)
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err := s.applyClashTemplate(template.Content, outbounds, subURI+subId+"?format=clash-provider")
+		if err != nil {
+			return nil, nil, err
 		}
+		resultStr = string(result)
+	} else {
+		othersStr, err := s.getClashConfig()
+		if err != nil || len(othersStr) == 0 {
+			othersStr = basicClashConfig
+		}
+
+		result, err := s.ConvertToClashMeta(outbounds)
+		if err != nil {
+			return nil, nil, err
+		}
+		resultStr = othersStr + "\n" + string(result)
 	}
 
-	othersStr, err := s.getClashConfig()
-	if err != nil || len(othersStr) == 0 {
-		othersStr = basicClashConfig
+	updateInterval, _ := s.SettingService.GetSubUpdates()
+	headers := util.GetHeaders(client, updateInterval)
+
+	return &resultStr, headers, nil
+}
+
+func (s *ClashService) getClashConfig() (string, error) {
+	subClashExt, err := s.SettingService.GetSubClashExt()
+	if err != nil {
+		return "", err
 	}
 
-	result, err := s.ConvertToClashMeta(outbounds)
+	return subClashExt, nil
+}
+
+// GetClashProvider returns only the proxies of a client, for proxy-providers.
+func (s *ClashService) GetClashProvider(subId string) (*string, []string, error) {
+	client, inDatas, err := s.getData(subId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outbounds, outTags, err := s.getOutbounds(client.Config, inDatas)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.addExternalOutbounds(client, outbounds, outTags)
+
+	proxies, _ := s.convertProxies(outbounds)
+	result, err := yaml.Marshal(map[string]interface{}{"proxies": proxies})
 	if err != nil {
 		return nil, nil, err
 	}
-	resultStr := othersStr + "\n" + string(result)
+	resultStr := string(result)
 
 	updateInterval, _ := s.SettingService.GetSubUpdates()
 	headers := util.GetHeaders(client, updateInterval)
@@ -103,17 +157,92 @@ func (s *ClashService) GetClash(subId string) (*string, []string, error) {
 	return &resultStr, headers, nil
 }
 
-func (s *ClashService) getClashConfig() (string, error) {
-	subClashExt, err := s.SettingService.GetSubClashExt()
+// applyClashTemplate fills the proxies of the client into a Clash template.
+// Without proxies and proxy-providers, the template gets the proxies appended.
+func (s *ClashService) applyClashTemplate(content string, outbounds *[]map[string]interface{}, providerURL string) ([]byte, error) {
+	var config map[string]interface{}
+	err := yaml.Unmarshal([]byte(content), &config)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return subClashExt, nil
+	proxies, proxyNames := s.convertProxies(outbounds)
+	regionGroups := buildRegionGroups(proxyNames)
+
+	_, hasProxies := config["proxies"]
+	providers, hasProviders := config["proxy-providers"].(map[string]interface{})
+	if hasProviders && !hasProxies {
+		// The proxies only exist in the providers, so the groups select them by name
+		providerNames := make([]string, 0, len(providers))
+		for name := range providers {
+			providerNames = append(providerNames, name)
+		}
+		sort.Strings(providerNames)
+		for _, group := range regionGroups {
+			names := group["proxies"].([]string)
+			for i, name := range names {
+				names[i] = regexp.QuoteMeta(name)
+			}
+			group["filter"] = "^(" + strings.Join(names, "|") + ")$"
+			group["use"] = providerNames
+			delete(group, "proxies")
+		}
+	}
+
+	lists := map[string][]interface{}{
+		proxiesPlaceholder:          proxies,
+		proxyNamesPlaceholder:       make([]interface{}, 0, len(proxyNames)),
+		regionGroupsPlaceholder:     make([]interface{}, 0, len(regionGroups)),
+		regionGroupNamesPlaceholder: make([]interface{}, 0, len(regionGroups)),
+	}
+	for _, name := range proxyNames {
+		lists[proxyNamesPlaceholder] = append(lists[proxyNamesPlaceholder], name)
+	}
+	for _, group := range regionGroups {
+		lists[regionGroupsPlaceholder] = append(lists[regionGroupsPlaceholder], group)
+		lists[regionGroupNamesPlaceholder] = append(lists[regionGroupNamesPlaceholder], group["name"])
+	}
+	scalars := map[string]interface{}{
+		providerURLPlaceholder: providerURL,
+	}
+	config = fillPlaceholders(config, lists, scalars).(map[string]interface{})
+
+	if !hasProxies && !hasProviders {
+		config["proxies"] = proxies
+	}
+	return yaml.Marshal(config)
 }
 
 func (s *ClashService) ConvertToClashMeta(outbounds *[]map[string]interface{}) ([]byte, error) {
-	var proxies []interface{}
+	proxies, proxyTags := s.convertProxies(outbounds)
+
+	var proxyGroups []map[string]interface{}
+	err := yaml.Unmarshal([]byte(ProxyGroups), &proxyGroups)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	regionGroups := buildRegionGroups(proxyTags)
+	selectable := []string{proxyGroups[1]["name"].(string)}
+	for _, group := range regionGroups {
+		selectable = append(selectable, group["name"].(string))
+	}
+
+	proxyGroups[1]["proxies"] = proxyTags
+	proxyGroups[0]["proxies"] = append(selectable, proxyTags...)
+	proxyGroups = append(proxyGroups, regionGroups...)
+
+	output := map[string]interface{}{
+		"proxies":      proxies,
+		"proxy-groups": proxyGroups,
+	}
+
+	return yaml.Marshal(output)
+}
+
+// convertProxies converts the outbounds to Clash proxies and returns them with their names.
+func (s *ClashService) convertProxies(outbounds *[]map[string]interface{}) ([]interface{}, []string) {
+	proxies := make([]interface{}, 0)
 	proxyTags := make([]string, 0)
 	for _, obMap := range *outbounds {
 
@@ -357,19 +486,5 @@ func (s *ClashService) ConvertToClashMeta(outbounds *[]map[string]interface{}) (
 		proxyTags = append(proxyTags, obMap["tag"].(string))
 	}
 
-	var proxyGroups []map[string]interface{}
-	err := yaml.Unmarshal([]byte(ProxyGroups), &proxyGroups)
-	if err != nil {
-		logger.Error(err.Error())
-	}
-
-	proxyGroups[1]["proxies"] = proxyTags
-	proxyGroups[0]["proxies"] = append([]string{proxyGroups[1]["name"].(string)}, proxyTags...)
-
-	output := map[string]interface{}{
-		"proxies":      proxies,
-		"proxy-groups": proxyGroups,
-	}
-
-	return yaml.Marshal(output)
+	return proxies, proxyTags
 }
@@ -0,0 +1,149 @@
+package sub
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/util"
+)
+
+// maxExternalSubSize limits the body read from an external subscription.
+const maxExternalSubSize = 10 << 20
+
+// externalSubIdle is how long an external subscription stays cached after the
+// last request for it, its URL was probably removed from the clients.
+const externalSubIdle = 24 * time.Hour
+
+// externalSub is the cached copy of an external subscription.
+type externalSub struct {
+	mu      sync.Mutex
+	links   []string
+	hash    string
+	checked time.Time // Last fetch attempt, successful or not
+	used    time.Time // Last request
+}
+
+var (
+	externalSubs sync.Map // url -> *externalSub
+	sweepMu      sync.Mutex
+	lastSweep    time.Time
+)
+
+// fetchExternalSub returns the links of an external subscription. It is
+// fetched again once the TTL passed, and if that fails the last good copy is
+// returned.
+func fetchExternalSub(url string) (links []string, hash string) {
+	sweepExternalSubs(time.Now())
+	value, _ := externalSubs.LoadOrStore(url, &externalSub{})
+	sub := value.(*externalSub)
+
+	var settingService service.SettingService
+	ttl, err := settingService.GetSubExtCacheTTL()
+	if err != nil {
+		ttl = 300
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.used = time.Now()
+	if !sub.checked.IsZero() && time.Since(sub.checked) < time.Duration(ttl)*time.Second {
+		return sub.links, sub.hash
+	}
+	sub.checked = time.Now()
+
+	fetched, err := downloadExternalSub(url, &settingService)
+	if err != nil {
+		if sub.links != nil {
+			logger.Warning("sub: fetching ", url, " failed, using the last good copy: ", err)
+		} else {
+			logger.Warning("sub: fetching ", url, " failed: ", err)
+		}
+		return sub.links, sub.hash
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fetched, "\n")))
+	sub.links = fetched
+	sub.hash = hex.EncodeToString(sum[:])
+	return sub.links, sub.hash
+}
+
+// sweepExternalSubs drops the idle external subscriptions, at most once an
+// hour. Subscriptions being fetched are in use and stay.
+func sweepExternalSubs(now time.Time) {
+	sweepMu.Lock()
+	defer sweepMu.Unlock()
+	if now.Sub(lastSweep) < time.Hour {
+		return
+	}
+	lastSweep = now
+	externalSubs.Range(func(key, value any) bool {
+		sub := value.(*externalSub)
+		if !sub.mu.TryLock() {
+			return true
+		}
+		idle := !sub.used.IsZero() && now.Sub(sub.used) > externalSubIdle
+		sub.mu.Unlock()
+		if idle {
+			externalSubs.Delete(key)
+		}
+		return true
+	})
+}
+
+func downloadExternalSub(url string, settingService *service.SettingService) ([]string, error) {
+	timeout, err := settingService.GetSubExtTimeout()
+	if err != nil {
+		timeout = 10
+	}
+	insecure, _ := settingService.GetSubExtInsecure()
+	client := &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxExternalSubSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert if the content is Base64 encoded
+	links := util.StrOrBase64Encoded(string(body))
+	return strings.Split(links, "\n"), nil
+}
+
+// externalSubsVersion refreshes the external subscriptions of a client and
+// returns a fingerprint of their content, for the ETag.
+func externalSubsVersion(linkJson json.RawMessage) string {
+	links := []Link{}
+	if json.Unmarshal(linkJson, &links) != nil {
+		return ""
+	}
+	var hashes []string
+	for _, link := range links {
+		if link.Type == "sub" {
+			_, hash := fetchExternalSub(link.Uri)
+			hashes = append(hashes, hash)
+		}
+	}
+	return strings.Join(hashes, ",")
+}
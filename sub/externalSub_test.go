@@ -0,0 +1,35 @@
+package sub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSweepExternalSubs(t *testing.T) {
+	now := time.Now()
+	externalSubs.Store("idle", &externalSub{used: now.Add(-externalSubIdle - time.Minute)})
+	externalSubs.Store("recent", &externalSub{used: now.Add(-time.Minute)})
+	externalSubs.Store("new", &externalSub{})
+	busy := &externalSub{used: now.Add(-externalSubIdle - time.Minute)}
+	busy.mu.Lock()
+	externalSubs.Store("busy", busy)
+	t.Cleanup(func() {
+		busy.mu.Unlock()
+		externalSubs.Clear()
+		lastSweep = time.Time{}
+	})
+
+	lastSweep = time.Time{}
+	sweepExternalSubs(now)
+	for url, want := range map[string]bool{"idle": false, "recent": true, "new": true, "busy": true} {
+		if _, ok := externalSubs.Load(url); ok != want {
+			t.Errorf("%s: cached %v, want %v", url, ok, want)
+		}
+	}
+
+	externalSubs.Store("idle", &externalSub{used: now.Add(-externalSubIdle - time.Minute)})
+	sweepExternalSubs(now.Add(time.Minute))
+	if _, ok := externalSubs.Load("idle"); !ok {
+		t.Error("swept again within the hour")
+	}
+}
@@ -0,0 +1,288 @@
+package sub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/util"
+)
+
+// errUnsupported marks outbounds a client app can't express, they are skipped.
+var errUnsupported = errors.New("unsupported")
+
+// proxyFormats are the client apps with their own proxy syntax. The render
+// functions get the converted lines of all supported outbounds.
+var proxyFormats = map[string]struct {
+	convert func(p *proxyInfo) (string, error)
+	render  func(f *formatContext, lines []string) (string, error)
+}{
+	"surge":        {surgeProxy, renderSurge},
+	"quanx":        {quanxProxy, renderLines},
+	"loon":         {loonProxy, renderLoon},
+	"shadowrocket": {shadowrocketProxy, renderShadowrocket},
+	"v2rayn":       {v2raynProxy, renderV2rayN},
+}
+
+// IsProxyFormat reports whether FormatService can produce a format.
+func IsProxyFormat(format string) bool {
+	_, ok := proxyFormats[format]
+	return ok
+}
+
+type FormatService struct {
+	JsonService
+}
+
+// formatContext carries what the render functions need besides the lines.
+type formatContext struct {
+	url         string
+	names       []string
+	upload      int64
+	download    int64
+	total       int64
+	expiry      int64
+	updateHours int
+}
+
+// GetFormat converts the outbounds of a client into the format of a client app.
+// host is the host name the client used, for the URL of managed configs.
+func (s *FormatService) GetFormat(subId string, format string, host string) (*string, []string, error) {
+	if !IsProxyFormat(format) {
+		return nil, nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	client, inDatas, err := s.getData(subId)
+	if err != nil {
+		return nil, nil, err
+	}
+	outbounds, outTags, err := s.getOutbounds(client.Config, inDatas)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.addExternalOutbounds(client, outbounds, outTags)
+
+	subURI, err := s.SettingService.GetFinalSubURI(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	updateInterval, _ := s.SettingService.GetSubUpdates()
+	f := &formatContext{
+		url:         subURI + subId + "?format=" + format,
+		upload:      client.Up,
+		download:    client.Down,
+		total:       client.Volume,
+		expiry:      client.Expiry,
+		updateHours: updateInterval,
+	}
+	result, err := f.format(format, *outbounds)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := util.GetHeaders(client, updateInterval)
+	return &result, headers, nil
+}
+
+// format converts the outbounds and renders them, the outbounds the format
+// can't express are skipped.
+func (f *formatContext) format(format string, outbounds []map[string]interface{}) (string, error) {
+	proxyFormat := proxyFormats[format]
+	var lines []string
+	for _, outbound := range outbounds {
+		p := parseProxy(outbound)
+		if p == nil {
+			continue
+		}
+		line, err := proxyFormat.convert(p)
+		if err != nil {
+			logger.Debug("sub: skipping ", p.Name, " for ", format, ": ", p.Type, " ", err)
+			continue
+		}
+		lines = append(lines, line)
+		f.names = append(f.names, p.Name)
+	}
+	return proxyFormat.render(f, lines)
+}
+
+// proxyList joins the names for a proxy group, or returns DIRECT if there are none.
+func (f *formatContext) proxyList(sep string) string {
+	if len(f.names) == 0 {
+		return "DIRECT"
+	}
+	names := make([]string, len(f.names))
+	for i, name := range f.names {
+		names[i] = lineName(name)
+	}
+	return strings.Join(names, sep)
+}
+
+func renderLines(f *formatContext, lines []string) (string, error) {
+	return strings.Join(lines, "\n"), nil
+}
+
+// proxyInfo is the flattened view of a sing-box outbound, shared by the converters.
+type proxyInfo struct {
+	Name     string
+	Type     string
+	Server   string
+	Port     int
+	UUID     string
+	Password string
+	Username string
+	Method   string
+	Flow     string
+	AlterId  int
+
+	TLS         bool
+	SNI         string
+	Insecure    bool
+	ALPN        []string
+	Fingerprint string
+	Reality     bool
+	PublicKey   string
+	ShortId     string
+
+	Transport   string // ws, httpupgrade, grpc or http
+	Path        string
+	Host        string
+	ServiceName string
+
+	UpMbps            int
+	DownMbps          int
+	Obfs              string
+	ObfsPassword      string
+	CongestionControl string
+	UDPOverTCP        bool
+	Multiplex         bool
+}
+
+// parseProxy flattens an outbound, or returns nil for groups and direct.
+func parseProxy(out map[string]interface{}) *proxyInfo {
+	p := &proxyInfo{
+		Name:     mapString(out, "tag"),
+		Type:     mapString(out, "type"),
+		Server:   mapString(out, "server"),
+		Port:     mapInt(out, "server_port"),
+		UUID:     mapString(out, "uuid"),
+		Password: mapString(out, "password"),
+		Username: mapString(out, "username"),
+		Method:   mapString(out, "method"),
+		Flow:     mapString(out, "flow"),
+		AlterId:  mapInt(out, "alter_id"),
+		UpMbps:   mapInt(out, "up_mbps"),
+		DownMbps: mapInt(out, "down_mbps"),
+
+		CongestionControl: mapString(out, "congestion_control"),
+	}
+	switch p.Type {
+	case "", "selector", "urltest", "direct", "block", "dns":
+		return nil
+	case "hysteria":
+		p.Password = mapString(out, "auth_str")
+		p.Obfs = mapString(out, "obfs")
+	case "hysteria2":
+		if obfs, ok := out["obfs"].(map[string]interface{}); ok {
+			p.Obfs = mapString(obfs, "type")
+			p.ObfsPassword = mapString(obfs, "password")
+		}
+	}
+	p.UDPOverTCP, _ = out["udp_over_tcp"].(bool)
+	if mux, ok := out["multiplex"].(map[string]interface{}); ok {
+		p.Multiplex, _ = mux["enabled"].(bool)
+	}
+
+	if tls, ok := out["tls"].(map[string]interface{}); ok {
+		p.TLS, _ = tls["enabled"].(bool)
+		p.SNI = mapString(tls, "server_name")
+		p.Insecure, _ = tls["insecure"].(bool)
+		p.ALPN = mapStrings(tls, "alpn")
+		if utls, ok := tls["utls"].(map[string]interface{}); ok {
+			if enabled, _ := utls["enabled"].(bool); enabled {
+				p.Fingerprint = mapString(utls, "fingerprint")
+			}
+		}
+		if reality, ok := tls["reality"].(map[string]interface{}); ok {
+			p.Reality, _ = reality["enabled"].(bool)
+			p.PublicKey = mapString(reality, "public_key")
+			p.ShortId = mapString(reality, "short_id")
+		}
+	}
+
+	if transport, ok := out["transport"].(map[string]interface{}); ok {
+		p.Transport = mapString(transport, "type")
+		p.Path = mapString(transport, "path")
+		p.ServiceName = mapString(transport, "service_name")
+		if hosts := mapStrings(transport, "host"); len(hosts) > 0 {
+			p.Host = hosts[0]
+		}
+		if headers, ok := transport["headers"].(map[string]interface{}); ok {
+			if hosts := mapStrings(headers, "Host"); len(hosts) > 0 {
+				p.Host = hosts[0]
+			}
+		}
+	}
+	return p
+}
+
+// host returns the HTTP host of the transport, or the TLS server name.
+func (p *proxyInfo) host() string {
+	if p.Host != "" {
+		return p.Host
+	}
+	return p.SNI
+}
+
+func mapString(m map[string]interface{}, key string) string {
+	str, _ := m[key].(string)
+	return str
+}
+
+func mapInt(m map[string]interface{}, key string) int {
+	switch v := m[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// mapStrings reads a string or a list of strings.
+func mapStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// lineName removes the separators of the line based formats from a name.
+func lineName(name string) string {
+	return strings.Join(strings.Fields(strings.NewReplacer(",", " ", "=", " ").Replace(name)), " ")
+}
+
+// lineParams collects the key=value parameters of a proxy line.
+type lineParams []string
+
+func (l *lineParams) add(key string, value string) {
+	if value != "" {
+		*l = append(*l, key+"="+value)
+	}
+}
+
+func (l *lineParams) addBool(key string, value bool) {
+	if value {
+		*l = append(*l, key+"=true")
+	}
+}
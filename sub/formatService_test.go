@@ -0,0 +1,126 @@
+package sub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/igor04091968/sing-chisel-tel/logger"
+
+	"github.com/op/go-logging"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func loadOutbounds(t *testing.T) []map[string]interface{} {
+	data, err := os.ReadFile(filepath.Join("testdata", "outbounds.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outbounds []map[string]interface{}
+	if err = json.Unmarshal(data, &outbounds); err != nil {
+		t.Fatal(err)
+	}
+	return outbounds
+}
+
+func TestProxyFormats(t *testing.T) {
+	logger.InitLogger(logging.ERROR)
+	outbounds := loadOutbounds(t)
+
+	tests := []struct {
+		format  string
+		skipped []string
+		base64  bool
+	}{
+		{
+			format:  "surge",
+			skipped: []string{"vless ws", "vless reality", "vless grpc", "vless h2", "hysteria", "hysteria2 obfs", "anytls"},
+		},
+		{
+			format:  "quanx",
+			skipped: []string{"vless reality", "vless grpc", "vless h2", "tuic", "hysteria", "hysteria2", "hysteria2 obfs", "anytls"},
+		},
+		{
+			format:  "loon",
+			skipped: []string{"vless grpc", "vless h2", "tuic", "hysteria", "anytls"},
+		},
+		{
+			format:  "shadowrocket",
+			skipped: []string{"vless h2", "socks tls"},
+			base64:  true,
+		},
+		{
+			format:  "v2rayn",
+			skipped: []string{"tuic", "hysteria", "hysteria2", "hysteria2 obfs", "anytls"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			for _, outbound := range outbounds {
+				p := parseProxy(outbound)
+				if p == nil {
+					continue
+				}
+				_, err := proxyFormats[tt.format].convert(p)
+				if skip := slices.Contains(tt.skipped, p.Name); skip != errors.Is(err, errUnsupported) {
+					t.Errorf("%s: skipped %v, error %v", p.Name, skip, err)
+				}
+			}
+
+			f := &formatContext{
+				url:         "https://sub.example.com/sub/test?format=" + tt.format,
+				upload:      1 << 30,
+				download:    3 << 30,
+				total:       100 << 30,
+				updateHours: 12,
+			}
+			result, err := f.format(tt.format, outbounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.base64 {
+				data, err := base64.StdEncoding.DecodeString(result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result = string(data)
+			}
+
+			golden := filepath.Join("testdata", tt.format+".golden")
+			if *update {
+				if err = os.WriteFile(golden, []byte(result), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != string(want) {
+				t.Errorf("result differs from %s:\n%s", golden, result)
+			}
+		})
+	}
+}
+
+func TestParseProxySkipsGroups(t *testing.T) {
+	for _, outbound := range loadOutbounds(t) {
+		p := parseProxy(outbound)
+		switch outbound["type"] {
+		case "selector", "direct":
+			if p != nil {
+				t.Errorf("%s: group or direct outbound was converted", p.Name)
+			}
+		default:
+			if p == nil {
+				t.Errorf("%v: outbound was skipped", outbound["tag"])
+			}
+		}
+	}
+}
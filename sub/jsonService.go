@@ -43,12 +43,20 @@ const defaultJson = `
 }
 `
 
+// Placeholders of sing-box templates, replaced inside arrays
+const (
+	outboundsPlaceholder    = "{{outbounds}}"
+	outboundTagsPlaceholder = "{{outbound_tags}}"
+)
+
 type JsonService struct {
 	service.SettingService
+	service.SubTemplateService
+	service.ClientService
 	LinkService
 }
 
-func (j *JsonService) GetJson(subId string, format string) (*string, []string, error) {
+func (j *JsonService) GetJson(subId string, format string, platform string) (*string, []string, error) {
 	var jsonConfig map[string]interface{}
 
 	client, inDatas, err := j.getData(subId)
@@ -61,30 +69,30 @@ func (j *JsonService) GetJson(subId string, format string) (*string, []string, e
 		return nil, nil, err
 	}
 
-	links := j.LinkService.GetLinks(&client.Links, "external", "")
-	tagNumEnable := 0
-	if len(links) > 1 {
-		tagNumEnable = 1
-	}
-	for index, link := range links {
-		json, tag, err := util.GetOutbound(link, (index+1)*tagNumEnable)
-		if err == nil && len(tag) > 0 {
-			*outbounds = append(*outbounds, *json)
-			*outTags = append(*outTags, tag)
-		}
-	}
-
-	j.addDefaultOutbounds(outbounds, outTags)
+	j.addExternalOutbounds(client, outbounds, outTags)
 
-	err = json.Unmarshal([]byte(defaultJson), &jsonConfig)
+	template, err := j.SubTemplateService.Find("singbox", platform, client)
 	if err != nil {
 		return nil, nil, err
 	}
+	if template != nil {
+		jsonConfig, err = j.applyTemplate(template.Content, outbounds, outTags)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		j.addDefaultOutbounds(outbounds, outTags)
+
+		err = json.Unmarshal([]byte(defaultJson), &jsonConfig)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	jsonConfig["outbounds"] = outbounds
+		jsonConfig["outbounds"] = outbounds
 
-	// Add other objects from settings
-	j.addOthers(&jsonConfig)
+		// Add other objects from settings
+		j.addOthers(&jsonConfig)
+	}
 
 	result, _ := json.MarshalIndent(jsonConfig, "", "  ")
 	resultStr := string(result)
@@ -95,10 +103,24 @@ func (j *JsonService) GetJson(subId string, format string) (*string, []string, e
 	return &resultStr, headers, nil
 }
 
+// addExternalOutbounds appends the outbounds of the client's external links.
+func (j *JsonService) addExternalOutbounds(client *model.Client, outbounds *[]map[string]interface{}, outTags *[]string) {
+	links := j.LinkService.GetLinks(&client.Links, "external", "")
+	tagNumEnable := 0
+	if len(links) > 1 {
+		tagNumEnable = 1
+	}
+	for index, link := range links {
+		json, tag, err := util.GetOutbound(link, (index+1)*tagNumEnable)
+		if err == nil && len(tag) > 0 {
+			*outbounds = append(*outbounds, *json)
+			*outTags = append(*outTags, tag)
+		}
+	}
+}
+
 func (j *JsonService) getData(subId string) (*model.Client, []*model.Inbound, error) {
-	db := database.GetDB()
-	client := &model.Client{}
-	err := db.Model(model.Client{}).Where("enable = true and name = ?", subId).First(client).Error
+	client, err := j.ClientService.GetBySubToken(subId)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -108,7 +130,7 @@ func (j *JsonService) getData(subId string) (*model.Client, []*model.Inbound, er
 		return nil, nil, err
 	}
 	var inbounds []*model.Inbound
-	err = db.Model(model.Inbound{}).Preload("Tls").Where("id in ?", clientInbounds).Find(&inbounds).Error
+	err = database.GetDB().Model(model.Inbound{}).Preload("Tls").Where("id in ?", clientInbounds).Find(&inbounds).Error
 	if err != nil {
 		return nil, nil, err
 	}
@@ -308,6 +330,64 @@ func (j *JsonService) addOthers(jsonConfig *map[string]interface{}) error {
 	return nil
 }
 
+// applyTemplate fills the outbounds of the client into a sing-box template.
+// Without an outbounds array, the template gets the default selector outbounds.
+func (j *JsonService) applyTemplate(content string, outbounds *[]map[string]interface{}, outTags *[]string) (map[string]interface{}, error) {
+	var jsonConfig map[string]interface{}
+	err := json.Unmarshal([]byte(content), &jsonConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := jsonConfig["outbounds"]; !ok {
+		j.addDefaultOutbounds(outbounds, outTags)
+		jsonConfig["outbounds"] = outbounds
+		return jsonConfig, nil
+	}
+
+	placeholders := map[string][]interface{}{
+		outboundsPlaceholder:    make([]interface{}, 0, len(*outbounds)),
+		outboundTagsPlaceholder: make([]interface{}, 0, len(*outTags)),
+	}
+	for _, outbound := range *outbounds {
+		placeholders[outboundsPlaceholder] = append(placeholders[outboundsPlaceholder], outbound)
+	}
+	for _, tag := range *outTags {
+		placeholders[outboundTagsPlaceholder] = append(placeholders[outboundTagsPlaceholder], tag)
+	}
+	return fillPlaceholders(jsonConfig, placeholders, nil).(map[string]interface{}), nil
+}
+
+// fillPlaceholders replaces placeholder strings in arrays with the elements of
+// their list, and other placeholder strings with their scalar value.
+func fillPlaceholders(value interface{}, lists map[string][]interface{}, scalars map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fillPlaceholders(item, lists, scalars)
+		}
+		return v
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				if values, ok := lists[str]; ok {
+					result = append(result, values...)
+					continue
+				}
+			}
+			result = append(result, fillPlaceholders(item, lists, scalars))
+		}
+		return result
+	case string:
+		if scalar, ok := scalars[v]; ok {
+			return scalar
+		}
+		return v
+	default:
+		return value
+	}
+}
+
 func (j *JsonService) pushMixed(outbounds *[]map[string]interface{}, outTags *[]string, out map[string]interface{}) {
 	socksOut := make(map[string]interface{}, 1)
 	httpOut := make(map[string]interface{}, 1)
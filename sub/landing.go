@@ -0,0 +1,161 @@
+package sub
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+//go:embed landing.html
+var defaultLandingTemplate string
+
+type landingLink struct {
+	Remark string
+	Uri    string
+	QR     template.URL
+}
+
+type landingButton struct {
+	Name string
+	URL  template.URL
+}
+
+// landingData is what the landing page template gets.
+type landingData struct {
+	Name        string
+	Used        string
+	Remaining   string
+	Expiry      string
+	UsedPercent int64
+	SubURL      string
+	SubQR       template.URL
+	Apps        []landingButton
+	Formats     []landingButton
+	Links       []landingLink
+}
+
+// wantsLanding reports whether the request comes from a browser, client apps
+// don't ask for HTML.
+func wantsLanding(c *gin.Context) bool {
+	if _, isFormat := c.GetQuery("format"); isFormat {
+		return false
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+// renderLanding writes the landing page of a client, from the template in
+// the settings or the embedded one.
+func (s *SubHandler) renderLanding(c *gin.Context, client *model.Client, subId string) error {
+	content, err := s.SettingService.GetSubLandingTemplate()
+	if err != nil {
+		return err
+	}
+	if content == "" {
+		content = defaultLandingTemplate
+	}
+	tmpl, err := template.New("landing").Parse(content)
+	if err != nil {
+		return err
+	}
+	subURI, err := s.SettingService.GetFinalSubURI(requestHost(c))
+	if err != nil {
+		return err
+	}
+	data := s.landingData(client, subURI+subId)
+
+	var page bytes.Buffer
+	if err = tmpl.Execute(&page, data); err != nil {
+		return err
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(200, "text/html; charset=utf-8", page.Bytes())
+	return nil
+}
+
+func (s *SubHandler) landingData(client *model.Client, subURL string) *landingData {
+	var subService SubService
+	data := &landingData{
+		Name:      client.Name,
+		Used:      subService.formatTraffic(client.Up + client.Down),
+		Remaining: "♾",
+		Expiry:    "♾",
+		SubURL:    subURL,
+		SubQR:     qrDataURI(subURL),
+	}
+	if client.Volume > 0 {
+		remaining := max(client.Volume-(client.Up+client.Down), 0)
+		data.Remaining = subService.formatTraffic(remaining)
+		data.UsedPercent = min((client.Up+client.Down)*100/client.Volume, 100)
+	}
+	if client.OnHold {
+		data.Expiry = fmt.Sprintf("%d days from the first use", client.Duration)
+	} else if client.Expiry > 0 {
+		data.Expiry = time.Unix(client.Expiry, 0).Format("2006-01-02")
+	}
+
+	name := url.QueryEscape(client.Name)
+	jsonURL := url.QueryEscape(subURL + "?format=json")
+	clashURL := url.QueryEscape(subURL + "?format=clash")
+	data.Apps = []landingButton{
+		{"sing-box", template.URL("sing-box://import-remote-profile?url=" + jsonURL + "#" + name)},
+		{"Clash", template.URL("clash://install-config?url=" + clashURL + "&name=" + name)},
+		{"Hiddify", template.URL("hiddify://import/" + subURL + "#" + name)},
+		{"v2rayNG", template.URL("v2rayng://install-config?url=" + url.QueryEscape(subURL) + "#" + name)},
+		{"Shadowrocket", template.URL("shadowrocket://add/sub://" + base64.URLEncoding.EncodeToString([]byte(subURL+"?format=shadowrocket")) + "?remark=" + name)},
+	}
+	data.Formats = []landingButton{
+		{"Links", template.URL(subURL)},
+		{"sing-box", template.URL(subURL + "?format=json")},
+		{"Clash", template.URL(subURL + "?format=clash")},
+		{"Surge", template.URL(subURL + "?format=surge")},
+		{"Quantumult X", template.URL(subURL + "?format=quanx")},
+		{"Loon", template.URL(subURL + "?format=loon")},
+		{"Shadowrocket", template.URL(subURL + "?format=shadowrocket")},
+		{"v2rayN", template.URL(subURL + "?format=v2rayn")},
+	}
+
+	for _, uri := range s.SubService.LinkService.GetLinks(&client.Links, "all", "") {
+		if uri == "" {
+			continue
+		}
+		data.Links = append(data.Links, landingLink{
+			Remark: linkRemark(uri),
+			Uri:    uri,
+			QR:     qrDataURI(uri),
+		})
+	}
+	return data
+}
+
+// linkRemark returns the name of a share link from its fragment, or its protocol.
+func linkRemark(uri string) string {
+	if i := strings.LastIndex(uri, "#"); i >= 0 {
+		if remark, err := url.PathUnescape(uri[i+1:]); err == nil && remark != "" {
+			return remark
+		}
+	}
+	if i := strings.Index(uri, "://"); i > 0 {
+		return uri[:i]
+	}
+	return uri
+}
+
+func qrDataURI(content string) template.URL {
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		logger.Debug("sub: unable to create QR code: ", err)
+		return ""
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+}
@@ -1,10 +1,7 @@
 package sub
 
 import (
-	"crypto/tls"
 	"encoding/json"
-	"io"
-	"net/http"
 	"strings"
 
 	"github.com/igor04091968/sing-chisel-tel/logger"
@@ -76,29 +73,6 @@ func (s *LinkService) addClientInfo(uri string, clientInfo string) string {
 }
 
 func (s *LinkService) getExternalSub(url string) []string {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-
-	client := &http.Client{Transport: tr}
-
-	// Make the HTTP request
-	response, err := client.Get(url)
-	if err != nil {
-		logger.Warning("sub: Error making HTTP request:", err)
-		return nil
-	}
-	defer response.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		logger.Warning("sub: Error reading response body:", err)
-		return nil
-	}
-
-	// Convert if the content is Base64 encoded
-	links := util.StrOrBase64Encoded(string(body))
-	return strings.Split(links, "\n")
-
+	links, _ := fetchExternalSub(url)
+	return links
 }
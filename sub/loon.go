@@ -0,0 +1,110 @@
+package sub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// loonProxy converts to a Loon [Proxy] line. Loon has no TUIC, Hysteria v1,
+// AnyTLS, gRPC or HTTP/2 transport.
+func loonProxy(p *proxyInfo) (string, error) {
+	// positional fields after the port, then the key=value parameters
+	var fields []string
+	var params lineParams
+	var proto string
+	switch p.Type {
+	case "shadowsocks":
+		proto = "Shadowsocks"
+		fields = []string{p.Method, strconv.Quote(p.Password)}
+		params.add("udp", "true")
+	case "vmess":
+		proto = "vmess"
+		fields = []string{"auto", strconv.Quote(p.UUID)}
+		params.add("alterId", strconv.Itoa(p.AlterId))
+	case "vless":
+		proto = "VLESS"
+		fields = []string{strconv.Quote(p.UUID)}
+		params.add("flow", p.Flow)
+	case "trojan":
+		proto = "trojan"
+		fields = []string{strconv.Quote(p.Password)}
+	case "hysteria2":
+		if p.Obfs != "" && p.Obfs != "salamander" {
+			return "", errUnsupported
+		}
+		proto = "Hysteria2"
+		fields = []string{strconv.Quote(p.Password)}
+		params.add("salamander-password", p.ObfsPassword)
+		if p.DownMbps > 0 {
+			params.add("download-bandwidth", strconv.Itoa(p.DownMbps))
+		}
+	case "http", "socks":
+		proto = map[string]string{"http": "http", "socks": "socks5"}[p.Type]
+		if p.TLS && p.Type == "http" {
+			proto = "https"
+		}
+		if p.Username != "" {
+			fields = []string{p.Username, strconv.Quote(p.Password)}
+		}
+	default:
+		return "", errUnsupported
+	}
+
+	switch p.Transport {
+	case "":
+		if p.Type == "vmess" || p.Type == "vless" {
+			params.add("transport", "tcp")
+		}
+	case "ws":
+		if p.Type == "http" || p.Type == "socks" || p.Type == "hysteria2" {
+			return "", errUnsupported
+		}
+		params.add("transport", "ws")
+		params.add("path", p.Path)
+		params.add("host", p.Host)
+	default:
+		return "", errUnsupported
+	}
+
+	if p.TLS {
+		switch p.Type {
+		case "vmess", "vless", "socks":
+			params.add("over-tls", "true")
+		}
+		params.add("sni", p.SNI)
+		params.addBool("skip-cert-verify", p.Insecure)
+		if p.Reality {
+			if p.Type != "vless" {
+				return "", errUnsupported
+			}
+			params.add("public-key", p.PublicKey)
+			params.add("short-id", p.ShortId)
+		}
+	}
+
+	parts := append([]string{proto, p.Server, strconv.Itoa(p.Port)}, fields...)
+	parts = append(parts, params...)
+	return fmt.Sprintf("%s = %s", lineName(p.Name), strings.Join(parts, ",")), nil
+}
+
+// renderLoon writes a minimal profile with the proxies and a selector.
+func renderLoon(f *formatContext, lines []string) (string, error) {
+	proxies := f.proxyList(",")
+
+	var b strings.Builder
+	b.WriteString("[General]\n")
+	b.WriteString("skip-proxy = 127.0.0.1,192.168.0.0/16,10.0.0.0/8,172.16.0.0/12,localhost,*.local\n")
+	b.WriteString("dns-server = system,1.1.1.1,8.8.8.8\n\n")
+	b.WriteString("[Proxy]\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n[Proxy Group]\n")
+	fmt.Fprintf(&b, "Proxy = select,Auto,%s\n", proxies)
+	fmt.Fprintf(&b, "Auto = url-test,%s,url=http://www.gstatic.com/generate_204,interval=300,tolerance=50\n\n", proxies)
+	b.WriteString("[Rule]\n")
+	b.WriteString("GEOIP,LAN,DIRECT\n")
+	b.WriteString("FINAL,Proxy\n")
+	return b.String(), nil
+}
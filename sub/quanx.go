@@ -0,0 +1,73 @@
+package sub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// quanxProxy converts to a Quantumult X server_local line. Quantumult X has no
+// TUIC, Hysteria, AnyTLS, REALITY, XTLS flow or gRPC.
+func quanxProxy(p *proxyInfo) (string, error) {
+	if p.Reality || p.Flow != "" {
+		return "", errUnsupported
+	}
+
+	var proto string
+	var params lineParams
+	switch p.Type {
+	case "shadowsocks":
+		proto = "shadowsocks"
+		params.add("method", p.Method)
+		params.add("password", p.Password)
+		params.add("udp-relay", "true")
+	case "vmess", "vless":
+		proto = p.Type
+		params.add("method", map[string]string{"vmess": "chacha20-ietf-poly1305", "vless": "none"}[p.Type])
+		params.add("password", p.UUID)
+		params.addBool("aead", p.Type == "vmess" && p.AlterId == 0)
+	case "trojan":
+		proto = "trojan"
+		params.add("password", p.Password)
+	case "http", "socks":
+		proto = map[string]string{"http": "http", "socks": "socks5"}[p.Type]
+		params.add("username", p.Username)
+		params.add("password", p.Password)
+	default:
+		return "", errUnsupported
+	}
+
+	switch p.Transport {
+	case "":
+		if !p.TLS {
+			break
+		}
+		// trojan and the plain proxies have a TLS switch, the rest an obfs mode
+		if p.Type == "trojan" || p.Type == "http" || p.Type == "socks" {
+			params.add("over-tls", "true")
+		} else {
+			params.add("obfs", "over-tls")
+			params.add("obfs-host", p.SNI)
+		}
+	case "ws":
+		if p.Type == "http" || p.Type == "socks" {
+			return "", errUnsupported
+		}
+		if p.TLS {
+			params.add("obfs", "wss")
+		} else {
+			params.add("obfs", "ws")
+		}
+		params.add("obfs-host", p.host())
+		params.add("obfs-uri", p.Path)
+	default:
+		return "", errUnsupported
+	}
+	if p.TLS {
+		params.add("tls-host", p.SNI)
+		params.add("tls-verification", strconv.FormatBool(!p.Insecure))
+	}
+	params.add("tag", lineName(p.Name))
+
+	return fmt.Sprintf("%s=%s:%d, %s", proto, p.Server, p.Port, strings.Join(params, ", ")), nil
+}
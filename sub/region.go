@@ -0,0 +1,124 @@
+package sub
+
+import (
+	"strings"
+	"unicode"
+)
+
+// regions maps country codes to names which appear in address remarks.
+// Names with spaces match as substrings, others as whole words.
+var regions = []struct {
+	Code  string
+	Names []string
+}{
+	{"HK", []string{"hong kong", "hongkong"}},
+	{"TW", []string{"taiwan", "taipei"}},
+	{"JP", []string{"japan", "tokyo", "osaka"}},
+	{"SG", []string{"singapore"}},
+	{"KR", []string{"korea", "seoul"}},
+	{"US", []string{"united states", "usa", "america", "los angeles", "new york", "seattle"}},
+	{"CA", []string{"canada", "toronto"}},
+	{"GB", []string{"united kingdom", "uk", "britain", "london"}},
+	{"DE", []string{"germany", "frankfurt", "berlin"}},
+	{"NL", []string{"netherlands", "amsterdam"}},
+	{"FR", []string{"france", "paris"}},
+	{"FI", []string{"finland", "helsinki"}},
+	{"SE", []string{"sweden", "stockholm"}},
+	{"CH", []string{"switzerland", "zurich"}},
+	{"PL", []string{"poland", "warsaw"}},
+	{"RU", []string{"russia", "moscow"}},
+	{"TR", []string{"turkey", "istanbul"}},
+	{"IR", []string{"iran", "tehran"}},
+	{"AE", []string{"uae", "emirates", "dubai"}},
+	{"IN", []string{"india", "mumbai"}},
+	{"AU", []string{"australia", "sydney"}},
+	{"KZ", []string{"kazakhstan", "almaty"}},
+}
+
+// detectRegion returns the country code of a proxy from the flag emoji or
+// the country in its name, or an empty string.
+func detectRegion(name string) string {
+	if code := flagCode(name); code != "" {
+		return code
+	}
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	lowerName := strings.ToLower(name)
+	for _, region := range regions {
+		for _, word := range words {
+			if word == region.Code {
+				return region.Code
+			}
+		}
+		for _, regionName := range region.Names {
+			if strings.Contains(regionName, " ") {
+				if strings.Contains(lowerName, regionName) {
+					return region.Code
+				}
+				continue
+			}
+			for _, word := range words {
+				if strings.ToLower(word) == regionName {
+					return region.Code
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// flagCode decodes the first flag emoji, a pair of regional indicator symbols.
+func flagCode(name string) string {
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		if isRegionalIndicator(runes[i]) && isRegionalIndicator(runes[i+1]) {
+			return string([]rune{'A' + runes[i] - 0x1F1E6, 'A' + runes[i+1] - 0x1F1E6})
+		}
+	}
+	return ""
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// regionFlag encodes a country code as flag emoji.
+func regionFlag(code string) string {
+	var flag []rune
+	for _, c := range code {
+		flag = append(flag, 0x1F1E6+c-'A')
+	}
+	return string(flag)
+}
+
+// buildRegionGroups returns a url-test group per region found in the proxy
+// names, in the order the regions first appear.
+func buildRegionGroups(proxyNames []string) []map[string]interface{} {
+	var order []string
+	members := make(map[string][]string)
+	for _, name := range proxyNames {
+		code := detectRegion(name)
+		if code == "" {
+			continue
+		}
+		if _, ok := members[code]; !ok {
+			order = append(order, code)
+		}
+		members[code] = append(members[code], name)
+	}
+
+	groups := make([]map[string]interface{}, 0, len(order))
+	for _, code := range order {
+		groups = append(groups, map[string]interface{}{
+			"name":      regionFlag(code) + " " + code,
+			"type":      "url-test",
+			"proxies":   members[code],
+			"url":       "http://www.gstatic.com/generate_204",
+			"interval":  300,
+			"tolerance": 50,
+		})
+	}
+	return groups
+}
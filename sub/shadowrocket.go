@@ -0,0 +1,187 @@
+package sub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shadowrocketProxy converts to a share link. Shadowrocket reads links of all
+// protocols, only SOCKS over TLS and the HTTP/2 transport are missing.
+func shadowrocketProxy(p *proxyInfo) (string, error) {
+	if p.Transport == "http" {
+		return "", errUnsupported
+	}
+	address := net.JoinHostPort(p.Server, strconv.Itoa(p.Port))
+	name := "#" + url.PathEscape(p.Name)
+	query := url.Values{}
+
+	switch p.Type {
+	case "shadowsocks":
+		userInfo := base64.RawURLEncoding.EncodeToString([]byte(p.Method + ":" + p.Password))
+		if p.UDPOverTCP {
+			query.Set("uot", "1")
+		}
+		return "ss://" + userInfo + "@" + address + encodeQuery(query) + name, nil
+	case "vmess":
+		return vmessLink(p), nil
+	case "vless", "trojan":
+		credential := p.UUID
+		if p.Type == "trojan" {
+			credential = p.Password
+		}
+		if p.Type == "vless" {
+			query.Set("encryption", "none")
+			setQuery(query, "flow", p.Flow)
+		}
+		linkTransport(p, query)
+		linkTLS(p, query)
+		return p.Type + "://" + url.PathEscape(credential) + "@" + address + encodeQuery(query) + name, nil
+	case "hysteria":
+		setQuery(query, "auth", p.Password)
+		setQuery(query, "upmbps", strconv.Itoa(p.UpMbps))
+		setQuery(query, "downmbps", strconv.Itoa(p.DownMbps))
+		setQuery(query, "obfsParam", p.Obfs)
+		linkTLS(p, query)
+		return "hysteria://" + address + encodeQuery(query) + name, nil
+	case "hysteria2":
+		setQuery(query, "obfs", p.Obfs)
+		setQuery(query, "obfs-password", p.ObfsPassword)
+		linkTLS(p, query)
+		return "hysteria2://" + url.PathEscape(p.Password) + "@" + address + encodeQuery(query) + name, nil
+	case "tuic":
+		setQuery(query, "congestion_control", p.CongestionControl)
+		linkTLS(p, query)
+		return "tuic://" + p.UUID + ":" + url.PathEscape(p.Password) + "@" + address + encodeQuery(query) + name, nil
+	case "anytls":
+		linkTLS(p, query)
+		return "anytls://" + url.PathEscape(p.Password) + "@" + address + encodeQuery(query) + name, nil
+	case "socks", "http":
+		scheme := p.Type
+		if p.TLS {
+			if p.Type == "socks" {
+				return "", errUnsupported
+			}
+			scheme = "https"
+		}
+		userInfo := ""
+		if p.Username != "" {
+			userInfo = base64.RawURLEncoding.EncodeToString([]byte(p.Username+":"+p.Password)) + "@"
+		}
+		return scheme + "://" + userInfo + address + name, nil
+	}
+	return "", errUnsupported
+}
+
+// vmessLink encodes a VMess link in the v2rayN JSON form.
+func vmessLink(p *proxyInfo) string {
+	network := p.Transport
+	if network == "" {
+		network = "tcp"
+	}
+	path := p.Path
+	if network == "grpc" {
+		path = p.ServiceName
+	}
+	tls := ""
+	if p.TLS {
+		tls = "tls"
+	}
+	obj := map[string]interface{}{
+		"v":    "2",
+		"ps":   p.Name,
+		"add":  p.Server,
+		"port": strconv.Itoa(p.Port),
+		"id":   p.UUID,
+		"aid":  strconv.Itoa(p.AlterId),
+		"scy":  "auto",
+		"net":  network,
+		"type": "none",
+		"host": p.Host,
+		"path": path,
+		"tls":  tls,
+		"sni":  p.SNI,
+		"alpn": strings.Join(p.ALPN, ","),
+		"fp":   p.Fingerprint,
+	}
+	data, _ := json.Marshal(obj)
+	return "vmess://" + base64.StdEncoding.EncodeToString(data)
+}
+
+// linkTransport sets the transport parameters of VLESS and Trojan links.
+func linkTransport(p *proxyInfo, query url.Values) {
+	switch p.Transport {
+	case "":
+		query.Set("type", "tcp")
+	case "grpc":
+		query.Set("type", "grpc")
+		setQuery(query, "serviceName", p.ServiceName)
+	default:
+		query.Set("type", p.Transport)
+		setQuery(query, "path", p.Path)
+		setQuery(query, "host", p.Host)
+	}
+}
+
+// linkTLS sets the TLS parameters of a share link.
+func linkTLS(p *proxyInfo, query url.Values) {
+	if !p.TLS {
+		if p.Type == "vless" || p.Type == "trojan" {
+			query.Set("security", "none")
+		}
+		return
+	}
+	switch {
+	case p.Reality:
+		query.Set("security", "reality")
+		setQuery(query, "pbk", p.PublicKey)
+		setQuery(query, "sid", p.ShortId)
+	case p.Type == "vless" || p.Type == "trojan":
+		query.Set("security", "tls")
+	}
+	if p.Type == "hysteria" {
+		setQuery(query, "peer", p.SNI)
+	} else {
+		setQuery(query, "sni", p.SNI)
+	}
+	setQuery(query, "alpn", strings.Join(p.ALPN, ","))
+	setQuery(query, "fp", p.Fingerprint)
+	if p.Insecure {
+		query.Set("insecure", "1")
+		query.Set("allowInsecure", "1")
+	}
+}
+
+func setQuery(query url.Values, key string, value string) {
+	if value != "" && value != "0" {
+		query.Set(key, value)
+	}
+}
+
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// renderShadowrocket encodes the links with a status line, which Shadowrocket
+// shows above the servers.
+func renderShadowrocket(f *formatContext, lines []string) (string, error) {
+	var subService SubService
+	total := "♾"
+	if f.total > 0 {
+		total = subService.formatTraffic(f.total)
+	}
+	status := fmt.Sprintf("STATUS=↑:%s,↓:%s,TOT:%s", subService.formatTraffic(f.upload), subService.formatTraffic(f.download), total)
+	if f.expiry > 0 {
+		status += "💡Expires:" + time.Unix(f.expiry, 0).Format("2006-01-02")
+	}
+	result := strings.Join(append([]string{status}, lines...), "\n")
+	return base64.StdEncoding.EncodeToString([]byte(result)), nil
+}
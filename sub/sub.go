@@ -44,6 +44,9 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 
 	engine := gin.Default()
+	// Forwarded headers are trusted only by middleware.ClientIP, which the
+	// allowlists of the clients use too
+	engine.SetTrustedProxies(nil)
 
 	subPath, err := s.SettingService.GetSubPath()
 	if err != nil {
@@ -59,6 +62,20 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		engine.Use(middleware.DomainValidator(subDomain))
 	}
 
+	trustedProxies, err := s.SettingService.GetTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+	middleware.SetTrustedProxies(trustedProxies)
+
+	subAllow, subDeny, err := s.SettingService.GetIPFilter("sub")
+	if err != nil {
+		return nil, err
+	}
+	if len(subAllow) > 0 || len(subDeny) > 0 {
+		engine.Use(middleware.IPFilter(subAllow, subDeny))
+	}
+
 	g := engine.Group(subPath)
 	NewSubHandler(g)
 
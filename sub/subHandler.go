@@ -1,8 +1,19 @@
 package sub
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
 	"github.com/igor04091968/sing-chisel-tel/logger"
+	"github.com/igor04091968/sing-chisel-tel/middleware"
 	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/util"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,6 +23,8 @@ type SubHandler struct {
 	SubService
 	JsonService
 	ClashService
+	FormatService
+	service.SubAccessService
 }
 
 func NewSubHandler(g *gin.RouterGroup) {
@@ -28,13 +41,54 @@ func (s *SubHandler) subs(c *gin.Context) {
 	var result *string
 	var err error
 	subId := c.Param("subid")
+	client, err := s.SubService.GetBySubToken(subId)
+	if err != nil {
+		c.String(404, "")
+		return
+	}
+	clientIP := middleware.ClientIP(c)
+	country := middleware.ProxyHeader(c, "CF-IPCountry")
+	if !s.SubService.SubAccessAllowed(client, clientIP, c.GetHeader("User-Agent")) {
+		logger.Warning("sub: access of ", client.Name, " from ", clientIP, " denied by the allowlist")
+		c.String(403, "")
+		return
+	}
+	if landing, _ := s.SettingService.GetSubLanding(); landing && wantsLanding(c) {
+		go s.SubAccessService.Log(client, clientIP, country, c.GetHeader("User-Agent"), "html")
+		if err = s.renderLanding(c, client, subId); err != nil {
+			logger.Error("sub: landing page: ", err)
+			c.String(500, "Error!")
+		}
+		return
+	}
+
 	format, isFormat := c.GetQuery("format")
+	go s.SubAccessService.Log(client, clientIP, country, c.GetHeader("User-Agent"), format)
+
+	etag := subETag(client, c, s.usageInBody(format, isFormat))
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		updateInterval, _ := s.SettingService.GetSubUpdates()
+		headers = util.GetHeaders(client, updateInterval)
+		c.Writer.Header().Set("Subscription-Userinfo", headers[0])
+		c.Writer.Header().Set("Profile-Update-Interval", headers[1])
+		c.Writer.Header().Set("Profile-Title", headers[2])
+		c.Status(304)
+		return
+	}
+
 	if isFormat {
 		switch format {
 		case "json":
-			result, headers, err = s.JsonService.GetJson(subId, format)
+			result, headers, err = s.JsonService.GetJson(subId, format, detectPlatform(c))
 		case "clash":
-			result, headers, err = s.ClashService.GetClash(subId)
+			result, headers, err = s.ClashService.GetClash(subId, detectPlatform(c), requestHost(c))
+		case "clash-provider":
+			result, headers, err = s.ClashService.GetClashProvider(subId)
+		default:
+			if IsProxyFormat(format) {
+				result, headers, err = s.FormatService.GetFormat(subId, format, requestHost(c))
+			}
 		}
 		if err != nil || result == nil {
 			logger.Error(err)
@@ -56,3 +110,76 @@ func (s *SubHandler) subs(c *gin.Context) {
 
 	c.String(200, *result)
 }
+
+// startTime tells ETags of an earlier run apart, as service.LastUpdate is not persisted.
+var startTime = time.Now().UnixNano()
+
+// subETag identifies the subscription content. It covers the config version,
+// the client, the request and the external subscriptions. The usage only
+// counts for outputs which show it, the others get it in the headers of a 304.
+// The hour is included with it for the remaining days.
+func subETag(client *model.Client, c *gin.Context, usage bool) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d|%d|%d|%s|%s|",
+		startTime, service.LastUpdate, client.Id, c.Request.URL.RawQuery, detectPlatform(c))
+	if usage {
+		fmt.Fprintf(h, "%d|%d|%d|", client.Up, client.Down, time.Now().Unix()/3600)
+	}
+	h.Write(client.Config)
+	h.Write(client.Links)
+	h.Write([]byte(externalSubsVersion(client.Links)))
+	return "\"" + hex.EncodeToString(h.Sum(nil)[:16]) + "\""
+}
+
+// usageInBody reports whether an output shows the usage of the client, not only
+// its Subscription-Userinfo header.
+func (s *SubHandler) usageInBody(format string, isFormat bool) bool {
+	if !isFormat {
+		showInfo, _ := s.SettingService.GetSubShowInfo()
+		return showInfo
+	}
+	return format == "shadowrocket"
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// detectPlatform selects the template variant by the platform query
+// parameter, or else by the User-Agent of the client app.
+func detectPlatform(c *gin.Context) string {
+	if platform, ok := c.GetQuery("platform"); ok {
+		if slices.Contains(service.SubPlatforms, platform) {
+			return platform
+		}
+		return ""
+	}
+	ua := strings.ToLower(c.GetHeader("User-Agent"))
+	switch {
+	// sing-box apps: SFA on Android, SFI on iOS, SFT on tvOS and SFM on macOS
+	case strings.HasPrefix(ua, "sfa/") || strings.Contains(ua, "android"):
+		return "android"
+	case strings.HasPrefix(ua, "sfi/") || strings.HasPrefix(ua, "sft/") ||
+		strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ios"):
+		return "ios"
+	case strings.HasPrefix(ua, "sfm/") || strings.Contains(ua, "windows") ||
+		strings.Contains(ua, "macintosh") || strings.Contains(ua, "mac os") || strings.Contains(ua, "linux"):
+		return "desktop"
+	}
+	return ""
+}
+
+// requestHost returns the host name the client used to reach the subscription.
+func requestHost(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		return c.Request.Host
+	}
+	return host
+}
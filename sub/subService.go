@@ -6,7 +6,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/igor04091968/sing-chisel-tel/database"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
 	"github.com/igor04091968/sing-chisel-tel/service"
 	"github.com/igor04091968/sing-chisel-tel/util"
@@ -14,15 +13,12 @@ import (
 
 type SubService struct {
 	service.SettingService
+	service.ClientService
 	LinkService
 }
 
 func (s *SubService) GetSubs(subId string) (*string, []string, error) {
-	var err error
-
-	db := database.GetDB()
-	client := &model.Client{}
-	err = db.Model(model.Client{}).Where("enable = true and name = ?", subId).First(client).Error
+	client, err := s.ClientService.GetBySubToken(subId)
 	if err != nil {
 		return nil, nil, err
 	}
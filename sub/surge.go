@@ -0,0 +1,114 @@
+package sub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// surgeProxy converts to a Surge [Proxy] line. Surge has no VLESS, Hysteria v1,
+// AnyTLS, REALITY, gRPC or HTTP/2 transport.
+func surgeProxy(p *proxyInfo) (string, error) {
+	var proto string
+	var params lineParams
+	switch p.Type {
+	case "shadowsocks":
+		proto = "ss"
+		params.add("encrypt-method", p.Method)
+		params.add("password", p.Password)
+		params.add("udp-relay", "true")
+	case "vmess":
+		proto = "vmess"
+		params.add("username", p.UUID)
+		params.addBool("vmess-aead", p.AlterId == 0)
+	case "trojan":
+		proto = "trojan"
+		params.add("password", p.Password)
+	case "http", "socks":
+		proto = map[string]string{"http": "http", "socks": "socks5"}[p.Type]
+		if p.TLS {
+			proto = map[string]string{"http": "https", "socks": "socks5-tls"}[p.Type]
+		}
+		line := fmt.Sprintf("%s = %s, %s, %d", lineName(p.Name), proto, p.Server, p.Port)
+		if p.Username != "" {
+			line += ", " + p.Username + ", " + p.Password
+		}
+		surgeTLS(p, &params)
+		if len(params) > 0 {
+			line += ", " + strings.Join(params, ", ")
+		}
+		return line, nil
+	case "tuic":
+		proto = "tuic-v5"
+		params.add("password", p.Password)
+		params.add("uuid", p.UUID)
+		params.add("alpn", strings.Join(p.ALPN, ","))
+	case "hysteria2":
+		if p.Obfs != "" {
+			return "", errUnsupported
+		}
+		proto = "hysteria2"
+		params.add("password", p.Password)
+		if p.DownMbps > 0 {
+			params.add("download-bandwidth", strconv.Itoa(p.DownMbps))
+		}
+	default:
+		return "", errUnsupported
+	}
+	if p.Reality {
+		return "", errUnsupported
+	}
+
+	switch p.Transport {
+	case "":
+	case "ws":
+		params.add("ws", "true")
+		params.add("ws-path", p.Path)
+		if p.Host != "" {
+			params.add("ws-headers", "Host:"+p.Host)
+		}
+	default:
+		return "", errUnsupported
+	}
+	surgeTLS(p, &params)
+
+	return fmt.Sprintf("%s = %s, %s, %d, %s", lineName(p.Name), proto, p.Server, p.Port, strings.Join(params, ", ")), nil
+}
+
+func surgeTLS(p *proxyInfo, params *lineParams) {
+	if !p.TLS {
+		return
+	}
+	// the other protocols always use TLS, or say so by their name
+	if p.Type == "vmess" {
+		params.add("tls", "true")
+	}
+	params.add("sni", p.SNI)
+	params.addBool("skip-cert-verify", p.Insecure)
+}
+
+// renderSurge writes a managed profile, which Surge refreshes from the
+// subscription URL.
+func renderSurge(f *formatContext, lines []string) (string, error) {
+	proxies := f.proxyList(", ")
+
+	var b strings.Builder
+	if f.url != "" {
+		fmt.Fprintf(&b, "#!MANAGED-CONFIG %s interval=%d strict=false\n\n", f.url, f.updateHours*3600)
+	}
+	b.WriteString("[General]\n")
+	b.WriteString("loglevel = notify\n")
+	b.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, localhost, *.local\n")
+	b.WriteString("dns-server = system, 1.1.1.1, 8.8.8.8\n\n")
+	b.WriteString("[Proxy]\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n[Proxy Group]\n")
+	fmt.Fprintf(&b, "Proxy = select, Auto, %s\n", proxies)
+	fmt.Fprintf(&b, "Auto = url-test, %s, url=http://www.gstatic.com/generate_204, interval=300, tolerance=50\n\n", proxies)
+	b.WriteString("[Rule]\n")
+	b.WriteString("GEOIP,LAN,DIRECT\n")
+	b.WriteString("FINAL,Proxy,dns-failed\n")
+	return b.String(), nil
+}
@@ -0,0 +1,168 @@
+package sub
+
+import "encoding/json"
+
+// v2raynProxy converts to a complete Xray config, as v2rayN imports a JSON
+// array of them. Xray has no TUIC, Hysteria or AnyTLS.
+func v2raynProxy(p *proxyInfo) (string, error) {
+	outbound := map[string]interface{}{
+		"tag": "proxy",
+	}
+	switch p.Type {
+	case "vless", "vmess":
+		user := map[string]interface{}{"id": p.UUID}
+		if p.Type == "vless" {
+			user["encryption"] = "none"
+			if p.Flow != "" {
+				user["flow"] = p.Flow
+			}
+		} else {
+			user["alterId"] = p.AlterId
+			user["security"] = "auto"
+		}
+		outbound["settings"] = map[string]interface{}{
+			"vnext": []interface{}{map[string]interface{}{
+				"address": p.Server,
+				"port":    p.Port,
+				"users":   []interface{}{user},
+			}},
+		}
+	case "trojan", "shadowsocks":
+		server := map[string]interface{}{
+			"address":  p.Server,
+			"port":     p.Port,
+			"password": p.Password,
+		}
+		if p.Type == "shadowsocks" {
+			server["method"] = p.Method
+			if p.UDPOverTCP {
+				server["uot"] = true
+			}
+		}
+		outbound["settings"] = map[string]interface{}{"servers": []interface{}{server}}
+	case "socks", "http":
+		server := map[string]interface{}{
+			"address": p.Server,
+			"port":    p.Port,
+		}
+		if p.Username != "" {
+			server["users"] = []interface{}{map[string]interface{}{"user": p.Username, "pass": p.Password}}
+		}
+		outbound["settings"] = map[string]interface{}{"servers": []interface{}{server}}
+	default:
+		return "", errUnsupported
+	}
+	outbound["protocol"] = p.Type
+
+	stream, err := xrayStream(p)
+	if err != nil {
+		return "", err
+	}
+	outbound["streamSettings"] = stream
+	if p.Multiplex {
+		outbound["mux"] = map[string]interface{}{"enabled": true, "concurrency": 8}
+	}
+
+	config := map[string]interface{}{
+		"remarks": p.Name,
+		"log":     map[string]interface{}{"loglevel": "warning"},
+		"inbounds": []interface{}{
+			map[string]interface{}{
+				"tag":      "socks",
+				"listen":   "127.0.0.1",
+				"port":     10808,
+				"protocol": "socks",
+				"settings": map[string]interface{}{"udp": true},
+				"sniffing": map[string]interface{}{"enabled": true, "destOverride": []string{"http", "tls"}},
+			},
+			map[string]interface{}{
+				"tag":      "http",
+				"listen":   "127.0.0.1",
+				"port":     10809,
+				"protocol": "http",
+			},
+		},
+		"outbounds": []interface{}{
+			outbound,
+			map[string]interface{}{"tag": "direct", "protocol": "freedom"},
+			map[string]interface{}{"tag": "block", "protocol": "blackhole"},
+		},
+		"routing": map[string]interface{}{
+			"domainStrategy": "AsIs",
+			"rules": []interface{}{
+				map[string]interface{}{"type": "field", "ip": []string{"geoip:private"}, "outboundTag": "direct"},
+			},
+		},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// xrayStream converts the transport and TLS to Xray stream settings.
+func xrayStream(p *proxyInfo) (map[string]interface{}, error) {
+	stream := map[string]interface{}{}
+	switch p.Transport {
+	case "":
+		stream["network"] = "tcp"
+	case "ws":
+		stream["network"] = "ws"
+		stream["wsSettings"] = map[string]interface{}{"path": p.Path, "host": p.Host}
+	case "httpupgrade":
+		stream["network"] = "httpupgrade"
+		stream["httpupgradeSettings"] = map[string]interface{}{"path": p.Path, "host": p.Host}
+	case "grpc":
+		stream["network"] = "grpc"
+		stream["grpcSettings"] = map[string]interface{}{"serviceName": p.ServiceName}
+	case "http":
+		stream["network"] = "h2"
+		h2 := map[string]interface{}{"path": p.Path}
+		if p.Host != "" {
+			h2["host"] = []string{p.Host}
+		}
+		stream["httpSettings"] = h2
+	default:
+		return nil, errUnsupported
+	}
+
+	if !p.TLS {
+		return stream, nil
+	}
+	if p.Reality {
+		stream["security"] = "reality"
+		stream["realitySettings"] = map[string]interface{}{
+			"serverName":  p.SNI,
+			"publicKey":   p.PublicKey,
+			"shortId":     p.ShortId,
+			"fingerprint": p.Fingerprint,
+		}
+		return stream, nil
+	}
+	tls := map[string]interface{}{
+		"serverName":    p.SNI,
+		"allowInsecure": p.Insecure,
+	}
+	if len(p.ALPN) > 0 {
+		tls["alpn"] = p.ALPN
+	}
+	if p.Fingerprint != "" {
+		tls["fingerprint"] = p.Fingerprint
+	}
+	stream["security"] = "tls"
+	stream["tlsSettings"] = tls
+	return stream, nil
+}
+
+func renderV2rayN(f *formatContext, lines []string) (string, error) {
+	configs := make([]json.RawMessage, len(lines))
+	for i, line := range lines {
+		configs[i] = json.RawMessage(line)
+	}
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,23 @@
+package telegram
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/events"
+	"gopkg.in/telebot.v3"
+)
+
+// registerAlertSender delivers the events of telegram sinks to all admins.
+func registerAlertSender(bot *telebot.Bot, cfg *Config) {
+	events.RegisterSender("telegram", func(e *events.Event) error {
+		text := fmt.Sprintf("⚠️ %s\n%s\n%s", e.Type, e.Message, time.Unix(e.Time, 0).Format("2006-01-02 15:04:05"))
+		var lastErr error
+		for _, adminID := range cfg.AdminUserIDs {
+			if _, err := bot.Send(&telebot.Chat{ID: adminID}, text); err != nil {
+				lastErr = err
+			}
+		}
+		return lastErr
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/igor04091968/sing-chisel-tel/core"
 	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/igor04091968/sing-chisel-tel/events"
 	"github.com/igor04091968/sing-chisel-tel/service"
 	"gopkg.in/telebot.v3"
 )
@@ -23,6 +29,7 @@ type AppServices interface {
 	GetMTProtoService() *service.MTProtoEmbeddedService
 	GetGreService() *service.GreService
 	GetTapService() *service.TapService
+	GetTgBindingService() *service.TgBindingService
 	GetFirstInboundId() (uint, error)
 	GetUserByEmail(email string) (*model.Client, error)
 	FromIds(ids []uint) ([]*model.Inbound, error)
@@ -36,48 +43,164 @@ type AppServices interface {
 	RestartApp()
 }
 
-// Start initializes and starts the Telegram bot.
-func Start(ctx context.Context, cfg *Config, app AppServices) {
+var (
+	runMu   sync.Mutex
+	running *runningBot
+)
+
+type runningBot struct {
+	bot    *telebot.Bot
+	cfg    Config
+	cancel context.CancelFunc
+}
+
+// Apply starts, restarts or stops the bot so it matches cfg.
+// It does nothing while the running bot already uses the same configuration.
+func Apply(cfg *Config, app AppServices) error {
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	if running != nil && cfg != nil && reflect.DeepEqual(running.cfg, *cfg) {
+		return nil
+	}
+	stopLocked()
 	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	if cfg.BotToken == "" {
+		return fmt.Errorf("the bot token is not set")
+	}
+
+	r, err := start(*cfg, app)
+	if err != nil {
+		return err
+	}
+	running = r
+	return nil
+}
+
+// Stop stops the bot if it is running.
+func Stop() {
+	runMu.Lock()
+	defer runMu.Unlock()
+	stopLocked()
+}
+
+func stopLocked() {
+	if running == nil {
 		return
 	}
+	events.RegisterSender("telegram", nil)
+	service.SetLoginApprover(nil)
+	activeWebhook.Store(nil)
+	running.cancel()
+	running.bot.Stop()
+	running = nil
+	log.Println("Telegram bot stopped.")
+}
 
+func start(config Config, app AppServices) (*runningBot, error) {
+	// Handlers keep their own copy, so later changes only apply on restart
+	cfg := &config
+
+	client, err := newHTTPClient(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	var poller telebot.Poller = newLongPoller()
+	var hook *webhookPoller
+	if cfg.Webhook {
+		if cfg.WebhookURL != "" {
+			hook = newWebhookPoller(cfg)
+			poller = hook
+		} else {
+			log.Println("Telegram: the webhook needs the panel on https with a domain or tgWebhookURL, using long polling.")
+		}
+	}
 	pref := telebot.Settings{
 		Token:  cfg.BotToken,
-		Poller: &telebot.LongPoller{Timeout: 10},
+		Poller: poller,
+		Client: client,
 	}
 
 	bot, err := telebot.NewBot(pref)
 	if err != nil {
-		log.Fatalf("Failed to create Telegram bot: %v", err)
+		return nil, fmt.Errorf("failed to create Telegram bot: %v", err)
 	}
+	if hook == nil {
+		// A webhook left over from an earlier run blocks long polling
+		bot.RemoveWebhook()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 
 	// Middleware to check for admin user
 	adminOnly := bot.Group()
 	adminOnly.Use(func(next telebot.HandlerFunc) telebot.HandlerFunc {
 		return func(c telebot.Context) error {
-			isAdmin := false
-			for _, adminID := range cfg.AdminUserIDs {
-				if c.Sender().ID == int64(adminID) {
-					isAdmin = true
-					break
-				}
+			if !cfg.isAdmin(c.Sender()) {
+				return c.Send("Access denied.")
 			}
-			if !isAdmin {
+			return next(c)
+		}
+	})
+
+	// Middleware for the self-service client mode
+	clients := bot.Group()
+	clients.Use(func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			if !cfg.ClientMode {
 				return c.Send("Access denied.")
 			}
 			return next(c)
 		}
 	})
 
+	// /start is shared, admins get the admin menu and everybody else the client menu
+	bot.Handle("/start", func(c telebot.Context) error {
+		if cfg.isAdmin(c.Sender()) {
+			return sendMainMenu(c)
+		}
+		if cfg.ClientMode {
+			return sendClientMenu(c, app)
+		}
+		return c.Send("Access denied.")
+	})
+
 	// Register handlers
 	registerHandlers(adminOnly, app)
+	registerSelfServiceHandlers(clients, app)
+	registerLoginApprovalHandlers(adminOnly)
+
+	if cfg.ClientMode {
+		go runUsageWarnings(ctx, bot, cfg, app)
+	}
+	registerAlertSender(bot, cfg)
+	registerLoginApprover(bot, cfg)
 
 	log.Println("Telegram bot started...")
-	bot.Start()
+	activeWebhook.Store(hook)
+	go bot.Start()
+	return &runningBot{bot: bot, cfg: config, cancel: cancel}, nil
+}
+
+// newHTTPClient returns the client for the Telegram API, optionally through a proxy.
+func newHTTPClient(proxy string) (*http.Client, error) {
+	client := &http.Client{Timeout: time.Minute}
+	if proxy == "" {
+		return client, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %v", err)
+	}
+	client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	return client, nil
 }
 
 func registerHandlers(b *telebot.Group, app AppServices) {
+	// Inline-keyboard menus for clients, services and system tasks
+	registerMenuHandlers(b, app)
+
 	// UDP Tunnel Handlers
 	b.Handle("/add_udptunnel", func(c telebot.Context) error {
 		return handleAddUdpTunnel(c, app.GetUdpTunnelService())
@@ -94,8 +217,6 @@ func registerHandlers(b *telebot.Group, app AppServices) {
 	b.Handle("/stop_udptunnel", func(c telebot.Context) error {
 		return handleStopUdpTunnel(c, app.GetUdpTunnelService())
 	})
-
-	// Add other handlers here from the original file if they existed
 }
 
 func handleAddUdpTunnel(c telebot.Context, udpTunnelService *service.UdpTunnelService) error {
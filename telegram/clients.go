@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"gopkg.in/telebot.v3"
+)
+
+func registerClientHandlers(b *telebot.Group, app AppServices) {
+	b.Handle(btnClients, func(c telebot.Context) error {
+		_ = c.Respond()
+		page, _ := strconv.Atoi(argString(c, 0))
+		return showClients(c, app, page)
+	})
+	b.Handle(btnClient, func(c telebot.Context) error {
+		_ = c.Respond()
+		id, err := argUint(c, 0)
+		if err != nil {
+			return c.Send("Invalid client.")
+		}
+		return showClient(c, app, id)
+	})
+	b.Handle(btnClientOn, func(c telebot.Context) error {
+		return setClientEnable(c, app, true)
+	})
+	b.Handle(btnClientOff, func(c telebot.Context) error {
+		return setClientEnable(c, app, false)
+	})
+}
+
+func showClients(c telebot.Context, app AppServices, page int) error {
+	clients, err := app.GetAllUsers()
+	if err != nil {
+		return c.Send(fmt.Sprintf("Error getting clients: %v", err))
+	}
+	list := *clients
+	if len(list) == 0 {
+		menu := &telebot.ReplyMarkup{}
+		menu.Inline(menu.Row(menu.Data("Main menu", btnMenu.Unique)))
+		return c.Edit("No clients configured.", menu)
+	}
+
+	pages := (len(list) + clientsPerPage - 1) / clientsPerPage
+	if page < 0 || page >= pages {
+		page = 0
+	}
+	start := page * clientsPerPage
+	end := start + clientsPerPage
+	if end > len(list) {
+		end = len(list)
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, client := range list[start:end] {
+		state := "on"
+		if !client.Enable {
+			state = "off"
+		}
+		text := fmt.Sprintf("%s [%s]", client.Name, state)
+		rows = append(rows, menu.Row(menu.Data(text, btnClient.Unique, strconv.FormatUint(uint64(client.Id), 10))))
+	}
+	var nav []telebot.Btn
+	if page > 0 {
+		nav = append(nav, menu.Data("« Prev", btnClients.Unique, strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, menu.Data("Next »", btnClients.Unique, strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, menu.Row(nav...))
+	}
+	rows = append(rows, menu.Row(menu.Data("Main menu", btnMenu.Unique)))
+	menu.Inline(rows...)
+
+	return c.Edit(fmt.Sprintf("Clients (page %d/%d):", page+1, pages), menu)
+}
+
+func showClient(c telebot.Context, app AppServices, id uint) error {
+	client, err := findClient(app, id)
+	if err != nil {
+		return c.Send(err.Error())
+	}
+
+	idStr := strconv.FormatUint(uint64(id), 10)
+	menu := &telebot.ReplyMarkup{}
+	toggle := menu.Data("Disable", btnClientOff.Unique, idStr)
+	if !client.Enable {
+		toggle = menu.Data("Enable", btnClientOn.Unique, idStr)
+	}
+	menu.Inline(
+		menu.Row(toggle, menu.Data("Refresh", btnClient.Unique, idStr)),
+		backRow(menu, "« Clients", btnClients.Unique, "0"),
+	)
+	return c.Edit(formatClient(client), menu)
+}
+
+func setClientEnable(c telebot.Context, app AppServices, enable bool) error {
+	id, err := argUint(c, 0)
+	if err != nil {
+		return c.RespondText("Invalid client.")
+	}
+	actor := fmt.Sprintf("TelegramBot:%d", c.Sender().ID)
+	if err := app.GetConfigService().SetClientEnable(id, enable, actor); err != nil {
+		return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+	}
+	if enable {
+		_ = c.RespondText("Client enabled.")
+	} else {
+		_ = c.RespondText("Client disabled.")
+	}
+	return showClient(c, app, id)
+}
+
+func findClient(app AppServices, id uint) (*model.Client, error) {
+	clients, err := app.GetAllUsers()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting clients: %v", err)
+	}
+	for _, client := range *clients {
+		if client.Id == id {
+			return &client, nil
+		}
+	}
+	return nil, fmt.Errorf("Client with ID %d not found.", id)
+}
+
+func formatClient(client *model.Client) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Client: %s (ID: %d)\n", client.Name, client.Id))
+	if client.Enable {
+		sb.WriteString("Status: enabled\n")
+	} else {
+		sb.WriteString("Status: disabled\n")
+	}
+	if client.Group != "" {
+		sb.WriteString(fmt.Sprintf("Group: %s\n", client.Group))
+	}
+	if client.Desc != "" {
+		sb.WriteString(fmt.Sprintf("Description: %s\n", client.Desc))
+	}
+	sb.WriteString(fmt.Sprintf("Upload: %s\n", formatBytes(client.Up)))
+	sb.WriteString(fmt.Sprintf("Download: %s\n", formatBytes(client.Down)))
+	if client.Volume > 0 {
+		sb.WriteString(fmt.Sprintf("Used: %s of %s\n", formatBytes(client.Up+client.Down), formatBytes(client.Volume)))
+	} else {
+		sb.WriteString(fmt.Sprintf("Used: %s (unlimited)\n", formatBytes(client.Up+client.Down)))
+	}
+	if client.Expiry > 0 {
+		sb.WriteString(fmt.Sprintf("Expiry: %s\n", time.Unix(client.Expiry, 0).Format("2006-01-02 15:04")))
+	} else {
+		sb.WriteString("Expiry: never\n")
+	}
+	return sb.String()
+}
@@ -1,7 +1,82 @@
 package telegram
 
+import (
+	"github.com/igor04091968/sing-chisel-tel/service"
+	"gopkg.in/telebot.v3"
+)
+
 type Config struct {
 	BotToken     string  `json:"bot_token"`
 	AdminUserIDs []int64 `json:"admin_user_ids"`
 	Enabled      bool    `json:"enabled"`
+	// ClientMode lets clients bind their account with a code from the panel
+	ClientMode bool `json:"client_mode"`
+	// WarnVolumePercent lists the used-volume percentages clients are warned at
+	WarnVolumePercent []int `json:"warn_volume_percent"`
+	// WarnDays lists the days before expiry clients are warned at
+	WarnDays []int `json:"warn_days"`
+	// Proxy is an http, https or socks5 URL used to reach the Telegram API
+	Proxy string `json:"proxy"`
+	// Webhook lets Telegram push updates to the panel instead of long polling
+	Webhook bool `json:"webhook"`
+	// WebhookURL is the public https URL of the panel
+	WebhookURL string `json:"webhook_url"`
+	// WebhookSecret protects the webhook path and is checked in the secret-token header
+	WebhookSecret string `json:"webhook_secret"`
+	// WebhookCert is the panel certificate, uploaded to Telegram if it is self-signed
+	WebhookCert string `json:"webhook_cert"`
+}
+
+// LoadConfig reads the bot configuration from the settings.
+func LoadConfig(settings *service.SettingService) (*Config, error) {
+	var err error
+	cfg := &Config{}
+	if cfg.Enabled, err = settings.GetTgEnable(); err != nil {
+		return nil, err
+	}
+	if cfg.BotToken, err = settings.GetTgBotToken(); err != nil {
+		return nil, err
+	}
+	if cfg.AdminUserIDs, err = settings.GetTgAdminIds(); err != nil {
+		return nil, err
+	}
+	if cfg.ClientMode, err = settings.GetTgClientMode(); err != nil {
+		return nil, err
+	}
+	if cfg.WarnVolumePercent, err = settings.GetTgWarnVolume(); err != nil {
+		return nil, err
+	}
+	if cfg.WarnDays, err = settings.GetTgWarnDays(); err != nil {
+		return nil, err
+	}
+	if cfg.Proxy, err = settings.GetTgProxy(); err != nil {
+		return nil, err
+	}
+	if cfg.Webhook, err = settings.GetTgWebhook(); err != nil {
+		return nil, err
+	}
+	if cfg.Webhook {
+		if cfg.WebhookURL, err = settings.GetTgWebhookURL(); err != nil {
+			return nil, err
+		}
+		if cfg.WebhookSecret, err = settings.GetTgWebhookSecret(); err != nil {
+			return nil, err
+		}
+		if cfg.WebhookCert, err = settings.GetCertFile(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) isAdmin(user *telebot.User) bool {
+	if user == nil {
+		return false
+	}
+	for _, adminID := range cfg.AdminUserIDs {
+		if user.ID == adminID {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"fmt"
+
+	"github.com/igor04091968/sing-chisel-tel/service"
+	"gopkg.in/telebot.v3"
+)
+
+var (
+	btnLoginOk   = &telebot.Btn{Unique: "login_ok"}
+	btnLoginDeny = &telebot.Btn{Unique: "login_deny"}
+)
+
+// registerLoginApprover lets panel logins with 2FA be approved by the admins.
+func registerLoginApprover(bot *telebot.Bot, cfg *Config) {
+	service.SetLoginApprover(func(id string, username string, ip string) error {
+		menu := &telebot.ReplyMarkup{}
+		menu.Inline(menu.Row(menu.Data("✅ Approve", btnLoginOk.Unique, id), menu.Data("❌ Deny", btnLoginDeny.Unique, id)))
+		text := fmt.Sprintf("🔐 Panel login of %s from %s", username, ip)
+		var lastErr error
+		sent := false
+		for _, adminID := range cfg.AdminUserIDs {
+			if _, err := bot.Send(&telebot.Chat{ID: adminID}, text, menu); err != nil {
+				lastErr = err
+			} else {
+				sent = true
+			}
+		}
+		if sent {
+			return nil
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no Telegram admins configured")
+		}
+		return lastErr
+	})
+}
+
+func registerLoginApprovalHandlers(b *telebot.Group) {
+	b.Handle(btnLoginOk, func(c telebot.Context) error {
+		return resolveLogin(c, true)
+	})
+	b.Handle(btnLoginDeny, func(c telebot.Context) error {
+		return resolveLogin(c, false)
+	})
+}
+
+func resolveLogin(c telebot.Context, approve bool) error {
+	_ = c.Respond()
+	var twoFactorService service.TwoFactorService
+	username, ip, err := twoFactorService.ResolveLogin(argString(c, 0), approve)
+	if err != nil {
+		return c.Edit("🔐 " + err.Error())
+	}
+	answer := "denied"
+	if approve {
+		answer = "approved"
+	}
+	return c.Edit(fmt.Sprintf("🔐 Panel login of %s from %s %s", username, ip, answer))
+}
@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Callback endpoints of the inline keyboards. Button payloads are passed as
+// callback data and read back with c.Args().
+var (
+	btnMenu       = &telebot.Btn{Unique: "menu"}
+	btnClients    = &telebot.Btn{Unique: "clients"}
+	btnClient     = &telebot.Btn{Unique: "client"}
+	btnClientOn   = &telebot.Btn{Unique: "client_on"}
+	btnClientOff  = &telebot.Btn{Unique: "client_off"}
+	btnOnlines    = &telebot.Btn{Unique: "onlines"}
+	btnLogs       = &telebot.Btn{Unique: "logs"}
+	btnBackup     = &telebot.Btn{Unique: "backup"}
+	btnRestart    = &telebot.Btn{Unique: "restart"}
+	btnRestartOk  = &telebot.Btn{Unique: "restart_ok"}
+	btnServices   = &telebot.Btn{Unique: "services"}
+	btnService    = &telebot.Btn{Unique: "service"}
+	btnSvcStart   = &telebot.Btn{Unique: "svc_start"}
+	btnSvcStop    = &telebot.Btn{Unique: "svc_stop"}
+	btnSvcDelete  = &telebot.Btn{Unique: "svc_del"}
+	btnSvcDelOk   = &telebot.Btn{Unique: "svc_del_ok"}
+	btnSvcRefresh = &telebot.Btn{Unique: "svc_list"}
+)
+
+const clientsPerPage = 10
+
+func registerMenuHandlers(b *telebot.Group, app AppServices) {
+	b.Handle("/menu", sendMainMenu)
+	b.Handle(btnMenu, func(c telebot.Context) error {
+		_ = c.Respond()
+		return c.Edit("Main menu", mainMenu())
+	})
+
+	registerClientHandlers(b, app)
+	registerServiceHandlers(b, app)
+	registerSystemHandlers(b, app)
+}
+
+func sendMainMenu(c telebot.Context) error {
+	return c.Send("Main menu", mainMenu())
+}
+
+func mainMenu() *telebot.ReplyMarkup {
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("Clients", btnClients.Unique, "0"), menu.Data("Online", btnOnlines.Unique)),
+		menu.Row(menu.Data("Services", btnServices.Unique), menu.Data("Logs", btnLogs.Unique, "info")),
+		menu.Row(menu.Data("DB backup", btnBackup.Unique), menu.Data("Restart", btnRestart.Unique)),
+	)
+	return menu
+}
+
+func backRow(menu *telebot.ReplyMarkup, text string, unique string, data ...string) telebot.Row {
+	return menu.Row(menu.Data(text, unique, data...), menu.Data("Main menu", btnMenu.Unique))
+}
+
+// argUint parses the callback argument at index i as an ID.
+func argUint(c telebot.Context, i int) (uint, error) {
+	args := c.Args()
+	if len(args) <= i {
+		return 0, fmt.Errorf("missing argument %d", i)
+	}
+	id, err := strconv.ParseUint(args[i], 10, 32)
+	return uint(id), err
+}
+
+// argString returns the callback argument at index i, or an empty string.
+func argString(c telebot.Context, i int) string {
+	args := c.Args()
+	if len(args) <= i {
+		return ""
+	}
+	return args[i]
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
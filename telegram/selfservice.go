@@ -0,0 +1,255 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/igor04091968/sing-chisel-tel/database/model"
+	"github.com/skip2/go-qrcode"
+	"gopkg.in/telebot.v3"
+)
+
+var (
+	btnMySub   = &telebot.Btn{Unique: "my_sub"}
+	btnMyQR    = &telebot.Btn{Unique: "my_qr"}
+	btnMyLinks = &telebot.Btn{Unique: "my_links"}
+	btnMyUsage = &telebot.Btn{Unique: "my_usage"}
+)
+
+var (
+	defaultWarnVolumePercent = []int{80, 95}
+	defaultWarnDays          = []int{3, 1}
+)
+
+const usageWarningInterval = 10 * time.Minute
+
+func registerSelfServiceHandlers(b *telebot.Group, app AppServices) {
+	b.Handle("/bind", func(c telebot.Context) error {
+		args := c.Args()
+		if len(args) != 1 {
+			return c.Send("Usage: /bind <code>\nYou get the code from your provider.")
+		}
+		client, err := app.GetTgBindingService().Bind(args[0], c.Chat().ID, c.Sender().Username)
+		if err != nil {
+			return c.Send(fmt.Sprintf("Binding failed: %v", err))
+		}
+		return c.Send(fmt.Sprintf("Your account is now bound to '%s'.", client.Name), selfServiceMenu())
+	})
+	b.Handle("/unbind", func(c telebot.Context) error {
+		if err := app.GetTgBindingService().Unbind(c.Chat().ID); err != nil {
+			return c.Send(fmt.Sprintf("Error: %v", err))
+		}
+		return c.Send("Your account has been unbound.")
+	})
+	b.Handle(btnMySub, func(c telebot.Context) error {
+		_ = c.Respond()
+		return withBoundClient(c, app, func(client *model.Client) error {
+			url, err := subURL(app, client)
+			if err != nil {
+				return c.Send(err.Error())
+			}
+			return c.Send(fmt.Sprintf("Your subscription URL:\n%s", url), telebot.NoPreview)
+		})
+	})
+	b.Handle(btnMyQR, func(c telebot.Context) error {
+		_ = c.Respond()
+		return withBoundClient(c, app, func(client *model.Client) error {
+			url, err := subURL(app, client)
+			if err != nil {
+				return c.Send(err.Error())
+			}
+			png, err := qrcode.Encode(url, qrcode.Medium, 512)
+			if err != nil {
+				return c.Send(fmt.Sprintf("Error creating QR code: %v", err))
+			}
+			return c.Send(&telebot.Photo{File: telebot.FromReader(bytes.NewReader(png)), Caption: "Scan it with your client app."})
+		})
+	})
+	b.Handle(btnMyLinks, func(c telebot.Context) error {
+		_ = c.Respond()
+		return withBoundClient(c, app, func(client *model.Client) error {
+			links := clientLinks(client)
+			if len(links) == 0 {
+				return c.Send("No links available.")
+			}
+			return c.Send(truncate(strings.Join(links, "\n\n")), telebot.NoPreview)
+		})
+	})
+	b.Handle(btnMyUsage, func(c telebot.Context) error {
+		_ = c.Respond()
+		return withBoundClient(c, app, func(client *model.Client) error {
+			return c.Send(formatUsage(client))
+		})
+	})
+}
+
+func sendClientMenu(c telebot.Context, app AppServices) error {
+	client, err := app.GetTgBindingService().GetClientByChat(c.Chat().ID)
+	if err != nil {
+		return c.Send("Welcome! Send /bind <code> with the code from your provider to link your account.")
+	}
+	return c.Send(fmt.Sprintf("Hello, %s!", client.Name), selfServiceMenu())
+}
+
+func selfServiceMenu() *telebot.ReplyMarkup {
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("Subscription", btnMySub.Unique), menu.Data("QR code", btnMyQR.Unique)),
+		menu.Row(menu.Data("Links", btnMyLinks.Unique), menu.Data("Usage", btnMyUsage.Unique)),
+	)
+	return menu
+}
+
+func withBoundClient(c telebot.Context, app AppServices, fn func(client *model.Client) error) error {
+	client, err := app.GetTgBindingService().GetClientByChat(c.Chat().ID)
+	if err != nil {
+		return c.Send("Your account is not bound. Send /bind <code> first.")
+	}
+	return fn(client)
+}
+
+func subURL(app AppServices, client *model.Client) (string, error) {
+	settings := app.GetConfigService().SettingService
+	host, _ := settings.GetWebDomain()
+	uri, err := settings.GetFinalSubURI(host)
+	if err != nil {
+		return "", fmt.Errorf("Error getting subscription URL: %v", err)
+	}
+	if strings.Contains(uri, "://:") {
+		return "", fmt.Errorf("The subscription URL is not configured yet, please contact your provider.")
+	}
+	return uri + client.SubToken, nil
+}
+
+func clientLinks(client *model.Client) []string {
+	var links []struct {
+		Type   string `json:"type"`
+		Remark string `json:"remark"`
+		Uri    string `json:"uri"`
+	}
+	if err := json.Unmarshal(client.Links, &links); err != nil {
+		return nil
+	}
+	var result []string
+	for _, link := range links {
+		// Nested subscriptions are only resolved by the subscription server
+		if link.Type == "sub" {
+			continue
+		}
+		result = append(result, link.Uri)
+	}
+	return result
+}
+
+// formatUsage shows the remaining volume and days like the subscription info does.
+func formatUsage(client *model.Client) string {
+	var sb strings.Builder
+	if !client.Enable {
+		sb.WriteString("Your account is disabled.\n")
+	}
+	used := client.Up + client.Down
+	sb.WriteString(fmt.Sprintf("Used: %s (up %s, down %s)\n", formatBytes(used), formatBytes(client.Up), formatBytes(client.Down)))
+	if client.Volume > 0 {
+		remaining := client.Volume - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		sb.WriteString(fmt.Sprintf("Remaining: %s of %s\n", formatBytes(remaining), formatBytes(client.Volume)))
+	} else {
+		sb.WriteString("Volume: unlimited\n")
+	}
+	if client.OnHold {
+		sb.WriteString(fmt.Sprintf("Expires: %d days after the first use\n", client.Duration))
+	} else if client.Expiry > 0 {
+		days := (client.Expiry - time.Now().Unix()) / 86400
+		sb.WriteString(fmt.Sprintf("Expires: %s (%d days left)\n", time.Unix(client.Expiry, 0).Format("2006-01-02"), days))
+	} else {
+		sb.WriteString("Expires: never\n")
+	}
+	return sb.String()
+}
+
+// runUsageWarnings periodically warns bound clients which approach their volume
+// or expiry, before DepleteJob disables them.
+func runUsageWarnings(ctx context.Context, bot *telebot.Bot, cfg *Config, app AppServices) {
+	volumeThresholds := cfg.WarnVolumePercent
+	if len(volumeThresholds) == 0 {
+		volumeThresholds = defaultWarnVolumePercent
+	}
+	dayThresholds := cfg.WarnDays
+	if len(dayThresholds) == 0 {
+		dayThresholds = defaultWarnDays
+	}
+
+	ticker := time.NewTicker(usageWarningInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkUsageWarnings(bot, app, volumeThresholds, dayThresholds)
+		}
+	}
+}
+
+func checkUsageWarnings(bot *telebot.Bot, app AppServices, volumeThresholds []int, dayThresholds []int) {
+	bindingService := app.GetTgBindingService()
+	bindings, err := bindingService.GetBindings()
+	if err != nil {
+		log.Printf("Telegram: error getting bindings for usage warnings: %v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, binding := range bindings {
+		client, err := bindingService.GetClientByChat(binding.ChatId)
+		if err != nil || !client.Enable {
+			continue
+		}
+
+		warnedVolume := 0
+		var messages []string
+		if client.Volume > 0 {
+			percent := int((client.Up + client.Down) * 100 / client.Volume)
+			for _, t := range volumeThresholds {
+				if percent >= t && t > warnedVolume {
+					warnedVolume = t
+				}
+			}
+			if warnedVolume > binding.WarnedVolume {
+				messages = append(messages, fmt.Sprintf("You have used %d%% of your traffic volume.", percent))
+			}
+		}
+
+		warnedDays := 0
+		if client.Expiry > 0 {
+			daysLeft := int((client.Expiry - now + 86399) / 86400)
+			for _, t := range dayThresholds {
+				if daysLeft <= t && (warnedDays == 0 || t < warnedDays) {
+					warnedDays = t
+				}
+			}
+			if warnedDays > 0 && (binding.WarnedDays == 0 || warnedDays < binding.WarnedDays) {
+				messages = append(messages, fmt.Sprintf("Your subscription expires in %d day(s).", daysLeft))
+			}
+		}
+
+		if len(messages) > 0 {
+			text := "⚠️ " + strings.Join(messages, "\n") + "\n\n" + formatUsage(client)
+			if _, err := bot.Send(&telebot.Chat{ID: binding.ChatId}, text); err != nil {
+				log.Printf("Telegram: error sending usage warning to chat %d: %v", binding.ChatId, err)
+				continue
+			}
+		}
+		// Thresholds reset once the client is renewed
+		if warnedVolume != binding.WarnedVolume || warnedDays != binding.WarnedDays {
+			bindingService.SetWarned(binding.Id, warnedVolume, warnedDays)
+		}
+	}
+}
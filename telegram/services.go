@@ -0,0 +1,304 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/telebot.v3"
+)
+
+// serviceItem is a uniform view of a chisel, gost, MTProto, UDP tunnel, GRE or TAP instance.
+type serviceItem struct {
+	ID      uint
+	Name    string
+	Running bool
+	Detail  string
+}
+
+// serviceKinds lists the subsystems in menu order. GRE and TAP interfaces
+// exist while they are configured, so they can only be deleted.
+var serviceKinds = []struct {
+	Kind      string
+	Title     string
+	Startable bool
+}{
+	{"chisel", "Chisel", true},
+	{"gost", "Gost", true},
+	{"mtproto", "MTProto", true},
+	{"udptunnel", "UDP tunnels", true},
+	{"gre", "GRE", false},
+	{"tap", "TAP", false},
+}
+
+func registerServiceHandlers(b *telebot.Group, app AppServices) {
+	b.Handle(btnServices, func(c telebot.Context) error {
+		_ = c.Respond()
+		menu := &telebot.ReplyMarkup{}
+		var btns []telebot.Btn
+		for _, k := range serviceKinds {
+			btns = append(btns, menu.Data(k.Title, btnSvcRefresh.Unique, k.Kind))
+		}
+		rows := menu.Split(2, btns)
+		rows = append(rows, menu.Row(menu.Data("Main menu", btnMenu.Unique)))
+		menu.Inline(rows...)
+		return c.Edit("Services", menu)
+	})
+	b.Handle(btnSvcRefresh, func(c telebot.Context) error {
+		_ = c.Respond()
+		return showServices(c, app, argString(c, 0))
+	})
+	b.Handle(btnService, func(c telebot.Context) error {
+		_ = c.Respond()
+		id, err := argUint(c, 1)
+		if err != nil {
+			return c.Send("Invalid service.")
+		}
+		return showService(c, app, argString(c, 0), id)
+	})
+	b.Handle(btnSvcStart, func(c telebot.Context) error {
+		return controlService(c, app, "start")
+	})
+	b.Handle(btnSvcStop, func(c telebot.Context) error {
+		return controlService(c, app, "stop")
+	})
+	b.Handle(btnSvcDelete, func(c telebot.Context) error {
+		_ = c.Respond()
+		kind := argString(c, 0)
+		id := argString(c, 1)
+		menu := &telebot.ReplyMarkup{}
+		menu.Inline(menu.Row(
+			menu.Data("Yes, delete", btnSvcDelOk.Unique, kind, id),
+			menu.Data("Cancel", btnService.Unique, kind, id),
+		))
+		return c.Edit(fmt.Sprintf("Delete %s interface %s? This removes its configuration.", kind, id), menu)
+	})
+	b.Handle(btnSvcDelOk, func(c telebot.Context) error {
+		return controlService(c, app, "delete")
+	})
+}
+
+func showServices(c telebot.Context, app AppServices, kind string) error {
+	items, err := listServices(app, kind)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Error getting %s services: %v", kind, err))
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, item := range items {
+		state := "down"
+		if item.Running {
+			state = "up"
+		}
+		text := fmt.Sprintf("%s [%s]", item.Name, state)
+		rows = append(rows, menu.Row(menu.Data(text, btnService.Unique, kind, strconv.FormatUint(uint64(item.ID), 10))))
+	}
+	rows = append(rows, backRow(menu, "« Services", btnServices.Unique))
+	menu.Inline(rows...)
+
+	text := fmt.Sprintf("%s instances:", kind)
+	if len(items) == 0 {
+		text = fmt.Sprintf("No %s instances configured.", kind)
+	}
+	return c.Edit(text, menu)
+}
+
+func showService(c telebot.Context, app AppServices, kind string, id uint) error {
+	items, err := listServices(app, kind)
+	if err != nil {
+		return c.Send(fmt.Sprintf("Error getting %s services: %v", kind, err))
+	}
+	var item *serviceItem
+	for i := range items {
+		if items[i].ID == id {
+			item = &items[i]
+			break
+		}
+	}
+	if item == nil {
+		return c.Send(fmt.Sprintf("%s instance with ID %d not found.", kind, id))
+	}
+
+	idStr := strconv.FormatUint(uint64(id), 10)
+	menu := &telebot.ReplyMarkup{}
+	var actions []telebot.Btn
+	if isStartable(kind) {
+		if item.Running {
+			actions = append(actions, menu.Data("Stop", btnSvcStop.Unique, kind, idStr))
+		} else {
+			actions = append(actions, menu.Data("Start", btnSvcStart.Unique, kind, idStr))
+		}
+	} else {
+		actions = append(actions, menu.Data("Delete", btnSvcDelete.Unique, kind, idStr))
+	}
+	actions = append(actions, menu.Data("Refresh", btnService.Unique, kind, idStr))
+	menu.Inline(
+		menu.Row(actions...),
+		backRow(menu, "« Back", btnSvcRefresh.Unique, kind),
+	)
+
+	state := "down"
+	if item.Running {
+		state = "up"
+	}
+	text := fmt.Sprintf("%s: %s (ID: %d)\nStatus: %s\n%s", kind, item.Name, item.ID, state, item.Detail)
+	return c.Edit(text, menu)
+}
+
+func controlService(c telebot.Context, app AppServices, action string) error {
+	kind := argString(c, 0)
+	id, err := argUint(c, 1)
+	if err != nil {
+		return c.RespondText("Invalid service.")
+	}
+
+	switch kind + ":" + action {
+	case "chisel:start", "chisel:stop":
+		cfg, err := app.GetChiselService().GetChiselConfig(id)
+		if err == nil {
+			if action == "start" {
+				err = app.GetChiselService().StartChisel(cfg)
+			} else {
+				err = app.GetChiselService().StopChisel(cfg)
+			}
+		}
+		if err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "gost:start":
+		cfg, err := app.GetGostService().GetGostConfig(id)
+		if err == nil {
+			err = app.GetGostService().StartGost(cfg)
+		}
+		if err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "gost:stop":
+		if err := app.GetGostService().StopGost(id); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "mtproto:start":
+		cfg, err := app.GetMTProtoService().GetMTProtoConfig(id)
+		if err == nil {
+			err = app.GetMTProtoService().StartMTProto(cfg)
+		}
+		if err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "mtproto:stop":
+		if err := app.GetMTProtoService().StopMTProto(id); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "udptunnel:start":
+		cfg, err := app.GetUdpTunnelService().GetUdpTunnelByID(id)
+		if err == nil {
+			err = app.GetUdpTunnelService().StartUdpTunnel(cfg)
+		}
+		if err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "udptunnel:stop":
+		if err := app.GetUdpTunnelService().StopUdpTunnel(id); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "gre:delete":
+		if err := app.GetGreService().DeleteGreTunnel(id); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	case "tap:delete":
+		if err := app.GetTapService().DeleteTapTunnel(id); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error: %v", err))
+		}
+	default:
+		return c.RespondText("Unsupported action.")
+	}
+
+	_ = c.RespondText(fmt.Sprintf("%s %s: done.", kind, action))
+	if action == "delete" {
+		return showServices(c, app, kind)
+	}
+	return showService(c, app, kind, id)
+}
+
+func listServices(app AppServices, kind string) ([]serviceItem, error) {
+	var items []serviceItem
+	switch kind {
+	case "chisel":
+		configs, err := app.GetChiselService().GetAllChiselConfigs()
+		if err != nil {
+			return nil, err
+		}
+		active := make(map[uint]bool)
+		for _, id := range app.GetChiselService().GetActiveChiselConfigIDs() {
+			active[id] = true
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Mode: %s\nServer: %s:%d\nListen: %s:%d", cfg.Mode, cfg.ServerAddress, cfg.ServerPort, cfg.ListenAddress, cfg.ListenPort)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, active[cfg.ID], detail})
+		}
+	case "gost":
+		configs, err := app.GetGostService().GetAllGostConfigs()
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Mode: %s\nServer: %s:%d\nListen: %s:%d", cfg.Mode, cfg.ServerAddress, cfg.ServerPort, cfg.ListenAddress, cfg.ListenPort)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, cfg.Status == "up", detail})
+		}
+	case "mtproto":
+		configs, err := app.GetMTProtoService().GetAllMTProtoConfigs()
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Listen port: %d", cfg.ListenPort)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, cfg.Status == "up", detail})
+		}
+	case "udptunnel":
+		configs, err := app.GetUdpTunnelService().GetAllUdpTunnels()
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Role: %s\nMode: %s\nListen port: %d\nRemote: %s", cfg.Role, cfg.Mode, cfg.ListenPort, cfg.RemoteAddress)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, cfg.Status == "running", detail})
+		}
+	case "gre":
+		configs, err := app.GetGreService().GetAllGreTunnels()
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Local: %s\nRemote: %s\nAddress: %s", cfg.LocalAddress, cfg.RemoteAddress, cfg.TunnelAddress)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, cfg.Status == "up", withNamespace(detail, cfg.Namespace)})
+		}
+	case "tap":
+		configs, err := app.GetTapService().GetAllTapTunnels()
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			detail := fmt.Sprintf("Address: %s\nMTU: %d", cfg.LocalAddress, cfg.MTU)
+			items = append(items, serviceItem{cfg.ID, cfg.Name, cfg.Status == "up", withNamespace(detail, cfg.Namespace)})
+		}
+	default:
+		return nil, fmt.Errorf("unknown service kind: %s", kind)
+	}
+	return items, nil
+}
+
+func isStartable(kind string) bool {
+	for _, k := range serviceKinds {
+		if k.Kind == kind {
+			return k.Startable
+		}
+	}
+	return false
+}
+
+func withNamespace(detail string, namespace string) string {
+	if namespace == "" {
+		return detail
+	}
+	return detail + "\nNamespace: " + namespace
+}
@@ -0,0 +1,155 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Telegram rejects messages longer than 4096 characters
+const maxMessageLength = 4000
+
+func registerSystemHandlers(b *telebot.Group, app AppServices) {
+	b.Handle(btnOnlines, func(c telebot.Context) error {
+		_ = c.Respond()
+		return showOnlines(c, app)
+	})
+	b.Handle(btnLogs, func(c telebot.Context) error {
+		_ = c.Respond()
+		return showLogs(c, app, argString(c, 0))
+	})
+	b.Handle(btnBackup, func(c telebot.Context) error {
+		_ = c.Respond(&telebot.CallbackResponse{Text: "Preparing backup..."})
+		return sendBackup(c, app)
+	})
+	b.Handle(btnRestart, func(c telebot.Context) error {
+		_ = c.Respond()
+		menu := &telebot.ReplyMarkup{}
+		menu.Inline(
+			menu.Row(menu.Data("Restart core", btnRestartOk.Unique, "core"), menu.Data("Restart app", btnRestartOk.Unique, "app")),
+			menu.Row(menu.Data("Main menu", btnMenu.Unique)),
+		)
+		return c.Edit("What should be restarted?", menu)
+	})
+	b.Handle(btnRestartOk, func(c telebot.Context) error {
+		return restart(c, app, argString(c, 0))
+	})
+}
+
+func showOnlines(c telebot.Context, app AppServices) error {
+	onlines, err := app.GetOnlines()
+	if err != nil {
+		return c.Send(fmt.Sprintf("Error getting online users: %v", err))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Online users (%d):\n", len(onlines.User)))
+	for _, user := range onlines.User {
+		sb.WriteString("- " + user + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("\nActive inbounds (%d):\n", len(onlines.Inbound)))
+	for _, inbound := range onlines.Inbound {
+		sb.WriteString("- " + inbound + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("\nActive outbounds (%d):\n", len(onlines.Outbound)))
+	for _, outbound := range onlines.Outbound {
+		sb.WriteString("- " + outbound + "\n")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(backRow(menu, "Refresh", btnOnlines.Unique))
+	return c.Edit(truncate(sb.String()), menu)
+}
+
+func showLogs(c telebot.Context, app AppServices, level string) error {
+	if level == "" {
+		level = "info"
+	}
+	logs := app.GetLogs("30", level)
+
+	text := "No log entries."
+	if len(logs) > 0 {
+		// Logs are returned newest first
+		lines := make([]string, 0, len(logs))
+		for i := len(logs) - 1; i >= 0; i-- {
+			lines = append(lines, logs[i])
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(
+			menu.Data("Debug", btnLogs.Unique, "debug"),
+			menu.Data("Info", btnLogs.Unique, "info"),
+			menu.Data("Warning", btnLogs.Unique, "warning"),
+			menu.Data("Error", btnLogs.Unique, "error"),
+		),
+		backRow(menu, "Refresh", btnLogs.Unique, level),
+	)
+	// Keep the newest lines when the tail does not fit into one message
+	return c.Edit(fmt.Sprintf("Logs (%s):\n%s", level, truncateStart(text)), menu)
+}
+
+func sendBackup(c telebot.Context, app AppServices) error {
+	db, err := app.BackupDB("")
+	if err != nil {
+		return c.Send(fmt.Sprintf("Error creating DB backup: %v", err))
+	}
+	doc := &telebot.Document{
+		File:     telebot.FromReader(bytes.NewReader(db)),
+		FileName: fmt.Sprintf("s-ui_%s.db", time.Now().Format("20060102-150405")),
+		Caption:  "Database backup",
+	}
+	return c.Send(doc)
+}
+
+func restart(c telebot.Context, app AppServices, target string) error {
+	switch target {
+	case "core":
+		if err := app.GetConfigService().RestartCore(); err != nil {
+			return c.RespondAlert(fmt.Sprintf("Error restarting core: %v", err))
+		}
+		_ = c.RespondText("Core restarted.")
+		return c.Edit("Core restarted.", mainMenu())
+	case "app":
+		_ = c.RespondText("Restarting app...")
+		if err := c.Edit("App is restarting..."); err != nil {
+			return err
+		}
+		// Let the reply go out before the app stops its servers
+		go app.RestartApp()
+		return nil
+	default:
+		return c.RespondText("Unknown restart target.")
+	}
+}
+
+// truncate cuts the end of a text which does not fit into a message. Texts
+// are cut on a rune boundary, Telegram rejects invalid UTF-8.
+func truncate(text string) string {
+	if len(text) > maxMessageLength {
+		cut := maxMessageLength
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		return text[:cut] + "…"
+	}
+	return text
+}
+
+// truncateStart cuts the start of a text like truncate cuts its end.
+func truncateStart(text string) string {
+	if len(text) > maxMessageLength {
+		cut := len(text) - maxMessageLength
+		for cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+		return "…" + text[cut:]
+	}
+	return text
+}
@@ -0,0 +1,151 @@
+package telegram
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/telebot.v3"
+)
+
+// WebhookPath is where the web server mounts the webhook, below the panel path
+// and followed by a token derived from the webhook secret.
+const WebhookPath = "tgbot/"
+
+var activeWebhook atomic.Pointer[webhookPoller]
+
+// ServeWebhook handles the updates Telegram pushes to the panel.
+func ServeWebhook(w http.ResponseWriter, r *http.Request, token string) {
+	p := activeWebhook.Load()
+	if p == nil || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	p.ServeHTTP(w, r)
+}
+
+// webhookPoller receives updates through the panel web server. If Telegram
+// refuses the webhook, e.g. because of an unsupported port, it falls back to
+// long polling.
+type webhookPoller struct {
+	url    string
+	token  string
+	secret string
+	cert   string
+
+	mu   sync.RWMutex
+	dest chan telebot.Update
+	done chan struct{}
+}
+
+func newWebhookPoller(cfg *Config) *webhookPoller {
+	token := webhookToken(cfg.WebhookSecret)
+	return &webhookPoller{
+		url:    strings.TrimSuffix(cfg.WebhookURL, "/") + "/" + WebhookPath + token,
+		token:  token,
+		secret: cfg.WebhookSecret,
+		cert:   selfSignedCert(cfg.WebhookCert),
+	}
+}
+
+func (p *webhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	hook := &telebot.Webhook{
+		SecretToken: p.secret,
+		Endpoint: &telebot.WebhookEndpoint{
+			PublicURL: p.url,
+			Cert:      p.cert,
+		},
+	}
+	if err := b.SetWebhook(hook); err != nil {
+		log.Printf("Telegram: unable to set webhook, falling back to long polling: %v", err)
+		b.RemoveWebhook()
+		newLongPoller().Poll(b, dest, stop)
+		return
+	}
+	log.Println("Telegram: receiving updates through the webhook.")
+
+	p.mu.Lock()
+	p.dest = dest
+	p.done = make(chan struct{})
+	p.mu.Unlock()
+
+	<-stop
+
+	p.mu.Lock()
+	close(p.done)
+	p.dest = nil
+	p.mu.Unlock()
+	if err := b.RemoveWebhook(); err != nil {
+		log.Printf("Telegram: unable to remove webhook: %v", err)
+	}
+}
+
+func (p *webhookPoller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(p.secret)) != 1 {
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+	var update telebot.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	dest, done := p.dest, p.done
+	p.mu.RUnlock()
+	if dest == nil {
+		http.Error(w, "bot is not running", http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case dest <- update:
+	case <-done:
+		// Telegram retries the update once the bot runs again
+		http.Error(w, "bot is not running", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+func newLongPoller() *telebot.LongPoller {
+	return &telebot.LongPoller{Timeout: 10}
+}
+
+// webhookToken derives the path token, so the secret-token header can't be
+// read from access logs.
+func webhookToken(secret string) string {
+	sum := sha256.Sum256([]byte("tgbot:" + secret))
+	return hex.EncodeToString(sum[:16])
+}
+
+// selfSignedCert returns certFile if Telegram has to be given the certificate
+// to trust it.
+func selfSignedCert(certFile string) string {
+	if certFile == "" {
+		return ""
+	}
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return ""
+	}
+	return certFile
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"net"
+	"strings"
+
+	"github.com/igor04091968/sing-chisel-tel/util/common"
+)
+
+// ParseIPNets parses a list of IPs and CIDRs separated by commas or new
+// lines. Single IPs become host networks.
+func ParseIPNets(list string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, entry := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			result = append(result, network)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, common.NewErrorf("invalid IP or CIDR: %s", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return result, nil
+}
+
+// ContainsIP reports whether one of the networks contains the IP.
+func ContainsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken returns the SHA-256 hash of an API token. Tokens are long random
+// strings, so a fast unsalted hash is enough and keeps lookups cheap.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsTokenHash reports whether a stored token is hashed, as opposed to a
+// plaintext token of an older version.
+func IsTokenHash(stored string) bool {
+	if len(stored) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(stored)
+	return err == nil
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/igor04091968/sing-chisel-tel/middleware"
 	"github.com/igor04091968/sing-chisel-tel/network"
 	"github.com/igor04091968/sing-chisel-tel/service"
+	"github.com/igor04091968/sing-chisel-tel/telegram"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/sessions"
@@ -88,6 +89,23 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		engine.Use(middleware.DomainValidator(webDomain))
 	}
 
+	trustedProxies, err := s.settingService.GetTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+	middleware.SetTrustedProxies(trustedProxies)
+
+	// The token API has its own lists, and Telegram can't be allowlisted
+	webAllow, webDeny, err := s.settingService.GetIPFilter("web")
+	if err != nil {
+		return nil, err
+	}
+	if len(webAllow) > 0 || len(webDeny) > 0 {
+		engine.Use(middleware.IPFilter(webAllow, webDeny, base_url+"apiv2", base_url+telegram.WebhookPath))
+	}
+	var loginGuard service.LoginGuardService
+	engine.Use(middleware.BanGuard(loginGuard.IsBanned))
+
 	secret, err := s.settingService.GetSecret()
 	if err != nil {
 		return nil, err
@@ -114,7 +132,19 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 
 	engine.StaticFS(assetsBasePath, http.FS(assetsFS))
 
+	// Telegram pushes bot updates here in webhook mode
+	engine.POST(base_url+telegram.WebhookPath+":token", func(c *gin.Context) {
+		telegram.ServeWebhook(c.Writer, c.Request, c.Param("token"))
+	})
+
 	group_apiv2 := engine.Group(base_url + "apiv2")
+	apiAllow, apiDeny, err := s.settingService.GetIPFilter("api")
+	if err != nil {
+		return nil, err
+	}
+	if len(apiAllow) > 0 || len(apiDeny) > 0 {
+		group_apiv2.Use(middleware.IPFilter(apiAllow, apiDeny))
+	}
 	apiv2 := api.NewAPIv2Handler(group_apiv2)
 
 	group_api := engine.Group(base_url + "api")